@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StorageClass is a portable storage tier. Drivers map it to the provider's
+// own class names. Values other than the constants below are passed to the
+// provider unchanged (e.g. "INTELLIGENT_TIERING" on S3).
+type StorageClass string
+
+// Portable storage classes.
+const (
+	StorageClassStandard         StorageClass = "standard"
+	StorageClassInfrequentAccess StorageClass = "infrequent_access"
+	StorageClassArchive          StorageClass = "archive"
+	StorageClassColdArchive      StorageClass = "cold_archive"
+)
+
+// ArchiveStorage extends Storage with storage class management.
+// Not all drivers support these methods.
+type ArchiveStorage interface {
+	Storage
+
+	// SetStorageClass changes the storage class of an existing file.
+	SetStorageClass(ctx context.Context, key string, class StorageClass) error
+
+	// Restore requests a temporary readable copy of an archived file.
+	// days specifies how long the restored copy stays available.
+	Restore(ctx context.Context, key string, days int) error
+
+	// RestoreStatus reports the progress of a Restore request.
+	RestoreStatus(ctx context.Context, key string) (*RestoreStatus, error)
+}
+
+// RestoreStatus describes the restore state of an archived file.
+type RestoreStatus struct {
+	Ongoing   bool      // A restore request is still in progress
+	Restored  bool      // A restored copy is available for download
+	ExpiresAt time.Time // When the restored copy expires (if known)
+}
+
+// ParseRestoreHeader parses the restore header returned by S3-style APIs
+// (x-amz-restore, x-oss-restore, x-cos-restore), e.g.
+//
+//	ongoing-request="false", expiry-date="Fri, 23 Dec 2012 00:00:00 GMT"
+//
+// An empty header means no restore was requested.
+func ParseRestoreHeader(h string) *RestoreStatus {
+	status := &RestoreStatus{}
+	if h == "" {
+		return status
+	}
+	for _, part := range strings.Split(h, "\",") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		v = strings.Trim(strings.TrimSpace(v), "\"")
+		switch strings.TrimSpace(k) {
+		case "ongoing-request":
+			status.Ongoing = v == "true"
+		case "expiry-date":
+			if t, err := http.ParseTime(v); err == nil {
+				status.ExpiresAt = t
+			}
+		}
+	}
+	status.Restored = !status.Ongoing
+	return status
+}
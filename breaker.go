@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState string
+
+// Circuit breaker states.
+const (
+	CircuitClosed   CircuitState = "closed"    // Calls pass through
+	CircuitOpen     CircuitState = "open"      // Calls fail fast with CircuitOpenError
+	CircuitHalfOpen CircuitState = "half-open" // One trial call is let through
+)
+
+// CircuitBreakerOptions configures CircuitBreakerStorage.
+type CircuitBreakerOptions struct {
+	Threshold int           `option:"threshold"` // Consecutive retryable failures that open the circuit (default 5)
+	Cooldown  time.Duration `option:"cooldown"`  // Time the circuit stays open before a trial call (default 30s)
+}
+
+// CircuitOpenError is returned while the circuit is open. It matches
+// ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	RetryAfter time.Duration // Time until a trial call is allowed
+	LastErr    error         // The failure that opened the circuit
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("storage: circuit breaker is open (retry after %s): %v", e.RetryAfter.Round(time.Millisecond), e.LastErr)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitBreakerStorage wraps a Storage with a circuit breaker. After
+// Threshold consecutive retryable failures (see IsRetryableError) the
+// circuit opens and calls fail with *CircuitOpenError without reaching
+// the storage. After Cooldown a single trial call is let through; its
+// success closes the circuit and its failure opens it again.
+type CircuitBreakerStorage struct {
+	wrapped
+	opts CircuitBreakerOptions
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	lastErr  error
+	trial    bool // A half-open trial call is in flight
+}
+
+// WrapWithCircuitBreaker wraps a storage with a circuit breaker.
+func WrapWithCircuitBreaker(s Storage, opts CircuitBreakerOptions) *CircuitBreakerStorage {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	return &CircuitBreakerStorage{wrapped: wrapped{s}, opts: opts, state: CircuitClosed}
+}
+
+// parseCircuitBreaker reads CircuitBreakerOptions from a disk config value:
+//
+//	circuit_breaker:
+//	  threshold: 5
+//	  cooldown: 30s
+func parseCircuitBreaker(v any) (CircuitBreakerOptions, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return CircuitBreakerOptions{}, fmt.Errorf("expected a map, got %T", v)
+	}
+	var opts CircuitBreakerOptions
+	err := DecodeOptions(m, &opts)
+	return opts, err
+}
+
+// State returns the current state of the circuit.
+func (c *CircuitBreakerStorage) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= c.opts.Cooldown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// allow reports whether a call may proceed.
+func (c *CircuitBreakerStorage) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitOpen:
+		if wait := c.opts.Cooldown - time.Since(c.openedAt); wait > 0 {
+			return &CircuitOpenError{RetryAfter: wait, LastErr: c.lastErr}
+		}
+		c.state = CircuitHalfOpen
+		c.trial = true
+		return nil
+	case CircuitHalfOpen:
+		if c.trial {
+			return &CircuitOpenError{LastErr: c.lastErr}
+		}
+		c.trial = true
+	}
+	return nil
+}
+
+// report records the outcome of a call.
+func (c *CircuitBreakerStorage) report(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trial = false
+	if !IsRetryableError(err) {
+		if c.state != CircuitClosed {
+			defaultLogger.Info("circuit breaker: closed")
+		}
+		c.state = CircuitClosed
+		c.failures = 0
+		return
+	}
+	c.failures++
+	c.lastErr = err
+	if c.state == CircuitHalfOpen || c.failures >= c.opts.Threshold {
+		if c.state != CircuitOpen {
+			defaultLogger.Warn("circuit breaker: open after %d failures: %v", c.failures, err)
+		}
+		c.state = CircuitOpen
+		c.openedAt = time.Now()
+	}
+}
+
+// guard runs fn if the circuit allows it and records the outcome.
+func guard[T any](c *CircuitBreakerStorage, fn func() (T, error)) (T, error) {
+	if err := c.allow(); err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := fn()
+	c.report(err)
+	return v, err
+}
+
+func (c *CircuitBreakerStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	return guard(c, func() (*UploadResult, error) {
+		return c.Storage.Upload(ctx, key, reader, opts...)
+	})
+}
+
+func (c *CircuitBreakerStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return guard(c, func() (io.ReadCloser, error) {
+		return c.Storage.Download(ctx, key)
+	})
+}
+
+func (c *CircuitBreakerStorage) Delete(ctx context.Context, key string) error {
+	_, err := guard(c, func() (struct{}, error) {
+		return struct{}{}, c.Storage.Delete(ctx, key)
+	})
+	return err
+}
+
+func (c *CircuitBreakerStorage) Exists(ctx context.Context, key string) (bool, error) {
+	return guard(c, func() (bool, error) {
+		return c.Storage.Exists(ctx, key)
+	})
+}
+
+func (c *CircuitBreakerStorage) URL(ctx context.Context, key string) (string, error) {
+	return guard(c, func() (string, error) {
+		return c.Storage.URL(ctx, key)
+	})
+}
+
+func (c *CircuitBreakerStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return guard(c, func() (string, error) {
+		return c.wrapped.SignedURL(ctx, key, expires)
+	})
+}
+
+func (c *CircuitBreakerStorage) List(ctx context.Context, prefix string, opts ...ListOption) (*ListResult, error) {
+	return guard(c, func() (*ListResult, error) {
+		return c.wrapped.List(ctx, prefix, opts...)
+	})
+}
+
+func (c *CircuitBreakerStorage) Copy(ctx context.Context, src, dst string) error {
+	_, err := guard(c, func() (struct{}, error) {
+		return struct{}{}, c.wrapped.Copy(ctx, src, dst)
+	})
+	return err
+}
+
+func (c *CircuitBreakerStorage) Move(ctx context.Context, src, dst string) error {
+	_, err := guard(c, func() (struct{}, error) {
+		return struct{}{}, c.wrapped.Move(ctx, src, dst)
+	})
+	return err
+}
+
+func (c *CircuitBreakerStorage) Size(ctx context.Context, key string) (int64, error) {
+	return guard(c, func() (int64, error) {
+		return c.wrapped.Size(ctx, key)
+	})
+}
+
+func (c *CircuitBreakerStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	return guard(c, func() (*FileInfo, error) {
+		return c.wrapped.Metadata(ctx, key)
+	})
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStorage(t *testing.T) {
+	ctx := context.Background()
+	disk := &flakyStorage{Storage: newTestLocal(t)}
+	s := WrapWithCircuitBreaker(disk, CircuitBreakerOptions{Threshold: 3, Cooldown: 50 * time.Millisecond})
+
+	// Not-found errors are not failures of the storage.
+	for i := 0; i < 5; i++ {
+		s.Download(ctx, "missing.txt")
+	}
+	if s.State() != CircuitClosed {
+		t.Fatalf("State = %s, want closed", s.State())
+	}
+
+	disk.down.Store(true)
+	for i := 0; i < 3; i++ {
+		if _, err := s.Exists(ctx, "a.txt"); !errors.Is(err, errDown) {
+			t.Fatalf("call %d: expected the storage error, got %v", i, err)
+		}
+	}
+	_, err := s.Upload(ctx, "a.txt", strings.NewReader("a"))
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrCircuitOpen) || open.RetryAfter <= 0 {
+		t.Fatalf("Expected CircuitOpenError, got %v", err)
+	}
+
+	// A failed trial call opens the circuit again.
+	time.Sleep(60 * time.Millisecond)
+	if s.State() != CircuitHalfOpen {
+		t.Fatalf("State = %s, want half-open", s.State())
+	}
+	s.Exists(ctx, "a.txt")
+	if _, err := s.Exists(ctx, "a.txt"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the circuit to reopen, got %v", err)
+	}
+
+	// A successful trial call closes it.
+	disk.down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := s.Exists(ctx, "a.txt"); err != nil {
+		t.Fatalf("Trial call failed: %v", err)
+	}
+	if s.State() != CircuitClosed {
+		t.Errorf("State = %s, want closed", s.State())
+	}
+}
+
+func TestDiskOptions_Setup(t *testing.T) {
+	mgr := NewManager(&Config{
+		Storages: map[string]StorageConfig{
+			"limited": {Driver: "local", Options: map[string]any{
+				"root":            t.TempDir(),
+				"rate_limit":      map[string]any{"ops_per_second": 100, "bytes_per_second": 1 << 20},
+				"circuit_breaker": map[string]any{"threshold": 3, "cooldown": "10s"},
+			}},
+			"bad": {Driver: "local", Options: map[string]any{
+				"root":            t.TempDir(),
+				"circuit_breaker": map[string]any{"cooldown": "later"},
+			}},
+		},
+	})
+	defer mgr.Close()
+
+	s, err := mgr.Disk("limited")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	cb, ok := s.(*CircuitBreakerStorage)
+	if !ok || cb.opts.Threshold != 3 || cb.opts.Cooldown != 10*time.Second {
+		t.Fatalf("Expected a circuit breaker outermost, got %T %+v", s, cb)
+	}
+	rl, ok := cb.Unwrap().(*RateLimitedStorage)
+	if !ok || rl.ops == nil || rl.bytes == nil {
+		t.Fatalf("Expected a rate limiter inside, got %T", cb.Unwrap())
+	}
+	if _, ok := rl.Unwrap().(*localStorage); !ok {
+		t.Errorf("Expected the local driver innermost, got %T", rl.Unwrap())
+	}
+
+	if _, err := mgr.Disk("bad"); err == nil || !strings.Contains(err.Error(), "circuit_breaker") {
+		t.Errorf("Expected a circuit_breaker error, got %v", err)
+	}
+}
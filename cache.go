@@ -0,0 +1,416 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheBackend stores the bodies of cached objects for CachedStorage,
+// which keeps the index, sizes and expiry itself. Entries are identified
+// by opaque ids.
+type CacheBackend interface {
+	Put(id string, r io.Reader) (int64, error)
+	Open(id string) (io.ReadCloser, error)
+	Delete(id string) error
+}
+
+type memoryCache struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemoryCache returns a CacheBackend keeping objects in memory.
+func NewMemoryCache() CacheBackend {
+	return &memoryCache{files: make(map[string][]byte)}
+}
+
+func (c *memoryCache) Put(id string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.files[id] = data
+	c.mu.Unlock()
+	return int64(len(data)), nil
+}
+
+func (c *memoryCache) Open(id string) (io.ReadCloser, error) {
+	c.mu.RLock()
+	data, ok := c.files[id]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *memoryCache) Delete(id string) error {
+	c.mu.Lock()
+	delete(c.files, id)
+	c.mu.Unlock()
+	return nil
+}
+
+type diskCache struct {
+	dir string
+}
+
+const diskCacheExt = ".cache"
+
+// NewDiskCache returns a CacheBackend keeping objects as files in dir.
+// Cache files left in dir by a previous process are removed.
+func NewDiskCache(dir string) (CacheBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("storage: cache: failed to create directory: %w", err)
+	}
+	stale, _ := filepath.Glob(filepath.Join(dir, "*"+diskCacheExt))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+	return &diskCache{dir: dir}, nil
+}
+
+func (c *diskCache) path(id string) string {
+	return filepath.Join(c.dir, id+diskCacheExt)
+}
+
+func (c *diskCache) Put(id string, r io.Reader) (int64, error) {
+	f, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(id))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+func (c *diskCache) Open(id string) (io.ReadCloser, error) {
+	f, err := os.Open(c.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (c *diskCache) Delete(id string) error {
+	if err := os.Remove(c.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CacheOptions configures CachedStorage.
+type CacheOptions struct {
+	MaxSize    int64         // Total bytes cached (default 256 MiB); larger objects are not cached
+	TTL        time.Duration // Time an entry is served without checking the storage (0 = until evicted)
+	Revalidate bool          // When the TTL expires, keep the entry if its ETag is unchanged
+}
+
+// CacheStats reports CachedStorage activity.
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+	Size    int64
+}
+
+type cacheEntry struct {
+	key     string
+	id      string
+	size    int64
+	etag    string
+	expires time.Time // Zero = never
+}
+
+type cacheFlight struct {
+	done  chan struct{}
+	stale bool // Invalidated while fetching; do not keep the result
+}
+
+// CachedStorage wraps a Storage with a read-through cache for Download.
+//
+// Cached objects are evicted least recently used first once MaxSize is
+// reached. Concurrent misses for the same key share one fetch. Uploads,
+// deletes, copies and moves through the wrapper invalidate the affected
+// keys; changes made directly on the storage are seen after the TTL.
+type CachedStorage struct {
+	wrapped
+	backend CacheBackend
+	opts    CacheOptions
+
+	mu      sync.Mutex
+	lru     *list.List // Of *cacheEntry, most recent first
+	entries map[string]*list.Element
+	flights map[string]*cacheFlight
+	size    int64
+	seq     uint64
+	hits    int64
+	misses  int64
+}
+
+// WrapWithCache wraps a storage with a read-through cache.
+func WrapWithCache(s Storage, backend CacheBackend, opts CacheOptions) *CachedStorage {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 256 << 20
+	}
+	return &CachedStorage{
+		wrapped: wrapped{s},
+		backend: backend,
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		flights: make(map[string]*cacheFlight),
+	}
+}
+
+// Download serves key from the cache, fetching it on a miss.
+func (c *CachedStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	if rc := c.lookup(ctx, key); rc != nil {
+		return rc, nil
+	}
+
+	c.mu.Lock()
+	c.misses++
+	f, shared := c.flights[key]
+	if !shared {
+		f = &cacheFlight{done: make(chan struct{})}
+		c.flights[key] = f
+	}
+	c.mu.Unlock()
+
+	if shared {
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else {
+		err := c.fetch(ctx, key, f)
+		c.mu.Lock()
+		delete(c.flights, key)
+		c.mu.Unlock()
+		close(f.done)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rc := c.open(key); rc != nil {
+		return rc, nil
+	}
+	// Not cacheable (too large, invalidated or failed): read directly.
+	return c.Storage.Download(ctx, key)
+}
+
+// lookup returns the cached body of key if it is fresh, revalidating it
+// if it expired.
+func (c *CachedStorage) lookup(ctx context.Context, key string) io.ReadCloser {
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	expired := !e.expires.IsZero() && time.Now().After(e.expires)
+	c.mu.Unlock()
+
+	if expired {
+		if !c.opts.Revalidate || e.etag == "" {
+			c.evict(key, e.id)
+			return nil
+		}
+		info, err := c.wrapped.Metadata(ctx, key)
+		if err != nil || info.ETag != e.etag {
+			c.evict(key, e.id)
+			return nil
+		}
+		c.mu.Lock()
+		e.expires = time.Now().Add(c.opts.TTL)
+		c.mu.Unlock()
+	}
+
+	rc := c.open(key)
+	if rc != nil {
+		c.mu.Lock()
+		c.hits++
+		c.mu.Unlock()
+	}
+	return rc
+}
+
+// open opens the cached body of key, if any.
+func (c *CachedStorage) open(key string) io.ReadCloser {
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	rc, err := c.backend.Open(e.id)
+	if err != nil {
+		c.evict(key, e.id)
+		return nil
+	}
+	return rc
+}
+
+// fetch downloads key into the cache. Objects larger than MaxSize are
+// dropped without error so callers read them directly.
+func (c *CachedStorage) fetch(ctx context.Context, key string, f *cacheFlight) error {
+	var etag string
+	if c.opts.Revalidate {
+		// Read the ETag first: if the object changes in between, the next
+		// revalidation sees a different ETag and refetches.
+		if info, err := c.wrapped.Metadata(ctx, key); err == nil {
+			etag = info.ETag
+		}
+	}
+
+	rc, err := c.Storage.Download(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	c.mu.Lock()
+	c.seq++
+	id := strconv.FormatUint(c.seq, 10)
+	c.mu.Unlock()
+
+	n, err := c.backend.Put(id, io.LimitReader(rc, c.opts.MaxSize+1))
+	if err != nil {
+		c.backend.Delete(id)
+		defaultLogger.Warn("cache: failed to store %q: %v", key, err)
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f.stale || n > c.opts.MaxSize {
+		c.backend.Delete(id)
+		return nil
+	}
+	e := &cacheEntry{key: key, id: id, size: n, etag: etag}
+	if c.opts.TTL > 0 {
+		e.expires = time.Now().Add(c.opts.TTL)
+	}
+	if old, ok := c.entries[key]; ok {
+		c.removeLocked(old)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += n
+	for c.size > c.opts.MaxSize {
+		c.removeLocked(c.lru.Back())
+	}
+	return nil
+}
+
+func (c *CachedStorage) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	c.backend.Delete(e.id)
+}
+
+// evict removes key's entry if it still refers to id.
+func (c *CachedStorage) evict(key, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok && el.Value.(*cacheEntry).id == id {
+		c.removeLocked(el)
+	}
+}
+
+// Invalidate removes keys from the cache. A fetch in progress for a key
+// is not kept.
+func (c *CachedStorage) Invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.removeLocked(el)
+		}
+		if f, ok := c.flights[key]; ok {
+			f.stale = true
+		}
+	}
+}
+
+// InvalidatePrefix removes every cached key starting with prefix.
+func (c *CachedStorage) InvalidatePrefix(prefix string) {
+	c.mu.Lock()
+	var keys []string
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range c.flights {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.Unlock()
+	c.Invalidate(keys...)
+}
+
+// Stats returns cache statistics.
+func (c *CachedStorage) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries), Size: c.size}
+}
+
+func (c *CachedStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	defer c.Invalidate(key)
+	return c.Storage.Upload(ctx, key, reader, opts...)
+}
+
+func (c *CachedStorage) Delete(ctx context.Context, key string) error {
+	defer c.Invalidate(key)
+	return c.Storage.Delete(ctx, key)
+}
+
+func (c *CachedStorage) Copy(ctx context.Context, src, dst string) error {
+	defer c.Invalidate(dst)
+	return c.wrapped.Copy(ctx, src, dst)
+}
+
+func (c *CachedStorage) Move(ctx context.Context, src, dst string) error {
+	defer c.Invalidate(src, dst)
+	return c.wrapped.Move(ctx, src, dst)
+}
+
+// Close empties the cache and closes the wrapped storage.
+func (c *CachedStorage) Close() error {
+	c.mu.Lock()
+	for c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+	c.mu.Unlock()
+	return c.Storage.Close()
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStorage counts downloads and can delay them.
+type countingStorage struct {
+	*localStorage
+	downloads atomic.Int64
+	delay     time.Duration
+}
+
+func (c *countingStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	c.downloads.Add(1)
+	time.Sleep(c.delay)
+	return c.localStorage.Download(ctx, key)
+}
+
+func TestCachedStorage(t *testing.T) {
+	ctx := context.Background()
+	disk, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDiskCache failed: %v", err)
+	}
+
+	for name, backend := range map[string]CacheBackend{"memory": NewMemoryCache(), "disk": disk} {
+		inner := &countingStorage{localStorage: newTestLocal(t), delay: 20 * time.Millisecond}
+		c := WrapWithCache(inner, backend, CacheOptions{MaxSize: 10})
+		inner.Upload(ctx, "a.txt", strings.NewReader("aaaa"))
+
+		// Concurrent misses collapse into one fetch.
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if got := readString(t, c, "a.txt"); got != "aaaa" {
+					t.Errorf("%s: got %q", name, got)
+				}
+			}()
+		}
+		wg.Wait()
+		readString(t, c, "a.txt")
+		if n := inner.downloads.Load(); n != 1 {
+			t.Errorf("%s: %d downloads, want 1", name, n)
+		}
+
+		// Writes through the wrapper invalidate.
+		c.Upload(ctx, "a.txt", strings.NewReader("AAAA"))
+		if got := readString(t, c, "a.txt"); got != "AAAA" {
+			t.Errorf("%s: after upload got %q", name, got)
+		}
+
+		// LRU eviction: b and c do not fit together with a.
+		inner.Upload(ctx, "b.txt", strings.NewReader("bbbb"))
+		inner.Upload(ctx, "c.txt", strings.NewReader("cccc"))
+		readString(t, c, "b.txt")
+		readString(t, c, "c.txt")
+		if stats := c.Stats(); stats.Entries != 2 || stats.Size != 8 {
+			t.Errorf("%s: stats = %+v, want 2 entries of 8 bytes", name, stats)
+		}
+		before := inner.downloads.Load()
+		readString(t, c, "a.txt")
+		if inner.downloads.Load() != before+1 {
+			t.Errorf("%s: evicted entry should be fetched again", name)
+		}
+
+		// Objects larger than the cache are read directly.
+		inner.Upload(ctx, "big.txt", strings.NewReader(strings.Repeat("x", 20)))
+		if got := readString(t, c, "big.txt"); len(got) != 20 {
+			t.Errorf("%s: big object = %d bytes", name, len(got))
+		}
+
+		c.Delete(ctx, "c.txt")
+		if _, err := c.Download(ctx, "c.txt"); !IsNotFoundError(err) {
+			t.Errorf("%s: deleted key should not be served from cache, got %v", name, err)
+		}
+	}
+}
+
+// etagStorage reports a settable ETag from Metadata.
+type etagStorage struct {
+	countingStorage
+	etag atomic.Value
+}
+
+func (e *etagStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	return &FileInfo{Key: key, ETag: e.etag.Load().(string)}, nil
+}
+
+func TestCachedStorage_Revalidate(t *testing.T) {
+	ctx := context.Background()
+	inner := &etagStorage{countingStorage: countingStorage{localStorage: newTestLocal(t)}}
+	inner.etag.Store("v1")
+	c := WrapWithCache(inner, NewMemoryCache(), CacheOptions{TTL: time.Millisecond, Revalidate: true})
+	inner.Upload(ctx, "a.txt", strings.NewReader("v1"))
+
+	readString(t, c, "a.txt")
+	time.Sleep(5 * time.Millisecond)
+
+	// Expired, but the ETag is unchanged: still served from the cache.
+	readString(t, c, "a.txt")
+	if n := inner.downloads.Load(); n != 1 {
+		t.Errorf("%d downloads, want 1", n)
+	}
+
+	// Changes made behind the cache's back are seen after the TTL.
+	inner.Upload(ctx, "a.txt", strings.NewReader("v2"))
+	inner.etag.Store("v2")
+	time.Sleep(5 * time.Millisecond)
+	if got := readString(t, c, "a.txt"); got != "v2" {
+		t.Errorf("got %q, want v2", got)
+	}
+}
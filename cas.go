@@ -0,0 +1,628 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCASPrefix is where CASStorage keeps blobs and reference counts.
+const DefaultCASPrefix = ".cas/"
+
+// casPointerMax bounds the size of a pointer object; anything larger is
+// treated as a plain (non-deduplicated) file.
+const casPointerMax = 4096
+
+// casPointer is stored at the logical key and references a blob.
+type casPointer struct {
+	Algorithm   string            `json:"cas"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// CASStorage wraps a Storage with content-addressable deduplication.
+//
+// File contents are stored once per SHA-256 digest under the prefix
+// (blobs/<xx>/<digest>), and each logical key holds a small pointer object
+// referencing its blob. A reference count per blob (refs/<digest>) tracks
+// how many keys point to it; the blob is removed when the last one is
+// deleted or overwritten. Files not written through CASStorage are read
+// back unchanged.
+//
+// Reference counts are updated under in-process locks, so a CAS prefix
+// should be written through a single CASStorage. Use Check to find
+// orphaned blobs and drifted counts, and Repair to fix them.
+type CASStorage struct {
+	wrapped
+	prefix string
+	keyMu  [64]sync.Mutex
+	blobMu [64]sync.Mutex
+}
+
+// WrapWithCAS wraps a storage with content-addressable deduplication.
+// prefix defaults to DefaultCASPrefix.
+func WrapWithCAS(s Storage, prefix string) *CASStorage {
+	if prefix == "" {
+		prefix = DefaultCASPrefix
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &CASStorage{wrapped: wrapped{s}, prefix: prefix}
+}
+
+func (c *CASStorage) blobKey(digest string) string {
+	return c.prefix + "blobs/" + digest[:2] + "/" + digest
+}
+
+func (c *CASStorage) refKey(digest string) string {
+	return c.prefix + "refs/" + digest
+}
+
+func (c *CASStorage) internal(key string) bool {
+	return strings.HasPrefix(key, c.prefix)
+}
+
+func (c *CASStorage) lockKey(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &c.keyMu[h.Sum32()%uint32(len(c.keyMu))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (c *CASStorage) lockBlob(digest string) func() {
+	b, _ := hex.DecodeString(digest[:2])
+	mu := &c.blobMu[int(b[0])%len(c.blobMu)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Upload hashes reader and stores its content only if no identical blob
+// exists yet. Headers and the content type of the first upload of a blob
+// apply to it; the content type and metadata are also kept per key.
+func (c *CASStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	if c.internal(key) {
+		return nil, fmt.Errorf("%w: %q is inside the CAS prefix", ErrInvalidKey, key)
+	}
+	options := &UploadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// Spool to a temp file: the digest must be known before the blob key.
+	tmp, err := os.CreateTemp("", "storage-cas-*")
+	if err != nil {
+		return nil, fmt.Errorf("storage: cas: failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), reader)
+	if err != nil {
+		return nil, fmt.Errorf("storage: cas: failed to read upload: %w", err)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	contentType := options.ContentType
+	if contentType == "" {
+		contentType = DetectContentType(key)
+	}
+	ptr := &casPointer{
+		Algorithm:   "sha256",
+		Digest:      digest,
+		Size:        size,
+		ContentType: contentType,
+		Metadata:    options.Metadata,
+	}
+
+	unlock := c.lockKey(key)
+	defer unlock()
+
+	old, err := c.pointer(ctx, key)
+	if err != nil && !IsNotFoundError(err) {
+		return nil, err
+	}
+	if old == nil || old.Digest != digest {
+		if err := c.addRef(ctx, digest, tmp, opts); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.writePointer(ctx, key, ptr); err != nil {
+		if old == nil || old.Digest != digest {
+			c.release(ctx, digest)
+		}
+		return nil, err
+	}
+	if old != nil && old.Digest != digest {
+		if err := c.release(ctx, old.Digest); err != nil {
+			return nil, err
+		}
+	}
+
+	url, _ := c.Storage.URL(ctx, c.blobKey(digest))
+	return &UploadResult{
+		Key:      key,
+		URL:      url,
+		Size:     size,
+		ETag:     digest,
+		Metadata: options.Metadata,
+	}, nil
+}
+
+// addRef increments the reference count of a blob, uploading body first if
+// the blob is not stored yet. body may be nil when the blob is known to be
+// referenced already.
+func (c *CASStorage) addRef(ctx context.Context, digest string, body io.ReadSeeker, opts []UploadOption) error {
+	unlock := c.lockBlob(digest)
+	defer unlock()
+
+	count, err := c.refCount(ctx, digest)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		exists, err := c.Storage.Exists(ctx, c.blobKey(digest))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if body == nil {
+				return fmt.Errorf("storage: cas: blob %s: %w", digest, ErrNotFound)
+			}
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := c.Storage.Upload(ctx, c.blobKey(digest), body, opts...); err != nil {
+				return err
+			}
+		}
+	}
+	return c.writeRefCount(ctx, digest, count+1)
+}
+
+// release decrements the reference count of a blob and deletes it when no
+// references remain.
+func (c *CASStorage) release(ctx context.Context, digest string) error {
+	unlock := c.lockBlob(digest)
+	defer unlock()
+
+	count, err := c.refCount(ctx, digest)
+	if err != nil {
+		return err
+	}
+	if count > 1 {
+		return c.writeRefCount(ctx, digest, count-1)
+	}
+	if err := c.Storage.Delete(ctx, c.blobKey(digest)); err != nil && !IsNotFoundError(err) {
+		return err
+	}
+	if err := c.Storage.Delete(ctx, c.refKey(digest)); err != nil && !IsNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *CASStorage) refCount(ctx context.Context, digest string) (int, error) {
+	rc, err := c.Storage.Download(ctx, c.refKey(digest))
+	if err != nil {
+		if IsNotFoundError(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, 32))
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("storage: cas: corrupt reference count for %s: %w", digest, err)
+	}
+	return n, nil
+}
+
+func (c *CASStorage) writeRefCount(ctx context.Context, digest string, n int) error {
+	_, err := c.Storage.Upload(ctx, c.refKey(digest), strings.NewReader(strconv.Itoa(n)),
+		WithContentType("text/plain"))
+	return err
+}
+
+func (c *CASStorage) writePointer(ctx context.Context, key string, ptr *casPointer) error {
+	data, err := json.Marshal(ptr)
+	if err != nil {
+		return err
+	}
+	_, err = c.Storage.Upload(ctx, key, bytes.NewReader(data), WithContentType("application/json"))
+	return err
+}
+
+// pointer returns the pointer stored at key, or nil if key holds a plain file.
+func (c *CASStorage) pointer(ctx context.Context, key string) (*casPointer, error) {
+	ptr, rc, err := c.open(ctx, key)
+	if rc != nil {
+		rc.Close()
+	}
+	return ptr, err
+}
+
+// open downloads key and reports whether it is a pointer. For plain files
+// it returns a reader over the full content instead.
+func (c *CASStorage) open(ctx context.Context, key string) (*casPointer, io.ReadCloser, error) {
+	rc, err := c.Storage.Download(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := io.ReadAll(io.LimitReader(rc, casPointerMax+1))
+	if err != nil {
+		rc.Close()
+		return nil, nil, err
+	}
+	if len(head) <= casPointerMax {
+		if ptr := parsePointer(head); ptr != nil {
+			rc.Close()
+			return ptr, nil, nil
+		}
+	}
+	return nil, &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(head), rc), Closer: rc}, nil
+}
+
+func parsePointer(data []byte) *casPointer {
+	if len(data) == 0 || data[0] != '{' {
+		return nil
+	}
+	var ptr casPointer
+	if err := json.Unmarshal(data, &ptr); err != nil {
+		return nil
+	}
+	if ptr.Algorithm != "sha256" || len(ptr.Digest) != sha256.Size*2 {
+		return nil
+	}
+	if _, err := hex.DecodeString(ptr.Digest); err != nil {
+		return nil
+	}
+	return &ptr
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Download returns the content of the blob referenced by key.
+func (c *CASStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	ptr, rc, err := c.open(ctx, key)
+	if err != nil || ptr == nil {
+		return rc, err
+	}
+	return c.Storage.Download(ctx, c.blobKey(ptr.Digest))
+}
+
+// Delete removes key and releases its blob reference.
+func (c *CASStorage) Delete(ctx context.Context, key string) error {
+	unlock := c.lockKey(key)
+	defer unlock()
+
+	ptr, err := c.pointer(ctx, key)
+	if err != nil && !IsNotFoundError(err) {
+		return err
+	}
+	if err := c.Storage.Delete(ctx, key); err != nil {
+		return err
+	}
+	if ptr != nil {
+		return c.release(ctx, ptr.Digest)
+	}
+	return nil
+}
+
+// URL returns the URL of the blob referenced by key.
+func (c *CASStorage) URL(ctx context.Context, key string) (string, error) {
+	target, err := c.target(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return c.Storage.URL(ctx, target)
+}
+
+// SignedURL returns a signed URL of the blob referenced by key.
+func (c *CASStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	target, err := c.target(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return c.wrapped.SignedURL(ctx, target, expires)
+}
+
+// List lists logical files, hiding the CAS prefix and reporting the size
+// of the referenced content.
+func (c *CASStorage) List(ctx context.Context, prefix string, opts ...ListOption) (*ListResult, error) {
+	result, err := c.wrapped.List(ctx, prefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]FileInfo, 0, len(result.Files))
+	for _, f := range result.Files {
+		if c.internal(f.Key) {
+			continue
+		}
+		if f.Size <= casPointerMax {
+			if ptr, err := c.pointer(ctx, f.Key); err == nil && ptr != nil {
+				f = c.fileInfo(f, ptr)
+			}
+		}
+		files = append(files, f)
+	}
+	return &ListResult{Files: files, NextMarker: result.NextMarker, IsTruncated: result.IsTruncated}, nil
+}
+
+func (c *CASStorage) fileInfo(f FileInfo, ptr *casPointer) FileInfo {
+	f.Size = ptr.Size
+	f.StoredSize = 0
+	f.ContentType = ptr.ContentType
+	f.ETag = ptr.Digest
+	f.Metadata = ptr.Metadata
+	return f
+}
+
+// Copy copies key by adding a reference to its blob; no content is copied.
+func (c *CASStorage) Copy(ctx context.Context, src, dst string) error {
+	if c.internal(dst) {
+		return fmt.Errorf("%w: %q is inside the CAS prefix", ErrInvalidKey, dst)
+	}
+	ptr, err := c.pointer(ctx, src)
+	if err != nil {
+		return err
+	}
+	if ptr == nil {
+		return c.wrapped.Copy(ctx, src, dst)
+	}
+
+	unlock := c.lockKey(dst)
+	defer unlock()
+
+	old, err := c.pointer(ctx, dst)
+	if err != nil && !IsNotFoundError(err) {
+		return err
+	}
+	if old != nil && old.Digest == ptr.Digest {
+		return c.writePointer(ctx, dst, ptr)
+	}
+	if err := c.addRef(ctx, ptr.Digest, nil, nil); err != nil {
+		return err
+	}
+	if err := c.writePointer(ctx, dst, ptr); err != nil {
+		c.release(ctx, ptr.Digest)
+		return err
+	}
+	if old != nil {
+		return c.release(ctx, old.Digest)
+	}
+	return nil
+}
+
+// Move moves key, keeping its blob reference.
+func (c *CASStorage) Move(ctx context.Context, src, dst string) error {
+	if err := c.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+	return c.Delete(ctx, src)
+}
+
+// Size returns the size of the content referenced by key.
+func (c *CASStorage) Size(ctx context.Context, key string) (int64, error) {
+	ptr, err := c.pointer(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if ptr == nil {
+		return c.wrapped.Size(ctx, key)
+	}
+	return ptr.Size, nil
+}
+
+// Metadata returns the file info of key with the content's size, type and
+// digest (as ETag).
+func (c *CASStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	info, err := c.wrapped.Metadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size > casPointerMax {
+		return info, nil
+	}
+	ptr, err := c.pointer(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if ptr == nil {
+		return info, nil
+	}
+	out := c.fileInfo(*info, ptr)
+	return &out, nil
+}
+
+// SetStorageClass changes the storage class of the blob referenced by key,
+// which affects every key sharing it.
+func (c *CASStorage) SetStorageClass(ctx context.Context, key string, class StorageClass) error {
+	target, err := c.target(ctx, key)
+	if err != nil {
+		return err
+	}
+	return c.wrapped.SetStorageClass(ctx, target, class)
+}
+
+// Restore restores the archived blob referenced by key.
+func (c *CASStorage) Restore(ctx context.Context, key string, days int) error {
+	target, err := c.target(ctx, key)
+	if err != nil {
+		return err
+	}
+	return c.wrapped.Restore(ctx, target, days)
+}
+
+// RestoreStatus reports the restore state of the blob referenced by key.
+func (c *CASStorage) RestoreStatus(ctx context.Context, key string) (*RestoreStatus, error) {
+	target, err := c.target(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrapped.RestoreStatus(ctx, target)
+}
+
+// target returns the key holding the content of key: its blob, or key
+// itself for plain files.
+func (c *CASStorage) target(ctx context.Context, key string) (string, error) {
+	ptr, err := c.pointer(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if ptr != nil {
+		return c.blobKey(ptr.Digest), nil
+	}
+	return key, nil
+}
+
+// CASReport is the result of CASStorage.Check.
+type CASReport struct {
+	Blobs      int           // Number of stored blobs
+	Keys       int           // Number of keys referencing a blob
+	Orphans    []string      // Digests of blobs no key references
+	Missing    []string      // Keys whose blob does not exist
+	Mismatched []RefMismatch // Blobs whose stored reference count is wrong
+}
+
+// RefMismatch describes a blob whose stored reference count differs from
+// the number of keys referencing it.
+type RefMismatch struct {
+	Digest string
+	Stored int
+	Actual int
+}
+
+// OK reports whether the check found no problems.
+func (r *CASReport) OK() bool {
+	return len(r.Orphans) == 0 && len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+// Check scans the storage and compares blobs, reference counts and pointers.
+// It requires List support and should run while no writes are in progress,
+// since a concurrent upload can look like an orphan.
+func (c *CASStorage) Check(ctx context.Context) (*CASReport, error) {
+	adv, err := c.advanced()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, err := listAll(ctx, adv, c.prefix+"blobs/")
+	if err != nil {
+		return nil, err
+	}
+	refs, err := listAll(ctx, adv, c.prefix+"refs/")
+	if err != nil {
+		return nil, err
+	}
+	files, err := listAll(ctx, adv, "")
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(blobs))
+	for _, f := range blobs {
+		stored[f.Key[strings.LastIndex(f.Key, "/")+1:]] = true
+	}
+	actual := make(map[string]int)
+	report := &CASReport{Blobs: len(blobs)}
+	for _, f := range files {
+		if c.internal(f.Key) || f.Size > casPointerMax {
+			continue
+		}
+		ptr, err := c.pointer(ctx, f.Key)
+		if err != nil {
+			if IsNotFoundError(err) {
+				continue
+			}
+			return nil, err
+		}
+		if ptr == nil {
+			continue
+		}
+		report.Keys++
+		actual[ptr.Digest]++
+		if !stored[ptr.Digest] {
+			report.Missing = append(report.Missing, f.Key)
+		}
+	}
+
+	counted := make(map[string]bool, len(refs))
+	for _, f := range refs {
+		digest := strings.TrimPrefix(f.Key, c.prefix+"refs/")
+		counted[digest] = true
+		n, err := c.refCount(ctx, digest)
+		if err != nil {
+			return nil, err
+		}
+		if n != actual[digest] {
+			report.Mismatched = append(report.Mismatched, RefMismatch{Digest: digest, Stored: n, Actual: actual[digest]})
+		}
+	}
+	for digest, n := range actual {
+		if !counted[digest] {
+			report.Mismatched = append(report.Mismatched, RefMismatch{Digest: digest, Actual: n})
+		}
+	}
+	for digest := range stored {
+		if actual[digest] == 0 {
+			report.Orphans = append(report.Orphans, digest)
+		}
+	}
+	return report, nil
+}
+
+// Repair deletes the orphaned blobs and rewrites the mismatched reference
+// counts found by Check. Keys with missing blobs are left for the caller.
+func (c *CASStorage) Repair(ctx context.Context, report *CASReport) error {
+	var errs []error
+	for _, digest := range report.Orphans {
+		unlock := c.lockBlob(digest)
+		if err := c.Storage.Delete(ctx, c.blobKey(digest)); err != nil && !IsNotFoundError(err) {
+			errs = append(errs, err)
+		}
+		if err := c.Storage.Delete(ctx, c.refKey(digest)); err != nil && !IsNotFoundError(err) {
+			errs = append(errs, err)
+		}
+		unlock()
+	}
+	for _, m := range report.Mismatched {
+		unlock := c.lockBlob(m.Digest)
+		var err error
+		if m.Actual == 0 {
+			err = c.Storage.Delete(ctx, c.refKey(m.Digest))
+		} else {
+			err = c.writeRefCount(ctx, m.Digest, m.Actual)
+		}
+		if err != nil && !IsNotFoundError(err) {
+			errs = append(errs, err)
+		}
+		unlock()
+	}
+	return errors.Join(errs...)
+}
+
+var _ AdvancedStorage = (*CASStorage)(nil)
+var _ ArchiveStorage = (*CASStorage)(nil)
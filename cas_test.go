@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCASStorage_Dedup(t *testing.T) {
+	local := newTestLocal(t)
+	s := WrapWithCAS(local, "")
+	ctx := context.Background()
+	avatar := strings.Repeat("png", 100)
+
+	for _, key := range []string{"u1/avatar.png", "u2/avatar.png"} {
+		result, err := s.Upload(ctx, key, strings.NewReader(avatar))
+		if err != nil {
+			t.Fatalf("Upload(%s) failed: %v", key, err)
+		}
+		if result.Size != int64(len(avatar)) {
+			t.Errorf("UploadResult.Size = %d, want %d", result.Size, len(avatar))
+		}
+	}
+	s.Copy(ctx, "u1/avatar.png", "u3/avatar.png")
+
+	blobs, _ := local.List(ctx, DefaultCASPrefix+"blobs/")
+	if len(blobs.Files) != 1 {
+		t.Fatalf("Expected 1 blob, got %d", len(blobs.Files))
+	}
+	blob := blobs.Files[0].Key
+
+	rc, err := s.Download(ctx, "u3/avatar.png")
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != avatar {
+		t.Errorf("Downloaded content does not match")
+	}
+
+	info, _ := s.Metadata(ctx, "u2/avatar.png")
+	if info.Size != int64(len(avatar)) || info.ContentType != "image/png" {
+		t.Errorf("Metadata = %+v", info)
+	}
+
+	list, _ := s.List(ctx, "")
+	if len(list.Files) != 3 {
+		t.Errorf("List should hide the CAS prefix, got %+v", list.Files)
+	}
+
+	// The blob survives until its last reference goes.
+	s.Delete(ctx, "u1/avatar.png")
+	s.Move(ctx, "u2/avatar.png", "u4/avatar.png")
+	if ok, _ := local.Exists(ctx, blob); !ok {
+		t.Fatal("Blob deleted while still referenced")
+	}
+	s.Upload(ctx, "u4/avatar.png", strings.NewReader("new avatar"))
+	s.Delete(ctx, "u3/avatar.png")
+	if ok, _ := local.Exists(ctx, blob); ok {
+		t.Error("Blob should be deleted with its last reference")
+	}
+
+	if _, err := s.Upload(ctx, DefaultCASPrefix+"x", strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Upload into the CAS prefix should fail, got %v", err)
+	}
+}
+
+func TestCASStorage_Check(t *testing.T) {
+	local := newTestLocal(t)
+	s := WrapWithCAS(local, "cas")
+	ctx := context.Background()
+
+	s.Upload(ctx, "a.txt", strings.NewReader("same"))
+	s.Upload(ctx, "b.txt", strings.NewReader("same"))
+	s.Upload(ctx, "c.txt", strings.NewReader("lost"))
+	local.Upload(ctx, "plain.txt", strings.NewReader("not deduplicated"))
+
+	report, err := s.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.OK() || report.Blobs != 2 || report.Keys != 3 {
+		t.Fatalf("Unexpected report for a consistent store: %+v", report)
+	}
+
+	// Remove a pointer behind the wrapper's back: its blob becomes orphaned.
+	local.Delete(ctx, "c.txt")
+	report, _ = s.Check(ctx)
+	if len(report.Orphans) != 1 || len(report.Mismatched) != 1 {
+		t.Fatalf("Expected 1 orphan and 1 mismatch, got %+v", report)
+	}
+
+	if err := s.Repair(ctx, report); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if report, _ = s.Check(ctx); !report.OK() || report.Blobs != 1 {
+		t.Errorf("Store should be consistent after Repair, got %+v", report)
+	}
+
+	rc, _ := s.Download(ctx, "plain.txt")
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "not deduplicated" {
+		t.Errorf("Plain files should be read unchanged, got %q", got)
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestChecksumStorage_Verify(t *testing.T) {
+	ctx := context.Background()
+
+	for _, alg := range []ChecksumAlgorithm{ChecksumMD5, ChecksumCRC32C, ChecksumSHA256} {
+		local := newTestLocal(t)
+		s := WrapWithChecksum(local, alg)
+
+		// io.MultiReader is not seekable, so the upload is spooled.
+		if _, err := s.Upload(ctx, "a.txt", io.MultiReader(strings.NewReader("hello world"))); err != nil {
+			t.Fatalf("%s: Upload failed: %v", alg, err)
+		}
+		info, _ := local.Metadata(ctx, "a.txt")
+		want, _ := ComputeChecksum(alg, strings.NewReader("hello world"))
+		if info.Metadata[alg.MetaKey()] != want.Value {
+			t.Errorf("%s: stored checksum = %q, want %q", alg, info.Metadata[alg.MetaKey()], want.Value)
+		}
+
+		rc, _ := s.Download(ctx, "a.txt")
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != "hello world" {
+			t.Errorf("%s: Download = %q, %v", alg, got, err)
+		}
+
+		// Corrupt the stored file: the reader must fail at EOF.
+		os.WriteFile(local.fullPath("a.txt"), []byte("hello w0rld"), 0644)
+		rc, _ = s.Download(ctx, "a.txt")
+		_, err = io.ReadAll(rc)
+		rc.Close()
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("%s: expected ErrChecksumMismatch, got %v", alg, err)
+		}
+	}
+}
+
+func TestChecksumStorage_ProviderRejectsCorruptUpload(t *testing.T) {
+	local := newTestLocal(t)
+	ctx := context.Background()
+
+	sum, _ := ComputeChecksum(ChecksumSHA256, strings.NewReader("expected"))
+	_, err := local.Upload(ctx, "a.txt", strings.NewReader("corrupted"), WithChecksum(sum))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if ok, _ := local.Exists(ctx, "a.txt"); ok {
+		t.Error("Corrupt upload should not be kept")
+	}
+
+	// A rejected overwrite keeps the previous object and its metadata.
+	if _, err := local.Upload(ctx, "a.txt", strings.NewReader("v1"), WithContentType("text/plain")); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if _, err := local.Upload(ctx, "a.txt", strings.NewReader("corrupted"), WithChecksum(sum)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := local.Upload(ctx, "a.txt", iotest.ErrReader(errors.New("read failed"))); err == nil {
+		t.Fatal("expected the read error")
+	}
+	if got := readString(t, local, "a.txt"); got != "v1" {
+		t.Errorf("a.txt = %q after rejected overwrites, want v1", got)
+	}
+	if info, _ := local.Metadata(ctx, "a.txt"); info == nil || info.ContentType != "text/plain" {
+		t.Errorf("Metadata = %+v, want the previous content type", info)
+	}
+	if list, _ := local.List(ctx, ""); len(list.Files) != 1 {
+		t.Errorf("List = %+v, want only a.txt", list.Files)
+	}
+	if entries, _ := os.ReadDir(local.root); len(entries) != 2 { // a.txt and .meta
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+
+	// Wrappers that transform the data must not forward the checksum.
+	s := WrapWithChecksum(WrapWithCompression(local, CodecGzip), ChecksumSHA256)
+	if _, err := s.Upload(ctx, "b.txt", strings.NewReader(strings.Repeat("b", 100))); err != nil {
+		t.Fatalf("Upload through compression failed: %v", err)
+	}
+	rc, _ := s.Download(ctx, "b.txt")
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || len(got) != 100 {
+		t.Errorf("Download = %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DiskSource looks up other disks by name. *Manager implements it.
+type DiskSource interface {
+	Disk(name string) (Storage, error)
+}
+
+// CompositeDriver creates a Storage built on other disks, such as a mirror
+// or a router. Child disks are owned by the Manager: a composite storage
+// must not close them in its Close method.
+type CompositeDriver func(disks DiskSource, cfg map[string]any) (Storage, error)
+
+var composites = make(map[string]CompositeDriver)
+
+// RegisterComposite registers a composite driver. Composite disks are
+// configured like any other disk and reference their children by name:
+//
+//	backup:
+//	  driver: mirror
+//	  disks: [aliyun, minio]
+func RegisterComposite(name string, driver CompositeDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("storage: RegisterComposite driver is nil")
+	}
+	if _, exists := drivers[name]; exists {
+		panic("storage: Register called twice for driver " + name)
+	}
+	if _, exists := composites[name]; exists {
+		panic("storage: RegisterComposite called twice for driver " + name)
+	}
+	composites[name] = driver
+}
+
+func lookupComposite(name string) (CompositeDriver, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	c, ok := composites[name]
+	return c, ok
+}
+
+// chainSource resolves child disks for a composite, rejecting cycles such
+// as a mirror listing itself. The children resolved are recorded in parent
+// so that Reload reopens the composite when a child changes.
+type chainSource struct {
+	m      *Manager
+	chain  []string
+	parent *openDisk
+}
+
+func (c chainSource) Disk(name string) (Storage, error) {
+	if name == "" {
+		name = c.m.Config().Default
+	}
+	for _, n := range c.chain {
+		if n == name {
+			return nil, fmt.Errorf("storage: disk %q references itself (%s -> %s)",
+				name, strings.Join(c.chain, " -> "), name)
+		}
+	}
+	d, err := c.m.disk(name, c.chain)
+	if err != nil {
+		return nil, err
+	}
+	c.parent.children = append(c.parent.children, name)
+	c.parent.childDisks = append(c.parent.childDisks, d)
+	return d.Storage, nil
+}
+
+// stringList reads a list of strings from a config value: a []string, a
+// []any of strings, or a comma-separated string.
+func stringList(v any) ([]string, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return t, nil
+	case string:
+		var out []string
+		for _, s := range strings.Split(t, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out, nil
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of strings, got %T element", item)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expected a list of strings, got %T", v)
+}
+
+// childDisks resolves the named disks of a composite.
+func childDisks(disks DiskSource, names []string) ([]NamedStorage, error) {
+	children := make([]NamedStorage, len(names))
+	for i, name := range names {
+		s, err := disks.Disk(name)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = NamedStorage{Name: name, Storage: s}
+	}
+	return children, nil
+}
+
+// NamedStorage is a child disk of a composite storage.
+type NamedStorage struct {
+	Name string
+	Storage
+}
+
+// mergeListings merges the listings of several disks in key order. A key
+// in several listings is kept once, from the first; keys for which keep
+// (if not nil) returns false are dropped. A truncated listing may hold
+// more keys after its last one, so nothing past that key is returned.
+func mergeListings(results []*ListResult, maxKeys int, keep func(i int, f FileInfo) bool) *ListResult {
+	limit, limited := "", false
+	for _, r := range results {
+		if r.IsTruncated && len(r.Files) > 0 {
+			last := r.Files[len(r.Files)-1].Key
+			if !limited || last < limit {
+				limit, limited = last, true
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var files []FileInfo
+	for i, r := range results {
+		for _, f := range r.Files {
+			if !seen[f.Key] && (!limited || f.Key <= limit) && (keep == nil || keep(i, f)) {
+				seen[f.Key] = true
+				files = append(files, f)
+			}
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+
+	merged := &ListResult{Files: files, IsTruncated: limited}
+	if maxKeys > 0 && len(files) > maxKeys {
+		merged.Files = files[:maxKeys]
+		merged.IsTruncated = true
+	}
+	if merged.IsTruncated {
+		// Every listing was read up to limit, even if keep dropped its keys.
+		merged.NextMarker = limit
+		if len(merged.Files) > 0 {
+			merged.NextMarker = merged.Files[len(merged.Files)-1].Key
+		}
+	}
+	return merged
+}
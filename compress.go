@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Metadata keys written by CompressedStorage.
+const (
+	MetaCompressCodec = "cmp-codec"
+	MetaCompressSize  = "cmp-size"
+)
+
+// Codec compresses and decompresses streams.
+type Codec interface {
+	// Name identifies the codec in object metadata, e.g. "gzip".
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Built-in codecs.
+var (
+	CodecGzip Codec = gzipCodec{level: gzip.DefaultCompression}
+	CodecZstd Codec = zstdCodec{}
+)
+
+var (
+	codecs   = map[string]Codec{}
+	codecsMu sync.RWMutex
+)
+
+// RegisterCodec makes a codec available for decompression by name.
+// The built-in gzip and zstd codecs are registered automatically.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+func lookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+func init() {
+	RegisterCodec(CodecGzip)
+	RegisterCodec(CodecZstd)
+}
+
+type gzipCodec struct {
+	level int
+}
+
+// GzipCodec returns a gzip codec with the given compression level.
+func GzipCodec(level int) Codec {
+	return gzipCodec{level: level}
+}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (c gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// CompressionRule selects a codec for matching uploads.
+// A rule matches when every non-empty condition matches.
+type CompressionRule struct {
+	ContentType string // Exact type, or a prefix ending in "/" or "*", e.g. "text/*"
+	Pattern     string // Key glob, e.g. "logs/**/*.log"
+	Codec       Codec  // nil stores matching files uncompressed
+}
+
+func (r *CompressionRule) match(key, contentType string) bool {
+	if r.Pattern != "" && !matchGlob(r.Pattern, key) {
+		return false
+	}
+	if r.ContentType != "" {
+		prefix := strings.TrimSuffix(r.ContentType, "*")
+		if prefix != r.ContentType || strings.HasSuffix(prefix, "/") {
+			return strings.HasPrefix(contentType, prefix)
+		}
+		return contentType == r.ContentType
+	}
+	return true
+}
+
+// CompressedStorage wraps a Storage with transparent compression.
+//
+// The codec used is recorded in the object metadata, so objects stored
+// without compression (including legacy ones) are read back unchanged.
+// Size and Metadata report the logical (uncompressed) size, and
+// FileInfo.StoredSize the compressed one; List reports stored sizes.
+type CompressedStorage struct {
+	wrapped
+	def   Codec
+	rules []CompressionRule
+}
+
+// WrapWithCompression wraps a storage with compression.
+// The first matching rule picks the codec; def is used when none match
+// (nil = leave unmatched files uncompressed).
+func WrapWithCompression(s Storage, def Codec, rules ...CompressionRule) *CompressedStorage {
+	return &CompressedStorage{wrapped: wrapped{s}, def: def, rules: rules}
+}
+
+func (c *CompressedStorage) codecFor(key, contentType string) Codec {
+	if contentType == "" {
+		contentType = DetectContentType(key)
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mt
+	}
+	for i := range c.rules {
+		if c.rules[i].match(key, contentType) {
+			return c.rules[i].Codec
+		}
+	}
+	return c.def
+}
+
+// Upload compresses reader while streaming it to the wrapped storage. The
+// logical size is stored in the metadata, which is sent before the data,
+// so readers of unknown length are first compressed to a temporary file
+// while counting their bytes.
+func (c *CompressedStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	options := &UploadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	codec := c.codecFor(key, options.ContentType)
+	if codec == nil {
+		return c.Storage.Upload(ctx, key, reader, opts...)
+	}
+
+	meta := make(map[string]string, len(options.Metadata)+2)
+	for k, v := range options.Metadata {
+		meta[k] = v
+	}
+	meta[MetaCompressCodec] = codec.Name()
+
+	size, ok := readerSize(reader)
+	if !ok {
+		tmp, n, err := compressToTemp(codec, reader)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		meta[MetaCompressSize] = strconv.FormatInt(n, 10)
+		result, err := c.Storage.Upload(ctx, key, tmp, append(opts, WithMetadata(meta), withoutChecksum())...)
+		if err != nil {
+			return nil, err
+		}
+		result.Size = n
+		return result, nil
+	}
+	meta[MetaCompressSize] = strconv.FormatInt(size, 10)
+
+	src := &countingReader{r: reader}
+	pr, pw := io.Pipe()
+	go func() {
+		err := compress(codec, pw, src)
+		pw.CloseWithError(err)
+	}()
+
+	result, err := c.Storage.Upload(ctx, key, pr, append(opts, WithMetadata(meta), withoutChecksum())...)
+	// Unblock the compressor if the upload stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return nil, err
+	}
+	result.Size = src.n
+	return result, nil
+}
+
+// compress writes the compressed data of r to w.
+func compress(codec Codec, w io.Writer, r io.Reader) error {
+	zw, err := codec.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(zw, r)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// compressToTemp compresses r to a temporary file and returns it positioned
+// at the start, with the number of uncompressed bytes read from r.
+func compressToTemp(codec Codec, r io.Reader) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "storage-compress-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("storage: failed to create temp file: %w", err)
+	}
+	src := &countingReader{r: r}
+	if err = compress(codec, tmp, src); err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, fmt.Errorf("storage: failed to compress upload: %w", err)
+	}
+	return tmp, src.n, nil
+}
+
+// readerSize returns the remaining size of common sized readers.
+func readerSize(r io.Reader) (int64, bool) {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len()), true
+	case interface{ Size() int64 }:
+		return v.Size(), true
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		pos, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - pos, true
+	}
+	return 0, false
+}
+
+// Download returns a reader that decompresses the object while reading.
+func (c *CompressedStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	info, err := c.wrapped.Metadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := c.Storage.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	name := metaValue(info.Metadata, MetaCompressCodec)
+	if name == "" {
+		return rc, nil
+	}
+	codec, ok := lookupCodec(name)
+	if !ok {
+		rc.Close()
+		return nil, fmt.Errorf("storage: unknown compression codec %q for %q", name, key)
+	}
+	zr, err := codec.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("storage: failed to decompress %q: %w", key, err)
+	}
+	return &compressedReader{ReadCloser: zr, src: rc}, nil
+}
+
+type compressedReader struct {
+	io.ReadCloser
+	src io.Closer
+}
+
+func (r *compressedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if serr := r.src.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// Size returns the logical (uncompressed) size.
+func (c *CompressedStorage) Size(ctx context.Context, key string) (int64, error) {
+	info, err := c.Metadata(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// Metadata returns the file info with the logical size in Size and the
+// compressed size in StoredSize. The logical size is recorded at upload
+// time; for compressed objects without it, which were not written by
+// Upload, it fails rather than decompressing the whole object.
+func (c *CompressedStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	info, err := c.wrapped.Metadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if metaValue(info.Metadata, MetaCompressCodec) == "" {
+		return info, nil
+	}
+
+	out := *info
+	out.StoredSize = info.Size
+	n, err := strconv.ParseInt(metaValue(info.Metadata, MetaCompressSize), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %q has no recorded uncompressed size", key)
+	}
+	out.Size = n
+
+	out.Metadata = make(map[string]string, len(info.Metadata))
+	for k, v := range info.Metadata {
+		switch strings.ToLower(k) {
+		case MetaCompressCodec, MetaCompressSize:
+		default:
+			out.Metadata[k] = v
+		}
+	}
+	return &out, nil
+}
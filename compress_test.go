@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressedStorage_RoundTrip(t *testing.T) {
+	local := newTestLocal(t)
+	s := WrapWithCompression(local, nil,
+		CompressionRule{Pattern: "logs/**/*.log", Codec: CodecZstd},
+		CompressionRule{ContentType: "application/json", Codec: CodecGzip},
+		CompressionRule{ContentType: "text/*", Codec: CodecGzip},
+	)
+	ctx := context.Background()
+	data := strings.Repeat(`{"level":"info","msg":"hello"}`+"\n", 500)
+
+	tests := []struct {
+		key   string
+		opts  []UploadOption
+		codec string
+	}{
+		{"logs/2024/01/app.log", nil, "zstd"},
+		{"export.json", nil, "gzip"},
+		{"notes.bin", []UploadOption{WithContentType("text/plain; charset=utf-8")}, "gzip"},
+		{"photo.bin", nil, ""},
+	}
+
+	for _, tt := range tests {
+		result, err := s.Upload(ctx, tt.key, strings.NewReader(data), tt.opts...)
+		if err != nil {
+			t.Fatalf("Upload(%s) failed: %v", tt.key, err)
+		}
+		if result.Size != int64(len(data)) {
+			t.Errorf("%s: UploadResult.Size = %d, want %d", tt.key, result.Size, len(data))
+		}
+
+		raw, _ := local.Metadata(ctx, tt.key)
+		if got := raw.Metadata[MetaCompressCodec]; got != tt.codec {
+			t.Errorf("%s: codec = %q, want %q", tt.key, got, tt.codec)
+		}
+
+		info, err := s.Metadata(ctx, tt.key)
+		if err != nil {
+			t.Fatalf("Metadata(%s) failed: %v", tt.key, err)
+		}
+		if info.Size != int64(len(data)) {
+			t.Errorf("%s: logical size = %d, want %d", tt.key, info.Size, len(data))
+		}
+		if tt.codec != "" && (info.StoredSize == 0 || info.StoredSize >= info.Size) {
+			t.Errorf("%s: stored size %d should be smaller than %d", tt.key, info.StoredSize, info.Size)
+		}
+
+		rc, err := s.Download(ctx, tt.key)
+		if err != nil {
+			t.Fatalf("Download(%s) failed: %v", tt.key, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(got) != data {
+			t.Errorf("%s: downloaded data does not match", tt.key)
+		}
+	}
+}
+
+func TestCompressedStorage_UnknownSize(t *testing.T) {
+	local := newTestLocal(t)
+	s := WrapWithCompression(local, CodecGzip)
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("abc"), 1000)
+
+	// io.MultiReader hides the length; it is counted while compressing.
+	result, err := s.Upload(ctx, "stream.bin", io.MultiReader(bytes.NewReader(data)))
+	if err != nil || result.Size != int64(len(data)) {
+		t.Fatalf("Upload = %+v, %v", result, err)
+	}
+	info, err := s.Metadata(ctx, "stream.bin")
+	if err != nil || info.Size != int64(len(data)) || info.StoredSize == 0 || info.StoredSize >= info.Size {
+		t.Errorf("Metadata = %+v, %v; want logical size %d and a smaller stored size", info, err, len(data))
+	}
+	if got := readString(t, s, "stream.bin"); got != string(data) {
+		t.Errorf("Download = %d bytes, want %d", len(got), len(data))
+	}
+
+	// A compressed object without a recorded size is an error, not -1.
+	local.Upload(ctx, "foreign.gz", bytes.NewReader([]byte("x")), WithMetadata(map[string]string{MetaCompressCodec: "gzip"}))
+	if size, err := s.Size(ctx, "foreign.gz"); err == nil {
+		t.Errorf("Size = %d, want an error", size)
+	}
+}
@@ -1,5 +1,15 @@
 package storage
 
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Config represents the storage configuration structure.
 type Config struct {
 	Default  string                   `yaml:"default" json:"default"`
@@ -11,3 +21,177 @@ type StorageConfig struct {
 	Driver  string         `yaml:"driver" json:"driver"`
 	Options map[string]any `yaml:"options" json:"options"`
 }
+
+// LoadConfigFile reads a YAML or JSON configuration file. See
+// LoadConfigReader for the format. Errors name the file.
+func LoadConfigFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to open config: %w", err)
+	}
+	defer f.Close()
+	return loadConfig(f, path)
+}
+
+// LoadConfigReader reads a YAML or JSON configuration. The disks may be at
+// the top level or under a "storage" key, as in an application's config
+// file:
+//
+//	storage:
+//	  default: local
+//	  disks:
+//	    aliyun:
+//	      driver: aliyun
+//	      bucket: ${OSS_BUCKET:-assets}
+//	      access_key_id: ${ALIYUN_ACCESS_KEY_ID}
+//
+// ${VAR} is replaced by the environment variable VAR, which must be set;
+// ${VAR:-default} falls back to default when VAR is unset or empty. The
+// result is validated: the default disk must exist and every disk must
+// use a registered driver.
+func LoadConfigReader(r io.Reader) (*Config, error) {
+	return loadConfig(r, "")
+}
+
+func loadConfig(r io.Reader, path string) (*Config, error) {
+	where := "storage: "
+	if path != "" {
+		where += path + ": "
+	}
+
+	var raw map[string]any
+	if err := yaml.NewDecoder(r).Decode(&raw); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s%w", where, err)
+	}
+	if inner, ok := raw["storage"].(map[string]any); ok && raw["disks"] == nil && raw["storages"] == nil {
+		raw = inner
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("%sconfig is empty", where)
+	}
+
+	// parseConfigMap skips malformed disks; a file should not.
+	for _, key := range []string{"disks", "storages"} {
+		disks, _ := raw[key].(map[string]any)
+		for name, disk := range disks {
+			if _, ok := disk.(map[string]any); !ok {
+				return nil, fmt.Errorf("%sdisk %q: expected a map, got %T", where, name, disk)
+			}
+		}
+	}
+	cfg, err := parseConfigMap(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s%s", where, strings.TrimPrefix(err.Error(), "storage: "))
+	}
+
+	if cfg.Default, err = expandEnv(cfg.Default); err != nil {
+		return nil, fmt.Errorf("%sdefault: %w", where, err)
+	}
+	for name, sc := range cfg.Storages {
+		if sc.Driver, err = expandEnv(sc.Driver); err != nil {
+			return nil, fmt.Errorf("%sdisk %q: driver: %w", where, name, err)
+		}
+		for key, v := range sc.Options {
+			if sc.Options[key], err = expandEnvValue(v, key); err != nil {
+				return nil, fmt.Errorf("%sdisk %q: %w", where, name, err)
+			}
+		}
+		cfg.Storages[name] = sc
+	}
+
+	if err := checkConfig(cfg); err != nil {
+		return nil, fmt.Errorf("%s%w", where, err)
+	}
+	return cfg, nil
+}
+
+// checkConfig checks that cfg can be opened: the default disk exists and
+// every driver is registered.
+func checkConfig(cfg *Config) error {
+	if cfg.Default != "" {
+		if _, ok := cfg.Storages[cfg.Default]; !ok {
+			return fmt.Errorf("default disk %q is not configured", cfg.Default)
+		}
+	}
+	names := make([]string, 0, len(cfg.Storages))
+	for name := range cfg.Storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		driver := cfg.Storages[name].Driver
+		driversMu.RLock()
+		_, ok := drivers[driver]
+		_, composite := composites[driver]
+		driversMu.RUnlock()
+		if !ok && !composite {
+			return fmt.Errorf("disk %q: unknown driver %q (forgotten import?)", name, driver)
+		}
+	}
+	return nil
+}
+
+// expandEnvValue expands environment variables in the strings of a
+// decoded config value. path names the value in errors.
+func expandEnvValue(v any, path string) (any, error) {
+	switch t := v.(type) {
+	case string:
+		s, err := expandEnv(t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return s, nil
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, item := range t {
+			expanded, err := expandEnvValue(item, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = expanded
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			expanded, err := expandEnvValue(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = expanded
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} in s. Text that is not a
+// complete ${...} reference is left as is.
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end += start
+		b.WriteString(s[:start])
+
+		name, def, hasDef := strings.Cut(s[start+2:end], ":-")
+		value, set := os.LookupEnv(name)
+		switch {
+		case hasDef && value == "":
+			value = def
+		case !set:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(value)
+		s = s[end+1:]
+	}
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupFromFile(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("UPLOAD_ROOT", root)
+	t.Setenv("EMPTY_VAR", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+app:
+  name: demo
+storage:
+  default: local
+  disks:
+    local:
+      driver: local
+      root: ${UPLOAD_ROOT}
+      base_url: ${BASE_URL:-http://localhost:8080}/files
+    unopened:
+      driver: local
+      note: ${EMPTY_VAR:-fallback}
+      tags: ["${UPLOAD_ROOT}", plain, $NOT_EXPANDED]
+`), 0644)
+
+	if err := SetupFromFile(path); err != nil {
+		t.Fatalf("SetupFromFile failed: %v", err)
+	}
+	if _, err := PutString("a.txt", "a"); err != nil {
+		t.Fatalf("PutString failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Errorf("File not written under the expanded root: %v", err)
+	}
+
+	cfg, _ := LoadConfigFile(path)
+	if url := cfg.Storages["local"].Options["base_url"]; url != "http://localhost:8080/files" {
+		t.Errorf("base_url = %v", url)
+	}
+	opts := cfg.Storages["unopened"].Options
+	if opts["note"] != "fallback" {
+		t.Errorf("Default not applied for an empty variable: %v", opts)
+	}
+	if tags := opts["tags"].([]any); tags[0] != root || tags[2] != "$NOT_EXPANDED" {
+		t.Errorf("tags = %v", tags)
+	}
+}
+
+func TestSetupFromReader_JSON(t *testing.T) {
+	t.Setenv("UPLOAD_ROOT", t.TempDir())
+	err := SetupFromReader(strings.NewReader(`{
+		"default": "local",
+		"disks": {"local": {"driver": "local", "root": "${UPLOAD_ROOT}", "rate_limit": {"ops_per_second": 10}}}
+	}`))
+	if err != nil {
+		t.Fatalf("SetupFromReader failed: %v", err)
+	}
+	if _, err := PutString("a.txt", "a"); err != nil {
+		t.Errorf("PutString failed: %v", err)
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.yaml")
+	tests := []struct {
+		name, config string
+		want         []string
+	}{
+		{"unset variable", "disks:\n  oss:\n    driver: local\n    sse: {kms_key_id: '${MISSING_KMS_KEY}'}\n",
+			[]string{path, `disk "oss"`, "sse.kms_key_id", "MISSING_KMS_KEY is not set"}},
+		{"unknown driver", "disks:\n  cos:\n    driver: tencnet\n",
+			[]string{path, `disk "cos"`, `unknown driver "tencnet"`}},
+		{"missing driver", "disks:\n  cos:\n    bucket: b\n",
+			[]string{path, `disk "cos"`, "driver"}},
+		{"not a map", "disks:\n  cos: tencent\n",
+			[]string{path, `disk "cos"`, "expected a map"}},
+		{"default", "default: s3\ndisks:\n  local:\n    driver: local\n",
+			[]string{path, `default disk "s3"`}},
+		{"syntax", "disks:\n  local: [\n",
+			[]string{path, "yaml"}},
+	}
+	for _, tt := range tests {
+		os.WriteFile(path, []byte(tt.config), 0644)
+		_, err := LoadConfigFile(path)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.name, err, want)
+			}
+		}
+	}
+}
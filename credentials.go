@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials are the access keys a cloud driver signs requests with.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string    // Set for temporary credentials, e.g. from STS
+	Expires         time.Time // Zero if the credentials do not expire
+}
+
+// Expired reports whether the credentials expire within window.
+func (c *Credentials) Expired(window time.Duration) bool {
+	return !c.Expires.IsZero() && time.Until(c.Expires) <= window
+}
+
+// CredentialsProvider supplies credentials to a driver, for disks that
+// outlive their credentials such as STS tokens that expire hourly. Drivers
+// ask the provider again before the credentials they hold expire, so a
+// disk keeps working without being reopened.
+//
+// Providers are registered by name and selected with the
+// credentials_provider disk option:
+//
+//	storage.RegisterCredentialsProvider("oss-sts", storage.NewCachedCredentials(
+//	    storage.CredentialsProviderFunc(assumeRole), 5*time.Minute))
+//
+//	aliyun:
+//	  driver: aliyun
+//	  credentials_provider: oss-sts
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (*Credentials, error)
+}
+
+// CredentialsProviderFunc adapts a function to a CredentialsProvider.
+type CredentialsProviderFunc func(ctx context.Context) (*Credentials, error)
+
+func (f CredentialsProviderFunc) Retrieve(ctx context.Context) (*Credentials, error) {
+	return f(ctx)
+}
+
+var (
+	credentialsProviders   = make(map[string]CredentialsProvider)
+	credentialsProvidersMu sync.RWMutex
+)
+
+// RegisterCredentialsProvider registers a provider for the
+// credentials_provider disk option, replacing any previous one. Register
+// it before the disks using it are opened.
+func RegisterCredentialsProvider(name string, p CredentialsProvider) {
+	credentialsProvidersMu.Lock()
+	defer credentialsProvidersMu.Unlock()
+	if p == nil {
+		delete(credentialsProviders, name)
+		return
+	}
+	credentialsProviders[name] = p
+}
+
+// LookupCredentialsProvider returns a provider registered with
+// RegisterCredentialsProvider. Drivers use it for the
+// credentials_provider option.
+func LookupCredentialsProvider(name string) (CredentialsProvider, error) {
+	credentialsProvidersMu.RLock()
+	defer credentialsProvidersMu.RUnlock()
+	p, ok := credentialsProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown credentials provider %q", name)
+	}
+	return p, nil
+}
+
+// CachedCredentials caches the credentials of a provider and renews them
+// when they are about to expire. Concurrent callers share one renewal. If
+// renewing fails while the cached credentials are still valid, they are
+// returned and renewal is retried on a later call.
+type CachedCredentials struct {
+	provider CredentialsProvider
+	window   time.Duration
+
+	// keep is how long credentials that could not be renewed are kept after
+	// they expire, for credentials whose expiry is only a refresh interval.
+	keep time.Duration
+
+	mu       sync.Mutex
+	creds    *Credentials
+	renewing chan struct{} // Closed when the renewal in progress ends
+	err      error         // Result of the last renewal
+}
+
+// NewCachedCredentials returns a cache for p that renews credentials
+// window before they expire (default one minute).
+func NewCachedCredentials(p CredentialsProvider, window time.Duration) *CachedCredentials {
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &CachedCredentials{provider: p, window: window}
+}
+
+func (c *CachedCredentials) Retrieve(ctx context.Context) (*Credentials, error) {
+	c.mu.Lock()
+	for {
+		if c.creds != nil && !c.creds.Expired(c.window) {
+			creds := c.creds
+			c.mu.Unlock()
+			return creds, nil
+		}
+		if c.renewing == nil {
+			break
+		}
+		// Another caller is renewing; wait for it.
+		done := c.renewing
+		c.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+		if c.err != nil {
+			return c.fallback()
+		}
+	}
+	c.renewing = make(chan struct{})
+	c.mu.Unlock()
+
+	creds, err := c.provider.Retrieve(ctx)
+	if err == nil && creds == nil {
+		err = errors.New("provider returned no credentials")
+	}
+
+	c.mu.Lock()
+	close(c.renewing)
+	c.renewing = nil
+	c.err = err
+	if err != nil {
+		return c.fallback()
+	}
+	c.creds = creds
+	c.mu.Unlock()
+	return creds, nil
+}
+
+// fallback returns the cached credentials after a failed renewal if they
+// have not expired yet, or if c keeps them, for another keep interval.
+// c.mu must be held; it is released.
+func (c *CachedCredentials) fallback() (*Credentials, error) {
+	defer c.mu.Unlock()
+	if c.creds != nil && !c.creds.Expired(0) {
+		defaultLogger.Warn("credentials: renewal failed, using the current credentials until they expire: %v", c.err)
+		return c.creds, nil
+	}
+	if c.creds != nil && c.keep > 0 {
+		defaultLogger.Warn("credentials: renewal failed, keeping the current credentials for %s: %v", c.keep, c.err)
+		creds := *c.creds
+		creds.Expires = time.Now().Add(c.keep)
+		c.creds = &creds
+		return c.creds, nil
+	}
+	return nil, fmt.Errorf("storage: failed to retrieve credentials: %w", c.err)
+}
+
+// CacheCredentials wraps p in a CachedCredentials with the default window
+// unless it already is one. Drivers that call the provider on every request
+// use it, so a provider that does not cache is not asked for every request
+// and is asked again before the credentials expire.
+func CacheCredentials(p CredentialsProvider) CredentialsProvider {
+	if _, ok := p.(*CachedCredentials); ok {
+		return p
+	}
+	return NewCachedCredentials(p, 0)
+}
+
+// Invalidate drops the cached credentials, e.g. after the backend rejected
+// them, so the next call renews them.
+func (c *CachedCredentials) Invalidate() {
+	c.mu.Lock()
+	c.creds = nil
+	c.mu.Unlock()
+}
+
+// NewSecretCredentials returns a provider that resolves credentials from
+// secret references (see SecretResolver) and resolves them again every
+// refresh interval, for credentials rotated in place by a secrets manager:
+//
+//	storage.NewSecretCredentials("secret://oss-ak", "secret://oss-sk", "secret://oss-token", 15*time.Minute)
+//
+// sessionToken may be empty. If resolving the secrets again fails, the
+// current credentials are kept and resolving is retried after another
+// refresh interval.
+func NewSecretCredentials(accessKeyID, secretAccessKey, sessionToken string, refresh time.Duration) *CachedCredentials {
+	resolve := func(ctx context.Context) (*Credentials, error) {
+		var creds Credentials
+		for _, f := range []struct {
+			ref string
+			dst *string
+		}{
+			{accessKeyID, &creds.AccessKeyID},
+			{secretAccessKey, &creds.SecretAccessKey},
+			{sessionToken, &creds.SessionToken},
+		} {
+			v, err := ResolveSecret(ctx, f.ref)
+			if err != nil {
+				return nil, err
+			}
+			*f.dst = v
+		}
+		if refresh > 0 {
+			creds.Expires = time.Now().Add(refresh)
+		}
+		return &creds, nil
+	}
+	c := NewCachedCredentials(CredentialsProviderFunc(resolve), time.Nanosecond)
+	c.keep = refresh
+	return c
+}
+
+// StaticCredentials returns a provider of fixed credentials.
+func StaticCredentials(accessKeyID, secretAccessKey, sessionToken string) CredentialsProvider {
+	creds := &Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, SessionToken: sessionToken}
+	return CredentialsProviderFunc(func(ctx context.Context) (*Credentials, error) {
+		return creds, nil
+	})
+}
+
+// UploadCredentials are temporary credentials that only allow uploading
+// keys under Prefix, for browsers and apps that upload directly to the
+// bucket with the provider's SDK.
+type UploadCredentials struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expires         time.Time `json:"expires"`
+	Bucket          string    `json:"bucket"`
+	Region          string    `json:"region,omitempty"`
+	Endpoint        string    `json:"endpoint,omitempty"`
+	Prefix          string    `json:"prefix"` // Full key prefix in the bucket
+}
+
+// UploadCredentialsIssuer is implemented by storages that can issue
+// UploadCredentials, such as the OSS and COS drivers through STS.
+type UploadCredentialsIssuer interface {
+	UploadCredentials(ctx context.Context, prefix string, ttl time.Duration) (*UploadCredentials, error)
+}
+
+// IssueUploadCredentials issues temporary credentials for uploading keys
+// under prefix directly to the bucket of s. The credentials bypass s, so
+// only ScopedStorage forwards the call (adding its prefix); for other
+// wrappers, such as encryption or validation, it fails with
+// ErrNotImplemented.
+func IssueUploadCredentials(ctx context.Context, s Storage, prefix string, ttl time.Duration) (*UploadCredentials, error) {
+	issuer, ok := s.(UploadCredentialsIssuer)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	if err := ValidateUploadPrefix(prefix); err != nil {
+		return nil, err
+	}
+	return issuer.UploadCredentials(ctx, prefix, ttl)
+}
+
+// ValidateUploadPrefix checks a prefix for UploadCredentials before it is
+// put into a bucket policy as "prefix*". The prefix must be a non-empty
+// directory such as "users/42/": an empty one would grant the whole bucket,
+// "users/4" would also grant "users/42/", and wildcards would widen the
+// policy. Drivers issuing upload credentials call it.
+func ValidateUploadPrefix(prefix string) error {
+	switch {
+	case prefix == "" || prefix == "/":
+		return fmt.Errorf("%w: empty upload prefix", ErrInvalidKey)
+	case !strings.HasSuffix(prefix, "/"):
+		return fmt.Errorf("%w: upload prefix %q must end in \"/\"", ErrInvalidKey, prefix)
+	case strings.ContainsAny(prefix, "*?[]$"):
+		return fmt.Errorf("%w: upload prefix %q contains a wildcard", ErrInvalidKey, prefix)
+	case escapesScope(prefix):
+		return fmt.Errorf("%w: upload prefix %q", ErrInvalidKey, prefix)
+	}
+	return nil
+}
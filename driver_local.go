@@ -2,31 +2,52 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
 func init() {
 	// Local driver is built-in, no need to import separately
 	Register("local", newLocalStorage)
+	RegisterSchema("local", localConfig{})
 }
 
+// localMetaDir holds sidecar files with the HTTP headers and custom metadata
+// given at upload time. It lives under root and is hidden from List.
+const localMetaDir = ".meta"
+
 // localStorage implements Storage for local filesystem.
+// It also implements http.Handler to serve files with their stored headers.
 type localStorage struct {
 	root    string
 	baseURL string
 	perm    os.FileMode
 }
 
+// localConfig holds the local driver options.
+type localConfig struct {
+	Root    string      `option:"root,required"`
+	BaseURL string      `option:"base_url"`
+	Perm    os.FileMode `option:"perm" default:"0644"`
+}
+
 func newLocalStorage(cfg map[string]any) (Storage, error) {
-	root, _ := cfg["root"].(string)
-	if root == "" {
-		return nil, fmt.Errorf("local: 'root' is required")
+	var c localConfig
+	if err := DecodeOptions(cfg, &c); err != nil {
+		return nil, fmt.Errorf("local: %w", err)
 	}
+	root := c.Root
 
 	// Expand ~ to home directory
 	if len(root) > 0 && root[0] == '~' {
@@ -42,17 +63,10 @@ func newLocalStorage(cfg map[string]any) (Storage, error) {
 		return nil, fmt.Errorf("local: failed to create root directory: %w", err)
 	}
 
-	baseURL, _ := cfg["base_url"].(string)
-
-	perm := os.FileMode(0644)
-	if p, ok := cfg["perm"].(int); ok {
-		perm = os.FileMode(p)
-	}
-
 	return &localStorage{
 		root:    root,
-		baseURL: baseURL,
-		perm:    perm,
+		baseURL: c.BaseURL,
+		perm:    c.Perm,
 	}, nil
 }
 
@@ -60,23 +74,129 @@ func (l *localStorage) fullPath(key string) string {
 	return filepath.Join(l.root, filepath.Clean(key))
 }
 
+// localMeta is the sidecar record stored next to each uploaded file.
+type localMeta struct {
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentLanguage    string            `json:"content_language,omitempty"`
+	Expires            time.Time         `json:"expires,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+func (m *localMeta) empty() bool {
+	return m.ContentType == "" && m.ContentDisposition == "" && m.CacheControl == "" &&
+		m.ContentEncoding == "" && m.ContentLanguage == "" && m.Expires.IsZero() && len(m.Metadata) == 0
+}
+
+func (l *localStorage) metaPath(key string) string {
+	return filepath.Join(l.root, localMetaDir, filepath.Clean(key)+".json")
+}
+
+func (l *localStorage) readMeta(key string) (*localMeta, error) {
+	data, err := os.ReadFile(l.metaPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &localMeta{}, nil
+		}
+		return nil, fmt.Errorf("local: failed to read metadata: %w", err)
+	}
+	m := &localMeta{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("local: failed to decode metadata: %w", err)
+	}
+	return m, nil
+}
+
+func (l *localStorage) writeMeta(key string, m *localMeta) error {
+	path := l.metaPath(key)
+	if m.empty() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("local: failed to remove metadata: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("local: failed to encode metadata: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("local: failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, l.perm); err != nil {
+		return fmt.Errorf("local: failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// localTempSuffix marks the temporary files of uploads in progress, which
+// List skips.
+const localTempSuffix = ".tmp-"
+
 func (l *localStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	options := &UploadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	path := l.fullPath(key)
 
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return nil, fmt.Errorf("local: failed to create directory: %w", err)
 	}
 
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, l.perm)
+	// Write to a temporary file next to the target and rename it into place
+	// once the data is complete and verified, so that a failed or rejected
+	// upload leaves the previous object untouched.
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+localTempSuffix+"*")
 	if err != nil {
 		return nil, fmt.Errorf("local: failed to create file: %w", err)
 	}
-	defer f.Close()
+	tmp := f.Name()
+	defer func() {
+		f.Close()
+		os.Remove(tmp) // No-op once renamed
+	}()
+
+	var w io.Writer = f
+	var h hash.Hash
+	if options.Checksum != nil {
+		if h, err = options.Checksum.Algorithm.NewHash(); err != nil {
+			return nil, err
+		}
+		w = io.MultiWriter(f, h)
+	}
 
-	size, err := io.Copy(f, reader)
+	size, err := io.Copy(w, reader)
 	if err != nil {
 		return nil, fmt.Errorf("local: failed to write file: %w", err)
 	}
+	if h != nil && base64.StdEncoding.EncodeToString(h.Sum(nil)) != options.Checksum.Value {
+		return nil, fmt.Errorf("local: %w: %q", ErrChecksumMismatch, key)
+	}
+	if err := f.Chmod(l.perm); err != nil {
+		return nil, fmt.Errorf("local: failed to write file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("local: failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("local: failed to write file: %w", err)
+	}
+
+	meta := &localMeta{
+		ContentType:        options.ContentType,
+		ContentDisposition: options.ContentDisposition,
+		CacheControl:       options.CacheControl,
+		ContentEncoding:    options.ContentEncoding,
+		ContentLanguage:    options.ContentLanguage,
+		Expires:            options.Expires,
+		Metadata:           options.Metadata,
+	}
+	if err := l.writeMeta(key, meta); err != nil {
+		return nil, err
+	}
 
 	result := &UploadResult{Key: key, Size: size}
 	if l.baseURL != "" {
@@ -106,6 +226,9 @@ func (l *localStorage) Delete(ctx context.Context, key string) error {
 		}
 		return fmt.Errorf("local: failed to delete file: %w", err)
 	}
+	if err := os.Remove(l.metaPath(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("local: failed to delete metadata: %w", err)
+	}
 	return nil
 }
 
@@ -121,6 +244,18 @@ func (l *localStorage) Exists(ctx context.Context, key string) (bool, error) {
 	return false, fmt.Errorf("local: failed to check file: %w", err)
 }
 
+// Ping checks that the root directory is still there.
+func (l *localStorage) Ping(ctx context.Context) error {
+	fi, err := os.Stat(l.root)
+	if err != nil {
+		return fmt.Errorf("local: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("local: %s is not a directory", l.root)
+	}
+	return nil
+}
+
 func (l *localStorage) URL(ctx context.Context, key string) (string, error) {
 	if l.baseURL == "" {
 		return "", fmt.Errorf("local: base_url not configured")
@@ -145,6 +280,7 @@ func (l *localStorage) List(ctx context.Context, prefix string, opts ...ListOpti
 	}
 
 	searchPath := l.fullPath(prefix)
+	metaRoot := filepath.Join(l.root, localMetaDir)
 	var files []FileInfo
 
 	err := filepath.Walk(searchPath, func(path string, info os.FileInfo, err error) error {
@@ -155,19 +291,25 @@ func (l *localStorage) List(ctx context.Context, prefix string, opts ...ListOpti
 			return err
 		}
 		if info.IsDir() {
+			if path == metaRoot {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
+		if name := info.Name(); strings.HasPrefix(name, ".") && strings.Contains(name, localTempSuffix) {
+			return nil
+		}
 		relPath, _ := filepath.Rel(l.root, path)
+		key := filepath.ToSlash(relPath)
+		if key <= options.Marker {
+			return nil
+		}
 		files = append(files, FileInfo{
-			Key:          filepath.ToSlash(relPath),
+			Key:          key,
 			Size:         info.Size(),
 			LastModified: info.ModTime(),
 		})
-
-		if len(files) >= options.MaxKeys {
-			return filepath.SkipAll
-		}
 		return nil
 	})
 
@@ -175,10 +317,16 @@ func (l *localStorage) List(ctx context.Context, prefix string, opts ...ListOpti
 		return nil, fmt.Errorf("local: list failed: %w", err)
 	}
 
-	return &ListResult{
-		Files:       files,
-		IsTruncated: len(files) >= options.MaxKeys,
-	}, nil
+	// Walk order differs from key order ("a/b" vs "a.txt"), so sort to
+	// make Marker pagination behave like the cloud drivers.
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	result := &ListResult{Files: files}
+	if options.MaxKeys > 0 && len(files) > options.MaxKeys {
+		result.Files = files[:options.MaxKeys]
+		result.IsTruncated = true
+		result.NextMarker = result.Files[len(result.Files)-1].Key
+	}
+	return result, nil
 }
 
 func (l *localStorage) Copy(ctx context.Context, src, dst string) error {
@@ -204,7 +352,12 @@ func (l *localStorage) Copy(ctx context.Context, src, dst string) error {
 	if _, err := io.Copy(dstFile, srcFile); err != nil {
 		return fmt.Errorf("local: copy failed: %w", err)
 	}
-	return nil
+
+	meta, err := l.readMeta(src)
+	if err != nil {
+		return err
+	}
+	return l.writeMeta(dst, meta)
 }
 
 func (l *localStorage) Move(ctx context.Context, src, dst string) error {
@@ -218,6 +371,17 @@ func (l *localStorage) Move(ctx context.Context, src, dst string) error {
 	if err := os.Rename(srcPath, dstPath); err != nil {
 		return fmt.Errorf("local: move failed: %w", err)
 	}
+
+	meta, err := l.readMeta(src)
+	if err != nil {
+		return err
+	}
+	if err := l.writeMeta(dst, meta); err != nil {
+		return err
+	}
+	if err := os.Remove(l.metaPath(src)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("local: failed to remove metadata: %w", err)
+	}
 	return nil
 }
 
@@ -243,13 +407,92 @@ func (l *localStorage) Metadata(ctx context.Context, key string) (*FileInfo, err
 		return nil, fmt.Errorf("local: failed to get metadata: %w", err)
 	}
 
+	meta, err := l.readMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = DetectContentType(key)
+	}
+
 	return &FileInfo{
 		Key:          key,
 		Size:         info.Size(),
 		LastModified: info.ModTime(),
-		ContentType:  DetectContentType(key),
+		ContentType:  contentType,
+		Metadata:     meta.Metadata,
 	}, nil
 }
 
+// ServeHTTP serves files under root, replaying the headers stored at upload time.
+// Mount it below the base_url path, e.g.
+//
+//	s, _ := storage.Disk("local").Storage()
+//	http.Handle("/files/", http.StripPrefix("/files", s.(http.Handler)))
+func (l *localStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Requests that do not go through http.ServeMux are not cleaned, so
+	// refuse ".." and check for the sidecar directory on the cleaned key.
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if key == "" || escapesScope(key) {
+		http.NotFound(w, r)
+		return
+	}
+	key = path.Clean(key)
+	if key == "." || key == localMetaDir || strings.HasPrefix(key, localMetaDir+"/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(l.fullPath(key))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	meta, err := l.readMeta(key)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	if meta.ContentType != "" {
+		h.Set("Content-Type", meta.ContentType)
+	}
+	if meta.ContentDisposition != "" {
+		h.Set("Content-Disposition", meta.ContentDisposition)
+	}
+	if meta.CacheControl != "" {
+		h.Set("Cache-Control", meta.CacheControl)
+	}
+	if meta.ContentEncoding != "" {
+		h.Set("Content-Encoding", meta.ContentEncoding)
+	}
+	if meta.ContentLanguage != "" {
+		h.Set("Content-Language", meta.ContentLanguage)
+	}
+	if !meta.Expires.IsZero() {
+		h.Set("Expires", meta.Expires.UTC().Format(http.TimeFormat))
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
 // Ensure localStorage implements AdvancedStorage
 var _ AdvancedStorage = (*localStorage)(nil)
+var _ http.Handler = (*localStorage)(nil)
+var _ Pinger = (*localStorage)(nil)
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T) *localStorage {
+	t.Helper()
+	s, err := newLocalStorage(map[string]any{"root": t.TempDir()})
+	if err != nil {
+		t.Fatalf("newLocalStorage failed: %v", err)
+	}
+	return s.(*localStorage)
+}
+
+func TestLocalStorage_ServeHTTPHeaders(t *testing.T) {
+	s := newTestLocal(t)
+	ctx := context.Background()
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := s.Upload(ctx, "assets/app.js", strings.NewReader("console.log(1)"),
+		WithContentType("application/javascript"),
+		WithCacheControl("public, max-age=31536000"),
+		WithContentEncoding("gzip"),
+		WithContentLanguage("en-US"),
+		WithExpires(expires),
+	)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/app.js", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	want := map[string]string{
+		"Content-Type":     "application/javascript",
+		"Cache-Control":    "public, max-age=31536000",
+		"Content-Encoding": "gzip",
+		"Content-Language": "en-US",
+		"Expires":          expires.Format(http.TimeFormat),
+	}
+	for k, v := range want {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("Header %s = %q, want %q", k, got, v)
+		}
+	}
+	if rec.Body.String() != "console.log(1)" {
+		t.Errorf("Unexpected body %q", rec.Body.String())
+	}
+}
+
+func TestLocalStorage_ListPages(t *testing.T) {
+	ctx := context.Background()
+	s := newTestLocal(t)
+	// Walk order ("a/b.txt" before "a.txt") differs from key order.
+	keys := []string{"a.txt", "a/b.txt", "b.txt", "c/d/e.txt", "c/f.txt"}
+	for _, key := range keys {
+		s.Upload(ctx, key, strings.NewReader(key))
+	}
+
+	var got []string
+	marker := ""
+	for {
+		page, err := s.List(ctx, "", WithMaxKeys(2), WithMarker(marker))
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, f := range page.Files {
+			got = append(got, f.Key)
+		}
+		if !page.IsTruncated {
+			break
+		}
+		marker = page.NextMarker
+	}
+	if strings.Join(got, ",") != "a.txt,a/b.txt,b.txt,c/d/e.txt,c/f.txt" {
+		t.Errorf("List = %v", got)
+	}
+}
+
+func TestLocalStorage_MetadataSidecar(t *testing.T) {
+	s := newTestLocal(t)
+	ctx := context.Background()
+
+	s.Upload(ctx, "a.txt", strings.NewReader("a"),
+		WithContentType("text/x-custom"),
+		WithMetadata(map[string]string{"owner": "alice"}),
+	)
+
+	if err := s.Move(ctx, "a.txt", "b.txt"); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	info, err := s.Metadata(ctx, "b.txt")
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	if info.ContentType != "text/x-custom" {
+		t.Errorf("Expected stored content type, got %q", info.ContentType)
+	}
+	if info.Metadata["owner"] != "alice" {
+		t.Errorf("Expected metadata to follow the move, got %v", info.Metadata)
+	}
+
+	list, err := s.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list.Files) != 1 || list.Files[0].Key != "b.txt" {
+		t.Errorf("List should only contain b.txt, got %+v", list.Files)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.meta/b.txt.json", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Sidecar files must not be served, got %d", rec.Code)
+	}
+
+	// Unclean paths, as sent to a handler not behind http.ServeMux.
+	for _, p := range []string{"/./.meta/b.txt.json", "/x/../.meta/b.txt.json", "//.meta/b.txt.json", "/../b.txt", "/x/../../b.txt"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = p
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", p, rec.Code)
+		}
+	}
+}
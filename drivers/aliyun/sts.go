@@ -0,0 +1,158 @@
+package aliyun
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	storage "github.com/wdcbot/go-storage"
+)
+
+// uploadActions are the OSS actions granted by UploadCredentials: simple,
+// append and multipart uploads.
+var uploadActions = []string{
+	"oss:PutObject",
+	"oss:AppendObject",
+	"oss:InitiateMultipartUpload",
+	"oss:UploadPart",
+	"oss:CompleteMultipartUpload",
+	"oss:AbortMultipartUpload",
+	"oss:ListParts",
+}
+
+// UploadCredentials issues STS credentials that may only upload keys under
+// prefix, by assuming sts_role_arn with a policy limited to the prefix.
+// ttl is clamped to the 15 minutes to 1 hour STS allows.
+func (a *Aliyun) UploadCredentials(ctx context.Context, prefix string, ttl time.Duration) (*storage.UploadCredentials, error) {
+	if a.config.STSRoleARN == "" {
+		return nil, fmt.Errorf("aliyun: upload credentials require sts_role_arn")
+	}
+	if err := storage.ValidateUploadPrefix(prefix); err != nil {
+		return nil, fmt.Errorf("aliyun: %w", err)
+	}
+	policy, err := json.Marshal(map[string]any{
+		"Version": "1",
+		"Statement": []map[string]any{{
+			"Effect":   "Allow",
+			"Action":   uploadActions,
+			"Resource": []string{fmt.Sprintf("acs:oss:*:*:%s/%s*", a.config.Bucket, prefix)},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	creds, err := a.creds.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("aliyun: %w", err)
+	}
+
+	seconds := int(ttl.Seconds())
+	seconds = max(900, min(seconds, 3600))
+	params := url.Values{
+		"Action":          {"AssumeRole"},
+		"RoleArn":         {a.config.STSRoleARN},
+		"RoleSessionName": {"go-storage-upload"},
+		"DurationSeconds": {fmt.Sprint(seconds)},
+		"Policy":          {string(policy)},
+	}
+	var resp struct {
+		Credentials struct {
+			AccessKeyId     string
+			AccessKeySecret string
+			SecurityToken   string
+			Expiration      time.Time
+		}
+	}
+	if err := a.callSTS(ctx, creds, params, &resp); err != nil {
+		return nil, fmt.Errorf("aliyun: failed to issue upload credentials: %w", err)
+	}
+
+	region := strings.TrimSuffix(strings.SplitN(a.host(), ".", 2)[0], "-internal")
+	return &storage.UploadCredentials{
+		AccessKeyID:     resp.Credentials.AccessKeyId,
+		SecretAccessKey: resp.Credentials.AccessKeySecret,
+		SessionToken:    resp.Credentials.SecurityToken,
+		Expires:         resp.Credentials.Expiration,
+		Bucket:          a.config.Bucket,
+		Region:          region,
+		Endpoint:        a.host(),
+		Prefix:          prefix,
+	}, nil
+}
+
+// host returns the OSS endpoint without a scheme.
+func (a *Aliyun) host() string {
+	host := a.config.Endpoint
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// callSTS makes a signed STS RPC request (signature version 1.0) and
+// decodes the JSON response into out.
+func (a *Aliyun) callSTS(ctx context.Context, creds *storage.Credentials, params url.Values, out any) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	params.Set("Format", "JSON")
+	params.Set("Version", "2015-04-01")
+	params.Set("AccessKeyId", creds.AccessKeyID)
+	params.Set("SignatureMethod", "HMAC-SHA1")
+	params.Set("SignatureVersion", "1.0")
+	params.Set("SignatureNonce", hex.EncodeToString(nonce))
+	params.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	if creds.SessionToken != "" {
+		params.Set("SecurityToken", creds.SessionToken)
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = percentEncode(k) + "=" + percentEncode(params.Get(k))
+	}
+	query := strings.Join(pairs, "&")
+	mac := hmac.New(sha1.New, []byte(creds.SecretAccessKey+"&"))
+	mac.Write([]byte("POST&%2F&" + percentEncode(query)))
+	query += "&Signature=" + percentEncode(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+a.config.STSEndpoint+"/", strings.NewReader(query))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct{ Code, Message string }
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("sts: %s: %s (%s)", resp.Status, e.Message, e.Code)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// percentEncode escapes s as required by the RPC signature.
+func percentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
@@ -7,7 +7,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/qiniu/go-sdk/v7/auth"
@@ -18,6 +19,8 @@ import (
 func init() {
 	gostorage.Register("qiniu", New)
 	gostorage.Register("qn", New)
+	gostorage.RegisterSchema("qiniu", Config{})
+	gostorage.RegisterSchema("qn", Config{})
 }
 
 // Qiniu implements storage.Storage for Qiniu Cloud.
@@ -33,38 +36,20 @@ type Qiniu struct {
 
 // Config for Qiniu storage.
 type Config struct {
-	AccessKey string
-	SecretKey string
-	Bucket    string
-	Domain    string
-	Region    string // z0=华东, z1=华北, z2=华南, na0=北美, as0=东南亚
-	UseHTTPS  bool
-	Private   bool
+	AccessKey string `option:"access_key,required" env:"QINIU_ACCESS_KEY"`
+	SecretKey string `option:"secret_key,required,secret" env:"QINIU_SECRET_KEY"`
+	Bucket    string `option:"bucket,required" env:"QINIU_BUCKET"`
+	Domain    string `option:"domain,required" env:"QINIU_DOMAIN"`
+	Region    string `option:"region"` // z0=华东, z1=华北, z2=华南, na0=北美, as0=东南亚
+	UseHTTPS  bool   `option:"use_https"`
+	Private   bool   `option:"private"`
 }
 
 // New creates a new Qiniu storage instance.
 func New(cfg map[string]any) (gostorage.Storage, error) {
 	c := &Config{}
-
-	c.AccessKey = getString(cfg, "access_key", "QINIU_ACCESS_KEY")
-	c.SecretKey = getString(cfg, "secret_key", "QINIU_SECRET_KEY")
-	c.Bucket = getString(cfg, "bucket", "QINIU_BUCKET")
-	c.Domain = getString(cfg, "domain", "QINIU_DOMAIN")
-	c.Region, _ = cfg["region"].(string)
-	c.UseHTTPS, _ = cfg["use_https"].(bool)
-	c.Private, _ = cfg["private"].(bool)
-
-	if c.AccessKey == "" {
-		return nil, fmt.Errorf("qiniu: access_key is required")
-	}
-	if c.SecretKey == "" {
-		return nil, fmt.Errorf("qiniu: secret_key is required")
-	}
-	if c.Bucket == "" {
-		return nil, fmt.Errorf("qiniu: bucket is required")
-	}
-	if c.Domain == "" {
-		return nil, fmt.Errorf("qiniu: domain is required")
+	if err := gostorage.DecodeOptions(cfg, c); err != nil {
+		return nil, fmt.Errorf("qiniu: %w", err)
 	}
 
 	mac := auth.New(c.AccessKey, c.SecretKey)
@@ -94,18 +79,6 @@ func New(cfg map[string]any) (gostorage.Storage, error) {
 	}, nil
 }
 
-func getString(cfg map[string]any, key string, envKeys ...string) string {
-	if v, ok := cfg[key].(string); ok && v != "" {
-		return v
-	}
-	for _, envKey := range envKeys {
-		if v := os.Getenv(envKey); v != "" {
-			return v
-		}
-	}
-	return ""
-}
-
 func (q *Qiniu) Upload(ctx context.Context, key string, reader io.Reader, opts ...gostorage.UploadOption) (*gostorage.UploadResult, error) {
 	options := &gostorage.UploadOptions{}
 	for _, opt := range opts {
@@ -115,6 +88,13 @@ func (q *Qiniu) Upload(ctx context.Context, key string, reader io.Reader, opts .
 	putPolicy := storage.PutPolicy{
 		Scope: fmt.Sprintf("%s:%s", q.bucket, key),
 	}
+	if options.StorageClass != "" {
+		fileType, err := toFileType(options.StorageClass)
+		if err != nil {
+			return nil, err
+		}
+		putPolicy.FileType = fileType
+	}
 	upToken := putPolicy.UploadToken(q.mac)
 
 	data, err := io.ReadAll(reader)
@@ -123,10 +103,28 @@ func (q *Qiniu) Upload(ctx context.Context, key string, reader io.Reader, opts .
 	}
 
 	ret := storage.PutRet{}
-	putExtra := storage.PutExtra{}
+	putExtra := storage.PutExtra{Params: make(map[string]string)}
 	if options.ContentType != "" {
 		putExtra.MimeType = options.ContentType
 	}
+	for k, v := range options.Metadata {
+		putExtra.Params["x-qn-meta-"+k] = v
+	}
+	// Kodo has no per-object HTTP header fields; keep them as metadata so
+	// they are not lost and can be applied by the CDN configuration.
+	for k, v := range map[string]string{
+		"content-disposition": options.ContentDisposition,
+		"cache-control":       options.CacheControl,
+		"content-encoding":    options.ContentEncoding,
+		"content-language":    options.ContentLanguage,
+	} {
+		if v != "" {
+			putExtra.Params["x-qn-meta-"+k] = v
+		}
+	}
+	if !options.Expires.IsZero() {
+		putExtra.Params["x-qn-meta-expires"] = options.Expires.UTC().Format(http.TimeFormat)
+	}
 
 	err = q.uploader.Put(ctx, &ret, upToken, key, bytes.NewReader(data), int64(len(data)), &putExtra)
 	if err != nil {
@@ -196,6 +194,14 @@ func (q *Qiniu) Close() error {
 	return nil
 }
 
+// Ping checks that the bucket is reachable with the configured credentials.
+func (q *Qiniu) Ping(ctx context.Context) error {
+	if _, err := q.bucketMgr.GetBucketInfo(q.bucket); err != nil {
+		return fmt.Errorf("qiniu: ping failed: %w", err)
+	}
+	return nil
+}
+
 // --- AdvancedStorage ---
 
 func (q *Qiniu) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
@@ -221,6 +227,7 @@ func (q *Qiniu) List(ctx context.Context, prefix string, opts ...gostorage.ListO
 			Size:         entry.Fsize,
 			LastModified: time.Unix(entry.PutTime/1e7, 0),
 			ContentType:  entry.MimeType,
+			StorageClass: fromFileType(entry.Type),
 		})
 	}
 
@@ -267,7 +274,91 @@ func (q *Qiniu) Metadata(ctx context.Context, key string) (*gostorage.FileInfo,
 		LastModified: time.Unix(info.PutTime/1e7, 0),
 		ContentType:  info.MimeType,
 		ETag:         info.Hash,
+		StorageClass: fromFileType(info.Type),
+		Metadata:     userMetadata(info.MetaData),
+	}, nil
+}
+
+// userMetadata returns x-qn-meta-* values keyed without the prefix.
+func userMetadata(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(meta))
+	for k, v := range meta {
+		m[strings.TrimPrefix(strings.ToLower(k), "x-qn-meta-")] = v
+	}
+	return m
+}
+
+// --- ArchiveStorage ---
+
+// toFileType maps a storage class to a Kodo file type:
+// 0=standard, 1=infrequent access, 2=archive, 3=deep archive. Other classes
+// must be a Kodo file type number; anything else is an error rather than
+// silently falling back to standard.
+func toFileType(c gostorage.StorageClass) (int, error) {
+	switch c {
+	case gostorage.StorageClassStandard:
+		return 0, nil
+	case gostorage.StorageClassInfrequentAccess:
+		return 1, nil
+	case gostorage.StorageClassArchive:
+		return 2, nil
+	case gostorage.StorageClassColdArchive:
+		return 3, nil
+	}
+	n, err := strconv.Atoi(string(c))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("qiniu: unsupported storage class %q", c)
+	}
+	return n, nil
+}
+
+func fromFileType(t int) gostorage.StorageClass {
+	switch t {
+	case 0:
+		return gostorage.StorageClassStandard
+	case 1:
+		return gostorage.StorageClassInfrequentAccess
+	case 2:
+		return gostorage.StorageClassArchive
+	case 3:
+		return gostorage.StorageClassColdArchive
+	}
+	return gostorage.StorageClass(strconv.Itoa(t))
+}
+
+func (q *Qiniu) SetStorageClass(ctx context.Context, key string, class gostorage.StorageClass) error {
+	fileType, err := toFileType(class)
+	if err != nil {
+		return err
+	}
+	if err := q.bucketMgr.ChangeType(q.bucket, key, fileType); err != nil {
+		return fmt.Errorf("qiniu: failed to change storage class: %w", err)
+	}
+	return nil
+}
+
+func (q *Qiniu) Restore(ctx context.Context, key string, days int) error {
+	if err := q.bucketMgr.RestoreAr(q.bucket, key, days); err != nil {
+		return fmt.Errorf("qiniu: restore failed: %w", err)
+	}
+	return nil
+}
+
+func (q *Qiniu) RestoreStatus(ctx context.Context, key string) (*gostorage.RestoreStatus, error) {
+	info, err := q.bucketMgr.Stat(q.bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("qiniu: failed to get restore status: %w", err)
+	}
+	// RestoreStatus: 1=restoring, 2=restored. Kodo does not report the expiry.
+	return &gostorage.RestoreStatus{
+		Ongoing:  info.RestoreStatus == 1,
+		Restored: info.RestoreStatus == 2,
 	}, nil
 }
 
 var _ gostorage.AdvancedStorage = (*Qiniu)(nil)
+var _ gostorage.ArchiveStorage = (*Qiniu)(nil)
+var _ gostorage.Pinger = (*Qiniu)(nil)
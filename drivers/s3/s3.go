@@ -6,7 +6,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -21,54 +20,61 @@ func init() {
 	storage.Register("s3", New)
 	storage.Register("minio", New)
 	storage.Register("aws", New)
+	for _, name := range []string{"s3", "minio", "aws"} {
+		storage.RegisterSchema(name, Config{})
+	}
 }
 
 // S3 implements storage.Storage for AWS S3 and compatible services.
 type S3 struct {
-	client   *s3.Client
-	presign  *s3.PresignClient
-	cfg      *Config
+	client  *s3.Client
+	presign *s3.PresignClient
+	cfg     *Config
 }
 
 // Config for S3 storage.
 type Config struct {
-	Region          string
-	Bucket          string
-	AccessKeyID     string
-	SecretAccessKey string
-	Endpoint        string // Custom endpoint for MinIO, etc.
-	ForcePathStyle  bool   // Use path-style URLs (required for MinIO)
-	Domain          string // Custom domain for URLs
+	Region          string                        `option:"region" env:"AWS_REGION,S3_REGION" default:"us-east-1"`
+	Bucket          string                        `option:"bucket,required" env:"AWS_S3_BUCKET,S3_BUCKET"`
+	AccessKeyID     string                        `option:"access_key_id" env:"AWS_ACCESS_KEY_ID,S3_ACCESS_KEY_ID"`
+	SecretAccessKey string                        `option:"secret_access_key,secret" env:"AWS_SECRET_ACCESS_KEY,S3_SECRET_ACCESS_KEY"`
+	SessionToken    string                        `option:"session_token,secret" env:"AWS_SESSION_TOKEN"`
+	Endpoint        string                        `option:"endpoint"`         // Custom endpoint for MinIO, etc.
+	ForcePathStyle  bool                          `option:"force_path_style"` // Use path-style URLs (required for MinIO)
+	Domain          string                        `option:"domain"`           // Custom domain for URLs
+	SSE             *storage.ServerSideEncryption `option:"sse"`              // Default server-side encryption
+
+	// Name of a provider registered with storage.RegisterCredentialsProvider,
+	// asked for new credentials before the current ones expire.
+	CredentialsProvider string `option:"credentials_provider"`
 }
 
 // New creates a new S3 storage instance.
 func New(cfg map[string]any) (storage.Storage, error) {
 	c := &Config{}
-
-	c.Region = getString(cfg, "region", "AWS_REGION", "S3_REGION")
-	c.Bucket = getString(cfg, "bucket", "AWS_S3_BUCKET", "S3_BUCKET")
-	c.AccessKeyID = getString(cfg, "access_key_id", "AWS_ACCESS_KEY_ID", "S3_ACCESS_KEY_ID")
-	c.SecretAccessKey = getString(cfg, "secret_access_key", "AWS_SECRET_ACCESS_KEY", "S3_SECRET_ACCESS_KEY")
-	c.Endpoint, _ = cfg["endpoint"].(string)
-	c.ForcePathStyle, _ = cfg["force_path_style"].(bool)
-	c.Domain, _ = cfg["domain"].(string)
-
-	if c.Region == "" {
-		c.Region = "us-east-1"
-	}
-	if c.Bucket == "" {
-		return nil, fmt.Errorf("s3: bucket is required")
+	if err := storage.DecodeOptions(cfg, c); err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
 	}
 
 	ctx := context.Background()
 	var awsCfg aws.Config
 	var err error
 
-	if c.AccessKeyID != "" && c.SecretAccessKey != "" {
+	if c.CredentialsProvider != "" {
+		var p storage.CredentialsProvider
+		p, err = storage.LookupCredentialsProvider(c.CredentialsProvider)
+		if err != nil {
+			return nil, fmt.Errorf("s3: %w", err)
+		}
+		awsCfg, err = config.LoadDefaultConfig(ctx,
+			config.WithRegion(c.Region),
+			config.WithCredentialsProvider(aws.NewCredentialsCache(credentialsAdapter{p})),
+		)
+	} else if c.AccessKeyID != "" && c.SecretAccessKey != "" {
 		awsCfg, err = config.LoadDefaultConfig(ctx,
 			config.WithRegion(c.Region),
 			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-				c.AccessKeyID, c.SecretAccessKey, "",
+				c.AccessKeyID, c.SecretAccessKey, c.SessionToken,
 			)),
 		)
 	} else {
@@ -100,16 +106,52 @@ func New(cfg map[string]any) (storage.Storage, error) {
 	}, nil
 }
 
-func getString(cfg map[string]any, key string, envKeys ...string) string {
-	if v, ok := cfg[key].(string); ok && v != "" {
-		return v
+// sse returns the encryption settings for a request: the context overrides the disk default.
+func (s *S3) sse(ctx context.Context) *storage.ServerSideEncryption {
+	return storage.SSEFromContext(ctx, s.cfg.SSE)
+}
+
+// sseCustomer returns the SSE-C request fields, or nils if sse is not SSE-C.
+func sseCustomer(sse *storage.ServerSideEncryption) (algorithm, key, keyMD5 *string) {
+	if sse == nil || sse.Type != storage.SSECustomer {
+		return nil, nil, nil
+	}
+	return aws.String("AES256"), aws.String(sse.CustomerKeyBase64()), aws.String(sse.CustomerKeyMD5Base64())
+}
+
+func (s *S3) headInput(ctx context.Context, key string) *s3.HeadObjectInput {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomer(s.sse(ctx))
+	return input
+}
+
+// copyInput builds a copy request that reads and writes with the same encryption settings.
+func (s *S3) copyInput(ctx context.Context, src, dst string) *s3.CopyObjectInput {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(s.cfg.Bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(fmt.Sprintf("%s/%s", s.cfg.Bucket, src)),
 	}
-	for _, envKey := range envKeys {
-		if v := os.Getenv(envKey); v != "" {
-			return v
+	sse := s.sse(ctx)
+	if sse == nil {
+		return input
+	}
+	switch sse.Type {
+	case storage.SSEManaged:
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAes256
+	case storage.SSEKMS:
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		if sse.KMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(sse.KMSKeyID)
 		}
+	case storage.SSECustomer:
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomer(sse)
+		input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = sseCustomer(sse)
 	}
-	return ""
+	return input
 }
 
 func (s *S3) Upload(ctx context.Context, key string, reader io.Reader, opts ...storage.UploadOption) (*storage.UploadResult, error) {
@@ -130,12 +172,56 @@ func (s *S3) Upload(ctx context.Context, key string, reader io.Reader, opts ...s
 	if options.ContentDisposition != "" {
 		input.ContentDisposition = aws.String(options.ContentDisposition)
 	}
+	if options.CacheControl != "" {
+		input.CacheControl = aws.String(options.CacheControl)
+	}
+	if options.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(options.ContentEncoding)
+	}
+	if options.ContentLanguage != "" {
+		input.ContentLanguage = aws.String(options.ContentLanguage)
+	}
+	if !options.Expires.IsZero() {
+		input.Expires = aws.Time(options.Expires)
+	}
+	if options.StorageClass != "" {
+		input.StorageClass = s3types.StorageClass(toS3Class(options.StorageClass))
+	}
 	if options.ACL != "" {
 		input.ACL = s3types.ObjectCannedACL(options.ACL)
 	}
+	sse := options.SSE
+	if sse == nil {
+		sse = s.sse(ctx)
+	}
+	if sse != nil {
+		switch sse.Type {
+		case storage.SSEManaged:
+			input.ServerSideEncryption = s3types.ServerSideEncryptionAes256
+		case storage.SSEKMS:
+			input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+			if sse.KMSKeyID != "" {
+				input.SSEKMSKeyId = aws.String(sse.KMSKeyID)
+			}
+		case storage.SSECustomer:
+			input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomer(sse)
+		}
+	}
 	if len(options.Metadata) > 0 {
 		input.Metadata = options.Metadata
 	}
+	if c := options.Checksum; c != nil {
+		switch c.Algorithm {
+		case storage.ChecksumMD5:
+			input.ContentMD5 = aws.String(c.Value)
+		case storage.ChecksumCRC32C:
+			input.ChecksumAlgorithm = s3types.ChecksumAlgorithmCrc32c
+			input.ChecksumCRC32C = aws.String(c.Value)
+		case storage.ChecksumSHA256:
+			input.ChecksumAlgorithm = s3types.ChecksumAlgorithmSha256
+			input.ChecksumSHA256 = aws.String(c.Value)
+		}
+	}
 
 	resp, err := s.client.PutObject(ctx, input)
 	if err != nil {
@@ -154,10 +240,12 @@ func (s *S3) Upload(ctx context.Context, key string, reader io.Reader, opts ...s
 }
 
 func (s *S3) Download(ctx context.Context, key string) (io.ReadCloser, error) {
-	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.cfg.Bucket),
 		Key:    aws.String(key),
-	})
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomer(s.sse(ctx))
+	resp, err := s.client.GetObject(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("s3: download failed: %w", err)
 	}
@@ -176,10 +264,7 @@ func (s *S3) Delete(ctx context.Context, key string) error {
 }
 
 func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
-	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(s.cfg.Bucket),
-		Key:    aws.String(key),
-	})
+	_, err := s.client.HeadObject(ctx, s.headInput(ctx, key))
 	if err != nil {
 		return false, nil // Assume not found
 	}
@@ -203,6 +288,14 @@ func (s *S3) Close() error {
 	return nil
 }
 
+// Ping checks that the bucket is reachable with the configured credentials.
+func (s *S3) Ping(ctx context.Context) error {
+	if _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.cfg.Bucket)}); err != nil {
+		return fmt.Errorf("s3: ping failed: %w", err)
+	}
+	return nil
+}
+
 // --- AdvancedStorage ---
 
 func (s *S3) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
@@ -246,27 +339,31 @@ func (s *S3) List(ctx context.Context, prefix string, opts ...storage.ListOption
 			Size:         *obj.Size,
 			LastModified: *obj.LastModified,
 			ETag:         *obj.ETag,
+			StorageClass: fromS3Class(string(obj.StorageClass)),
 		})
 	}
 
+	// Marker is sent as StartAfter, which takes a key, so the next page
+	// starts after the last key rather than at the continuation token.
 	var nextMarker string
-	if resp.NextContinuationToken != nil {
-		nextMarker = *resp.NextContinuationToken
+	if aws.ToBool(resp.IsTruncated) {
+		if len(files) > 0 {
+			nextMarker = files[len(files)-1].Key
+		}
+		if n := len(resp.CommonPrefixes); n > 0 && aws.ToString(resp.CommonPrefixes[n-1].Prefix) > nextMarker {
+			nextMarker = aws.ToString(resp.CommonPrefixes[n-1].Prefix)
+		}
 	}
 
 	return &storage.ListResult{
 		Files:       files,
 		NextMarker:  nextMarker,
-		IsTruncated: *resp.IsTruncated,
+		IsTruncated: aws.ToBool(resp.IsTruncated),
 	}, nil
 }
 
 func (s *S3) Copy(ctx context.Context, src, dst string) error {
-	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
-		Bucket:     aws.String(s.cfg.Bucket),
-		Key:        aws.String(dst),
-		CopySource: aws.String(fmt.Sprintf("%s/%s", s.cfg.Bucket, src)),
-	})
+	_, err := s.client.CopyObject(ctx, s.copyInput(ctx, src, dst))
 	if err != nil {
 		return fmt.Errorf("s3: copy failed: %w", err)
 	}
@@ -281,10 +378,7 @@ func (s *S3) Move(ctx context.Context, src, dst string) error {
 }
 
 func (s *S3) Size(ctx context.Context, key string) (int64, error) {
-	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(s.cfg.Bucket),
-		Key:    aws.String(key),
-	})
+	resp, err := s.client.HeadObject(ctx, s.headInput(ctx, key))
 	if err != nil {
 		return 0, fmt.Errorf("s3: failed to get size: %w", err)
 	}
@@ -292,10 +386,7 @@ func (s *S3) Size(ctx context.Context, key string) (int64, error) {
 }
 
 func (s *S3) Metadata(ctx context.Context, key string) (*storage.FileInfo, error) {
-	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(s.cfg.Bucket),
-		Key:    aws.String(key),
-	})
+	resp, err := s.client.HeadObject(ctx, s.headInput(ctx, key))
 	if err != nil {
 		return nil, fmt.Errorf("s3: failed to get metadata: %w", err)
 	}
@@ -313,8 +404,105 @@ func (s *S3) Metadata(ctx context.Context, key string) (*storage.FileInfo, error
 	if resp.LastModified != nil {
 		info.LastModified = *resp.LastModified
 	}
+	info.StorageClass = fromS3Class(string(resp.StorageClass))
+	if len(resp.Metadata) > 0 {
+		info.Metadata = resp.Metadata
+	}
 
 	return info, nil
 }
 
+// --- ArchiveStorage ---
+
+func toS3Class(c storage.StorageClass) string {
+	switch c {
+	case storage.StorageClassStandard:
+		return "STANDARD"
+	case storage.StorageClassInfrequentAccess:
+		return "STANDARD_IA"
+	case storage.StorageClassArchive:
+		return "GLACIER"
+	case storage.StorageClassColdArchive:
+		return "DEEP_ARCHIVE"
+	}
+	return string(c)
+}
+
+func fromS3Class(c string) storage.StorageClass {
+	switch c {
+	case "", "STANDARD":
+		return storage.StorageClassStandard
+	case "STANDARD_IA", "ONEZONE_IA":
+		return storage.StorageClassInfrequentAccess
+	case "GLACIER", "GLACIER_IR":
+		return storage.StorageClassArchive
+	case "DEEP_ARCHIVE":
+		return storage.StorageClassColdArchive
+	}
+	return storage.StorageClass(c)
+}
+
+// SetStorageClass changes the storage class by copying the object onto itself.
+func (s *S3) SetStorageClass(ctx context.Context, key string, class storage.StorageClass) error {
+	input := s.copyInput(ctx, key, key)
+	input.StorageClass = s3types.StorageClass(toS3Class(class))
+	input.MetadataDirective = s3types.MetadataDirectiveCopy
+	_, err := s.client.CopyObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("s3: failed to change storage class: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) Restore(ctx context.Context, key string, days int) error {
+	_, err := s.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &s3types.RestoreRequest{
+			Days: aws.Int32(int32(days)),
+			GlacierJobParameters: &s3types.GlacierJobParameters{
+				Tier: s3types.TierStandard,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("s3: restore failed: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) RestoreStatus(ctx context.Context, key string) (*storage.RestoreStatus, error) {
+	resp, err := s.client.HeadObject(ctx, s.headInput(ctx, key))
+	if err != nil {
+		return nil, fmt.Errorf("s3: failed to get restore status: %w", err)
+	}
+	if resp.Restore == nil {
+		return &storage.RestoreStatus{}, nil
+	}
+	return storage.ParseRestoreHeader(*resp.Restore), nil
+}
+
 var _ storage.AdvancedStorage = (*S3)(nil)
+var _ storage.ArchiveStorage = (*S3)(nil)
+var _ storage.Pinger = (*S3)(nil)
+
+// credentialsAdapter lets the AWS SDK retrieve credentials from a
+// storage.CredentialsProvider. The SDK caches them until they expire.
+type credentialsAdapter struct {
+	p storage.CredentialsProvider
+}
+
+func (a credentialsAdapter) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	c, err := a.p.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	return aws.Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		CanExpire:       !c.Expires.IsZero(),
+		Expires:         c.Expires,
+		Source:          "storage.CredentialsProvider",
+	}, nil
+}
@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	storage "github.com/wdcbot/go-storage"
+)
+
+// fakeBucket answers ListObjectsV2 requests for keys, honoring start-after
+// and max-keys and returning an opaque continuation token like S3 does.
+func fakeBucket(t *testing.T, keys []string) *httptest.Server {
+	sort.Strings(keys)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("list-type") != "2" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if q.Get("continuation-token") != "" {
+			t.Errorf("Unexpected continuation token %q", q.Get("continuation-token"))
+		}
+		max, _ := strconv.Atoi(q.Get("max-keys"))
+		type object struct {
+			Key          string
+			Size         int64
+			LastModified string
+			ETag         string
+		}
+		var page struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			IsTruncated           bool
+			NextContinuationToken string `xml:",omitempty"`
+			Contents              []object
+		}
+		for _, key := range keys {
+			if key <= q.Get("start-after") {
+				continue
+			}
+			if len(page.Contents) == max {
+				page.IsTruncated = true
+				page.NextContinuationToken = fmt.Sprintf("token-%d", len(keys))
+				break
+			}
+			page.Contents = append(page.Contents, object{key, 1, "2024-01-01T00:00:00Z", `"etag"`})
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(page)
+	}))
+}
+
+func TestList_MarkerRoundTrips(t *testing.T) {
+	var keys []string
+	for i := 0; i < 25; i++ {
+		keys = append(keys, fmt.Sprintf("k%02d", i))
+	}
+	srv := fakeBucket(t, keys)
+	defer srv.Close()
+
+	s, err := New(map[string]any{
+		"bucket":            "bucket",
+		"endpoint":          srv.URL,
+		"force_path_style":  true,
+		"access_key_id":     "ak",
+		"secret_access_key": "sk",
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var got []string
+	marker := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("Listing does not end")
+		}
+		page, err := s.(*S3).List(context.Background(), "", storage.WithMaxKeys(10), storage.WithMarker(marker))
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, f := range page.Files {
+			got = append(got, f.Key)
+		}
+		if !page.IsTruncated {
+			break
+		}
+		marker = page.NextMarker
+	}
+	if strings.Join(got, ",") != strings.Join(keys, ",") {
+		t.Errorf("Listed %v, want %v", got, keys)
+	}
+}
@@ -0,0 +1,159 @@
+package tencent
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	storage "github.com/wdcbot/go-storage"
+)
+
+// uploadActions are the COS actions granted by UploadCredentials: simple,
+// form and multipart uploads.
+var uploadActions = []string{
+	"name/cos:PutObject",
+	"name/cos:PostObject",
+	"name/cos:InitiateMultipartUpload",
+	"name/cos:ListMultipartUploads",
+	"name/cos:ListParts",
+	"name/cos:UploadPart",
+	"name/cos:CompleteMultipartUpload",
+	"name/cos:AbortMultipartUpload",
+}
+
+// UploadCredentials issues federation credentials (STS GetFederationToken)
+// that may only upload keys under prefix. ttl defaults to 30 minutes and
+// is capped at the 2 hours STS allows.
+func (t *Tencent) UploadCredentials(ctx context.Context, prefix string, ttl time.Duration) (*storage.UploadCredentials, error) {
+	if err := storage.ValidateUploadPrefix(prefix); err != nil {
+		return nil, fmt.Errorf("tencent: %w", err)
+	}
+	// Bucket names end with the APPID, e.g. examplebucket-1250000000.
+	i := strings.LastIndex(t.config.Bucket, "-")
+	if i < 0 {
+		return nil, fmt.Errorf("tencent: bucket %q has no APPID suffix", t.config.Bucket)
+	}
+	appID := t.config.Bucket[i+1:]
+	policy, err := json.Marshal(map[string]any{
+		"version": "2.0",
+		"statement": []map[string]any{{
+			"effect":   "allow",
+			"action":   uploadActions,
+			"resource": []string{fmt.Sprintf("qcs::cos:%s:uid/%s:%s/%s*", t.config.Region, appID, t.config.Bucket, prefix)},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	creds, err := t.creds.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tencent: %w", err)
+	}
+
+	seconds := int(ttl.Seconds())
+	if seconds <= 0 {
+		seconds = 1800
+	}
+	seconds = min(seconds, 7200)
+	var resp struct {
+		Response struct {
+			Credentials struct {
+				Token        string
+				TmpSecretId  string
+				TmpSecretKey string
+			}
+			ExpiredTime int64
+			Error       *struct{ Code, Message string }
+		}
+	}
+	err = t.callSTS(ctx, creds, "GetFederationToken", map[string]any{
+		"Name":            "go-storage-upload",
+		"Policy":          url.QueryEscape(string(policy)),
+		"DurationSeconds": seconds,
+	}, &resp)
+	if err == nil && resp.Response.Error != nil {
+		err = fmt.Errorf("sts: %s (%s)", resp.Response.Error.Message, resp.Response.Error.Code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tencent: failed to issue upload credentials: %w", err)
+	}
+
+	return &storage.UploadCredentials{
+		AccessKeyID:     resp.Response.Credentials.TmpSecretId,
+		SecretAccessKey: resp.Response.Credentials.TmpSecretKey,
+		SessionToken:    resp.Response.Credentials.Token,
+		Expires:         time.Unix(resp.Response.ExpiredTime, 0),
+		Bucket:          t.config.Bucket,
+		Region:          t.config.Region,
+		Prefix:          prefix,
+	}, nil
+}
+
+// callSTS makes a TC3-HMAC-SHA256 signed STS API request and decodes the
+// JSON response into out.
+func (t *Tencent) callSTS(ctx context.Context, creds *storage.Credentials, action string, params map[string]any, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	host := t.config.STSEndpoint
+	now := time.Now().UTC()
+	date := now.Format("2006-01-02")
+	const contentType = "application/json; charset=utf-8"
+
+	canonical := strings.Join([]string{
+		http.MethodPost, "/", "",
+		"content-type:" + contentType + "\nhost:" + host + "\n",
+		"content-type;host",
+		sha256Hex(body),
+	}, "\n")
+	scope := date + "/sts/tc3_request"
+	stringToSign := strings.Join([]string{"TC3-HMAC-SHA256", fmt.Sprint(now.Unix()), scope, sha256Hex([]byte(canonical))}, "\n")
+	key := hmacSHA256([]byte("TC3"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, "sts")
+	key = hmacSHA256(key, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host, Signature=%s",
+		creds.AccessKeyID, scope, signature))
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", "2018-08-13")
+	req.Header.Set("X-TC-Region", t.config.Region)
+	req.Header.Set("X-TC-Timestamp", fmt.Sprint(now.Unix()))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-TC-Token", creds.SessionToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sts: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
@@ -4,10 +4,12 @@ package tencent
 import (
 	"context"
 	"fmt"
+	"hash/crc64"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tencentyun/cos-go-sdk-v5"
@@ -17,95 +19,208 @@ import (
 func init() {
 	storage.Register("tencent", New)
 	storage.Register("cos", New)
+	storage.RegisterSchema("tencent", Config{})
+	storage.RegisterSchema("cos", Config{})
 }
 
 // Tencent implements storage.Storage for Tencent Cloud COS.
 type Tencent struct {
 	client *cos.Client
 	config *Config
+	creds  storage.CredentialsProvider
 }
 
 // Config for Tencent COS.
 type Config struct {
-	SecretID  string
-	SecretKey string
-	Region    string
-	Bucket    string
-	Domain    string
+	SecretID     string                        `option:"secret_id" env:"TENCENT_SECRET_ID,COS_SECRET_ID"`
+	SecretKey    string                        `option:"secret_key,secret" env:"TENCENT_SECRET_KEY,COS_SECRET_KEY"`
+	SessionToken string                        `option:"session_token,secret" env:"TENCENT_SESSION_TOKEN,COS_SESSION_TOKEN"`
+	Region       string                        `option:"region,required" env:"TENCENT_COS_REGION,COS_REGION"`
+	Bucket       string                        `option:"bucket,required" env:"TENCENT_COS_BUCKET,COS_BUCKET"`
+	Domain       string                        `option:"domain"`
+	SSE          *storage.ServerSideEncryption `option:"sse"` // Default server-side encryption
+
+	// Name of a provider registered with storage.RegisterCredentialsProvider,
+	// used instead of the secret id and key above. Its credentials are cached and
+	// renewed before they expire.
+	CredentialsProvider string `option:"credentials_provider"`
+
+	// STS endpoint for issuing upload credentials.
+	STSEndpoint string `option:"sts_endpoint" default:"sts.tencentcloudapi.com"`
 }
 
 // New creates a new Tencent COS storage instance.
 func New(cfg map[string]any) (storage.Storage, error) {
 	c := &Config{}
-
-	c.SecretID = getString(cfg, "secret_id", "TENCENT_SECRET_ID", "COS_SECRET_ID")
-	c.SecretKey = getString(cfg, "secret_key", "TENCENT_SECRET_KEY", "COS_SECRET_KEY")
-	c.Region = getString(cfg, "region", "TENCENT_COS_REGION", "COS_REGION")
-	c.Bucket = getString(cfg, "bucket", "TENCENT_COS_BUCKET", "COS_BUCKET")
-	c.Domain, _ = cfg["domain"].(string)
-
-	if c.SecretID == "" {
-		return nil, fmt.Errorf("tencent: secret_id is required")
-	}
-	if c.SecretKey == "" {
-		return nil, fmt.Errorf("tencent: secret_key is required")
-	}
-	if c.Region == "" {
-		return nil, fmt.Errorf("tencent: region is required")
-	}
-	if c.Bucket == "" {
-		return nil, fmt.Errorf("tencent: bucket is required")
+	if err := storage.DecodeOptions(cfg, c); err != nil {
+		return nil, fmt.Errorf("tencent: %w", err)
 	}
 
 	bucketURL, _ := url.Parse(fmt.Sprintf("https://%s.cos.%s.myqcloud.com", c.Bucket, c.Region))
 
+	var creds storage.CredentialsProvider
+	switch {
+	case c.CredentialsProvider != "":
+		p, err := storage.LookupCredentialsProvider(c.CredentialsProvider)
+		if err != nil {
+			return nil, fmt.Errorf("tencent: %w", err)
+		}
+		p = storage.CacheCredentials(p)
+		creds = p
+	case c.SecretID != "" && c.SecretKey != "":
+		creds = storage.StaticCredentials(c.SecretID, c.SecretKey, c.SessionToken)
+	default:
+		return nil, fmt.Errorf("tencent: secret_id and secret_key are required unless credentials_provider is set")
+	}
+
 	client := cos.NewClient(&cos.BaseURL{BucketURL: bucketURL}, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  c.SecretID,
-			SecretKey: c.SecretKey,
-		},
+		Transport: &credentialsTransport{creds: creds},
 	})
 
 	return &Tencent{
 		client: client,
 		config: c,
+		creds:  creds,
 	}, nil
 }
 
-func getString(cfg map[string]any, key string, envKeys ...string) string {
-	if v, ok := cfg[key].(string); ok && v != "" {
-		return v
+// credentialsTransport signs each request with the current credentials of
+// a storage.CredentialsProvider.
+type credentialsTransport struct {
+	creds storage.CredentialsProvider
+}
+
+func (t *credentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c, err := t.creds.Retrieve(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("tencent: %w", err)
 	}
-	for _, envKey := range envKeys {
-		if v := os.Getenv(envKey); v != "" {
-			return v
-		}
+	req = req.Clone(req.Context())
+	cos.AddAuthorizationHeader(c.AccessKeyID, c.SecretAccessKey, c.SessionToken, req, cos.NewAuthTime(time.Hour))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// sse returns the encryption settings for a request: the context overrides the disk default.
+func (t *Tencent) sse(ctx context.Context) *storage.ServerSideEncryption {
+	return storage.SSEFromContext(ctx, t.config.SSE)
+}
+
+// sseMode returns the x-cos-server-side-encryption value for writes.
+func sseMode(sse *storage.ServerSideEncryption) string {
+	if sse == nil {
+		return ""
+	}
+	switch sse.Type {
+	case storage.SSEManaged:
+		return "AES256"
+	case storage.SSEKMS:
+		return "cos/kms"
 	}
 	return ""
 }
 
+// addKMSKeyID sets the KMS key header, which the SDK has no field for.
+func addKMSKeyID(h **http.Header, sse *storage.ServerSideEncryption) {
+	if sse == nil || sse.Type != storage.SSEKMS || sse.KMSKeyID == "" {
+		return
+	}
+	if *h == nil {
+		*h = &http.Header{}
+	}
+	(*h).Set("x-cos-server-side-encryption-cos-kms-key-id", sse.KMSKeyID)
+}
+
+// sseCustomer returns the SSE-C header values, or empty strings if sse is not SSE-C.
+func sseCustomer(sse *storage.ServerSideEncryption) (algorithm, key, keyMD5 string) {
+	if sse == nil || sse.Type != storage.SSECustomer {
+		return "", "", ""
+	}
+	return "AES256", sse.CustomerKeyBase64(), sse.CustomerKeyMD5Base64()
+}
+
+func (t *Tencent) headOptions(ctx context.Context) *cos.ObjectHeadOptions {
+	opt := &cos.ObjectHeadOptions{}
+	opt.XCosSSECustomerAglo, opt.XCosSSECustomerKey, opt.XCosSSECustomerKeyMD5 = sseCustomer(t.sse(ctx))
+	return opt
+}
+
+// copyOptions returns options that decrypt the SSE-C source and encrypt the destination.
+func (t *Tencent) copyOptions(ctx context.Context) *cos.ObjectCopyOptions {
+	sse := t.sse(ctx)
+	header := &cos.ObjectCopyHeaderOptions{XCosServerSideEncryption: sseMode(sse)}
+	addKMSKeyID(&header.XOptionHeader, sse)
+	header.XCosSSECustomerAglo, header.XCosSSECustomerKey, header.XCosSSECustomerKeyMD5 = sseCustomer(sse)
+	header.XCosCopySourceSSECustomerAglo, header.XCosCopySourceSSECustomerKey, header.XCosCopySourceSSECustomerKeyMD5 = sseCustomer(sse)
+	return &cos.ObjectCopyOptions{ObjectCopyHeaderOptions: header}
+}
+
 func (t *Tencent) Upload(ctx context.Context, key string, reader io.Reader, opts ...storage.UploadOption) (*storage.UploadResult, error) {
 	options := &storage.UploadOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
 
-	putOpt := &cos.ObjectPutOptions{}
-	if options.ContentType != "" || options.ACL != "" {
-		putOpt.ObjectPutHeaderOptions = &cos.ObjectPutHeaderOptions{}
-		if options.ContentType != "" {
-			putOpt.ObjectPutHeaderOptions.ContentType = options.ContentType
+	header := &cos.ObjectPutHeaderOptions{
+		ContentType:        options.ContentType,
+		ContentDisposition: options.ContentDisposition,
+		CacheControl:       options.CacheControl,
+		ContentEncoding:    options.ContentEncoding,
+	}
+	if options.StorageClass != "" {
+		header.XCosStorageClass = toCOSClass(options.StorageClass)
+	}
+	// COS takes MD5 as Content-MD5 and no other checksum header. For every
+	// algorithm the CRC64 that COS computed over the received bytes is
+	// compared with our own, so a corrupted upload is always caught.
+	var crc func() uint64
+	if c := options.Checksum; c != nil {
+		if c.Algorithm == storage.ChecksumMD5 {
+			header.ContentMD5 = c.Value
 		}
-		if options.ACL != "" {
-			putOpt.ObjectPutHeaderOptions.XCosACL = options.ACL
+		var err error
+		if reader, crc, err = crc64Reader(reader); err != nil {
+			return nil, fmt.Errorf("tencent: upload failed: %w", err)
 		}
 	}
+	sse := options.SSE
+	if sse == nil {
+		sse = t.sse(ctx)
+	}
+	header.XCosServerSideEncryption = sseMode(sse)
+	header.XCosSSECustomerAglo, header.XCosSSECustomerKey, header.XCosSSECustomerKeyMD5 = sseCustomer(sse)
+	addKMSKeyID(&header.XOptionHeader, sse)
+	if !options.Expires.IsZero() {
+		header.Expires = options.Expires.UTC().Format(http.TimeFormat)
+	}
+	if options.ContentLanguage != "" {
+		if header.XOptionHeader == nil {
+			header.XOptionHeader = &http.Header{}
+		}
+		header.XOptionHeader.Set("Content-Language", options.ContentLanguage)
+	}
+	if len(options.Metadata) > 0 {
+		header.XCosMetaXXX = &http.Header{}
+		for k, v := range options.Metadata {
+			header.XCosMetaXXX.Set("x-cos-meta-"+k, v)
+		}
+	}
+
+	putOpt := &cos.ObjectPutOptions{ObjectPutHeaderOptions: header}
+	if options.ACL != "" {
+		putOpt.ACLHeaderOptions = &cos.ACLHeaderOptions{XCosACL: options.ACL}
+	}
 
 	resp, err := t.client.Object.Put(ctx, key, reader, putOpt)
 	if err != nil {
 		return nil, fmt.Errorf("tencent: upload failed: %w", err)
 	}
 	defer resp.Body.Close()
+	if crc != nil {
+		if err := checkCRC64(key, resp.Header.Get(cosCRC64Header), crc()); err != nil {
+			t.client.Object.Delete(ctx, key)
+			return nil, err
+		}
+	}
 
 	result := &storage.UploadResult{
 		Key:  key,
@@ -118,8 +233,47 @@ func (t *Tencent) Upload(ctx context.Context, key string, reader io.Reader, opts
 	return result, nil
 }
 
+// cosCRC64Header carries the CRC64-ECMA that COS computed for an upload.
+const cosCRC64Header = "x-cos-hash-crc64ecma"
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// crc64Reader returns a reader over the same data as r and a function
+// returning the CRC64-ECMA of the data once it has been read. Seekable
+// readers are hashed up front and returned unchanged, so the SDK still
+// sees their length.
+func crc64Reader(r io.Reader) (io.Reader, func() uint64, error) {
+	h := crc64.New(crc64Table)
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if start, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			if _, err := io.Copy(h, rs); err != nil {
+				return nil, nil, err
+			}
+			if _, err := rs.Seek(start, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+			return rs, h.Sum64, nil
+		}
+	}
+	return io.TeeReader(r, h), h.Sum64, nil
+}
+
+// checkCRC64 compares the x-cos-hash-crc64ecma response header with the
+// CRC64 of the uploaded data.
+func checkCRC64(key, header string, want uint64) error {
+	if header == "" {
+		return fmt.Errorf("tencent: upload of %q not verified: response has no %s header", key, cosCRC64Header)
+	}
+	if got, err := strconv.ParseUint(header, 10, 64); err != nil || got != want {
+		return fmt.Errorf("%w: %q: crc64ecma is %s, expected %d", storage.ErrChecksumMismatch, key, header, want)
+	}
+	return nil
+}
+
 func (t *Tencent) Download(ctx context.Context, key string) (io.ReadCloser, error) {
-	resp, err := t.client.Object.Get(ctx, key, nil)
+	opt := &cos.ObjectGetOptions{}
+	opt.XCosSSECustomerAglo, opt.XCosSSECustomerKey, opt.XCosSSECustomerKeyMD5 = sseCustomer(t.sse(ctx))
+	resp, err := t.client.Object.Get(ctx, key, opt)
 	if err != nil {
 		return nil, fmt.Errorf("tencent: download failed: %w", err)
 	}
@@ -153,10 +307,26 @@ func (t *Tencent) Close() error {
 	return nil
 }
 
+// Ping checks that the bucket is reachable with the configured credentials.
+func (t *Tencent) Ping(ctx context.Context) error {
+	if _, err := t.client.Bucket.Head(ctx); err != nil {
+		return fmt.Errorf("tencent: ping failed: %w", err)
+	}
+	return nil
+}
+
 // --- AdvancedStorage ---
 
 func (t *Tencent) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
-	presignedURL, err := t.client.Object.GetPresignedURL(ctx, http.MethodGet, key, t.config.SecretID, t.config.SecretKey, expires, nil)
+	c, err := t.creds.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("tencent: %w", err)
+	}
+	var opt any // A typed nil would be dereferenced by the SDK
+	if c.SessionToken != "" {
+		opt = &cos.PresignedURLOptions{Query: &url.Values{"x-cos-security-token": {c.SessionToken}}}
+	}
+	presignedURL, err := t.client.Object.GetPresignedURL(ctx, http.MethodGet, key, c.AccessKeyID, c.SecretAccessKey, expires, opt)
 	if err != nil {
 		return "", fmt.Errorf("tencent: failed to generate signed URL: %w", err)
 	}
@@ -184,9 +354,10 @@ func (t *Tencent) List(ctx context.Context, prefix string, opts ...storage.ListO
 	var files []storage.FileInfo
 	for _, obj := range result.Contents {
 		files = append(files, storage.FileInfo{
-			Key:  obj.Key,
-			Size: int64(obj.Size),
-			ETag: obj.ETag,
+			Key:          obj.Key,
+			Size:         int64(obj.Size),
+			ETag:         obj.ETag,
+			StorageClass: fromCOSClass(obj.StorageClass),
 		})
 	}
 
@@ -197,9 +368,12 @@ func (t *Tencent) List(ctx context.Context, prefix string, opts ...storage.ListO
 	}, nil
 }
 
+func (t *Tencent) sourceURL(key string) string {
+	return fmt.Sprintf("%s.cos.%s.myqcloud.com/%s", t.config.Bucket, t.config.Region, key)
+}
+
 func (t *Tencent) Copy(ctx context.Context, src, dst string) error {
-	sourceURL := fmt.Sprintf("%s.cos.%s.myqcloud.com/%s", t.config.Bucket, t.config.Region, src)
-	_, _, err := t.client.Object.Copy(ctx, dst, sourceURL, nil)
+	_, _, err := t.client.Object.Copy(ctx, dst, t.sourceURL(src), t.copyOptions(ctx))
 	if err != nil {
 		return fmt.Errorf("tencent: copy failed: %w", err)
 	}
@@ -214,7 +388,7 @@ func (t *Tencent) Move(ctx context.Context, src, dst string) error {
 }
 
 func (t *Tencent) Size(ctx context.Context, key string) (int64, error) {
-	resp, err := t.client.Object.Head(ctx, key, nil)
+	resp, err := t.client.Object.Head(ctx, key, t.headOptions(ctx))
 	if err != nil {
 		return 0, fmt.Errorf("tencent: failed to get size: %w", err)
 	}
@@ -222,17 +396,98 @@ func (t *Tencent) Size(ctx context.Context, key string) (int64, error) {
 }
 
 func (t *Tencent) Metadata(ctx context.Context, key string) (*storage.FileInfo, error) {
-	resp, err := t.client.Object.Head(ctx, key, nil)
+	resp, err := t.client.Object.Head(ctx, key, t.headOptions(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("tencent: failed to get metadata: %w", err)
 	}
 
 	return &storage.FileInfo{
-		Key:         key,
-		Size:        resp.ContentLength,
-		ContentType: resp.Header.Get("Content-Type"),
-		ETag:        resp.Header.Get("ETag"),
+		Key:          key,
+		Size:         resp.ContentLength,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		StorageClass: fromCOSClass(resp.Header.Get("x-cos-storage-class")),
+		Metadata:     userMetadata(resp.Header),
 	}, nil
 }
 
+// userMetadata extracts x-cos-meta-* headers with lowercase names.
+func userMetadata(h http.Header) map[string]string {
+	var m map[string]string
+	for k, v := range h {
+		name, ok := strings.CutPrefix(strings.ToLower(k), "x-cos-meta-")
+		if !ok || len(v) == 0 {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[name] = v[0]
+	}
+	return m
+}
+
+// --- ArchiveStorage ---
+
+func toCOSClass(c storage.StorageClass) string {
+	switch c {
+	case storage.StorageClassStandard:
+		return "STANDARD"
+	case storage.StorageClassInfrequentAccess:
+		return "STANDARD_IA"
+	case storage.StorageClassArchive:
+		return "ARCHIVE"
+	case storage.StorageClassColdArchive:
+		return "DEEP_ARCHIVE"
+	}
+	return string(c)
+}
+
+func fromCOSClass(c string) storage.StorageClass {
+	switch c {
+	case "", "STANDARD":
+		return storage.StorageClassStandard
+	case "STANDARD_IA":
+		return storage.StorageClassInfrequentAccess
+	case "ARCHIVE":
+		return storage.StorageClassArchive
+	case "DEEP_ARCHIVE":
+		return storage.StorageClassColdArchive
+	}
+	return storage.StorageClass(c)
+}
+
+// SetStorageClass changes the storage class by copying the object onto itself.
+func (t *Tencent) SetStorageClass(ctx context.Context, key string, class storage.StorageClass) error {
+	opt := t.copyOptions(ctx)
+	opt.XCosStorageClass = toCOSClass(class)
+	_, _, err := t.client.Object.Copy(ctx, key, t.sourceURL(key), opt)
+	if err != nil {
+		return fmt.Errorf("tencent: failed to change storage class: %w", err)
+	}
+	return nil
+}
+
+func (t *Tencent) Restore(ctx context.Context, key string, days int) error {
+	_, err := t.client.Object.PostRestore(ctx, key, &cos.ObjectRestoreOptions{
+		Days: days,
+		Tier: &cos.CASJobParameters{Tier: "Standard"},
+	})
+	if err != nil {
+		return fmt.Errorf("tencent: restore failed: %w", err)
+	}
+	return nil
+}
+
+func (t *Tencent) RestoreStatus(ctx context.Context, key string) (*storage.RestoreStatus, error) {
+	resp, err := t.client.Object.Head(ctx, key, t.headOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("tencent: failed to get restore status: %w", err)
+	}
+	return storage.ParseRestoreHeader(resp.Header.Get("x-cos-restore")), nil
+}
+
 var _ storage.AdvancedStorage = (*Tencent)(nil)
+var _ storage.ArchiveStorage = (*Tencent)(nil)
+var _ storage.Pinger = (*Tencent)(nil)
+var _ storage.UploadCredentialsIssuer = (*Tencent)(nil)
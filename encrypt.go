@@ -0,0 +1,454 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metadata keys written by EncryptedStorage.
+const (
+	MetaEncAlgorithm  = "enc-alg"
+	MetaEncKeyID      = "enc-key-id"
+	MetaEncWrappedKey = "enc-wrapped-key"
+	MetaEncChunkSize  = "enc-chunk-size"
+)
+
+// EncAlgorithm identifies the chunked AES-256-GCM stream format.
+const EncAlgorithm = "AES-256-GCM-STREAM"
+
+const (
+	encDefaultChunkSize = 64 * 1024
+	encTagSize          = 16
+	encNonceSize        = 12
+)
+
+// ErrDecrypt is returned when an encrypted object cannot be decrypted,
+// e.g. because it was tampered with or truncated.
+var ErrDecrypt = errors.New("storage: decryption failed")
+
+// KeyProvider wraps and unwraps per-object data keys.
+// Implementations typically delegate to a KMS or HSM.
+type KeyProvider interface {
+	// WrapKey encrypts a data key. It returns the wrapped key and the ID of
+	// the key-encryption key used, which is passed back to UnwrapKey.
+	WrapKey(ctx context.Context, dataKey []byte) (wrapped []byte, keyID string, err error)
+
+	// UnwrapKey decrypts a data key wrapped by the key-encryption key keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeyRing is a KeyProvider backed by in-memory 256-bit keys.
+// New data keys are wrapped with the primary key; older keys remain
+// available for unwrapping, so rotating only requires adding a new key.
+type StaticKeyRing struct {
+	mu      sync.RWMutex
+	primary string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyRing creates a key ring whose primary key is id.
+func NewStaticKeyRing(id string, key []byte) (*StaticKeyRing, error) {
+	r := &StaticKeyRing{keys: make(map[string][]byte)}
+	if err := r.Rotate(id, key); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// AddKey adds a key that can unwrap existing data keys without making it primary.
+func (r *StaticKeyRing) AddKey(id string, key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("storage: key %q must be 32 bytes, got %d", id, len(key))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// Rotate adds key and makes it the primary key for new uploads.
+func (r *StaticKeyRing) Rotate(id string, key []byte) error {
+	if err := r.AddKey(id, key); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.primary = id
+	r.mu.Unlock()
+	return nil
+}
+
+// WrapKey implements KeyProvider.
+func (r *StaticKeyRing) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	r.mu.RLock()
+	id, kek := r.primary, r.keys[r.primary]
+	r.mu.RUnlock()
+
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("storage: failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(id)), id, nil
+}
+
+// UnwrapKey implements KeyProvider.
+func (r *StaticKeyRing) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	r.mu.RLock()
+	kek, ok := r.keys[keyID]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("storage: unknown key %q", keyID)
+	}
+
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedStorage wraps a Storage with client-side envelope encryption.
+//
+// Each object is encrypted with a fresh data key in fixed-size AES-256-GCM
+// chunks, so uploads and downloads stream without buffering the whole file.
+// The data key is wrapped by the KeyProvider and stored, with the algorithm,
+// in the object metadata. Objects without that metadata are read as plaintext.
+//
+// Size and Metadata report plaintext sizes; List reports stored sizes.
+type EncryptedStorage struct {
+	wrapped
+	keys      KeyProvider
+	chunkSize int
+}
+
+// EncryptionOption configures an EncryptedStorage.
+type EncryptionOption func(*EncryptedStorage)
+
+// WithChunkSize sets the plaintext chunk size (default 64 KiB).
+func WithChunkSize(n int) EncryptionOption {
+	return func(e *EncryptedStorage) {
+		if n > 0 {
+			e.chunkSize = n
+		}
+	}
+}
+
+// WrapWithEncryption wraps a storage with client-side encryption.
+// The storage must implement AdvancedStorage so Download can read the metadata.
+func WrapWithEncryption(s Storage, keys KeyProvider, opts ...EncryptionOption) *EncryptedStorage {
+	e := &EncryptedStorage{
+		wrapped:   wrapped{s},
+		keys:      keys,
+		chunkSize: encDefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Upload encrypts reader and uploads the ciphertext.
+func (e *EncryptedStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	options := &UploadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("storage: failed to generate data key: %w", err)
+	}
+	wrappedKey, keyID, err := e.keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to wrap data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string, len(options.Metadata)+4)
+	for k, v := range options.Metadata {
+		meta[k] = v
+	}
+	meta[MetaEncAlgorithm] = EncAlgorithm
+	meta[MetaEncKeyID] = keyID
+	meta[MetaEncWrappedKey] = base64.StdEncoding.EncodeToString(wrappedKey)
+	meta[MetaEncChunkSize] = strconv.Itoa(e.chunkSize)
+
+	src := &countingReader{r: reader}
+	enc := &encryptReader{src: bufio.NewReaderSize(src, e.chunkSize+1), aead: aead, chunk: make([]byte, e.chunkSize)}
+	result, err := e.Storage.Upload(ctx, key, enc, append(opts, WithMetadata(meta), withoutChecksum())...)
+	if err != nil {
+		return nil, err
+	}
+	result.Size = src.n
+	return result, nil
+}
+
+// Download returns a reader that decrypts the object while reading.
+// A tampered or truncated object fails with ErrDecrypt.
+func (e *EncryptedStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	info, err := e.encMetadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := e.Storage.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if info.encAEAD == nil {
+		return rc, nil
+	}
+	return newDecryptReader(rc, info.encAEAD, info.encChunkSize), nil
+}
+
+// Size returns the plaintext size.
+func (e *EncryptedStorage) Size(ctx context.Context, key string) (int64, error) {
+	info, err := e.Metadata(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// Metadata returns the file info with the plaintext size.
+// Encryption metadata is removed from FileInfo.Metadata.
+func (e *EncryptedStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	info, err := e.encMetadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &info.FileInfo, nil
+}
+
+type encFileInfo struct {
+	FileInfo
+	encAEAD      cipher.AEAD
+	encChunkSize int
+}
+
+func (e *EncryptedStorage) encMetadata(ctx context.Context, key string) (*encFileInfo, error) {
+	info, err := e.wrapped.Metadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	out := &encFileInfo{FileInfo: *info}
+	alg := metaValue(info.Metadata, MetaEncAlgorithm)
+	if alg == "" {
+		return out, nil
+	}
+	if alg != EncAlgorithm {
+		return nil, fmt.Errorf("storage: unsupported encryption algorithm %q", alg)
+	}
+
+	chunkSize, err := strconv.Atoi(metaValue(info.Metadata, MetaEncChunkSize))
+	if err != nil || chunkSize <= 0 {
+		return nil, fmt.Errorf("storage: invalid encryption chunk size for %q", key)
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(metaValue(info.Metadata, MetaEncWrappedKey))
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid wrapped key for %q: %w", key, err)
+	}
+	dataKey, err := e.keys.UnwrapKey(ctx, metaValue(info.Metadata, MetaEncKeyID), wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to unwrap data key for %q: %w", key, err)
+	}
+	if out.encAEAD, err = newGCM(dataKey); err != nil {
+		return nil, err
+	}
+	out.encChunkSize = chunkSize
+
+	// Every chunk carries a tag, including a final, possibly empty one.
+	chunks := (info.Size + int64(chunkSize+encTagSize) - 1) / int64(chunkSize+encTagSize)
+	out.Size = info.Size - chunks*encTagSize
+	out.StoredSize = info.Size
+
+	out.Metadata = make(map[string]string, len(info.Metadata))
+	for k, v := range info.Metadata {
+		switch strings.ToLower(k) {
+		case MetaEncAlgorithm, MetaEncKeyID, MetaEncWrappedKey, MetaEncChunkSize:
+		default:
+			out.Metadata[k] = v
+		}
+	}
+	return out, nil
+}
+
+// metaValue looks up a metadata key case-insensitively, since some
+// providers canonicalize metadata names.
+func metaValue(m map[string]string, key string) string {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// encNonce builds the nonce for chunk i. The last byte marks the final chunk,
+// so truncating the stream at a chunk boundary is detected.
+func encNonce(i uint64, final bool) []byte {
+	nonce := make([]byte, encNonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], i)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// encryptReader seals src in chunks as it is read.
+type encryptReader struct {
+	src   *bufio.Reader
+	aead  cipher.AEAD
+	chunk []byte
+	out   []byte
+	index uint64
+	done  bool
+	err   error
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			r.err = err
+			return 0, err
+		}
+		final := err != nil
+		if !final {
+			// Peek so a full last chunk is marked final instead of
+			// being followed by an empty one.
+			if _, perr := r.src.Peek(1); perr == io.EOF {
+				final = true
+			} else if perr != nil {
+				r.err = perr
+				return 0, perr
+			}
+		}
+		r.out = r.aead.Seal(r.out[:0], encNonce(r.index, final), r.chunk[:n], nil)
+		r.index++
+		r.done = final
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// decryptReader opens chunks sealed by encryptReader.
+type decryptReader struct {
+	src   io.ReadCloser
+	buf   *bufio.Reader
+	aead  cipher.AEAD
+	chunk []byte
+	out   []byte
+	index uint64
+	done  bool
+	err   error
+}
+
+func newDecryptReader(src io.ReadCloser, aead cipher.AEAD, chunkSize int) *decryptReader {
+	sealed := chunkSize + encTagSize
+	return &decryptReader{
+		src:   src,
+		buf:   bufio.NewReaderSize(src, sealed+1),
+		aead:  aead,
+		chunk: make([]byte, sealed),
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.buf, r.chunk)
+		switch {
+		case err == io.EOF:
+			// The stream ended before the final chunk.
+			r.err = ErrDecrypt
+			continue
+		case err != nil && err != io.ErrUnexpectedEOF:
+			r.err = err
+			continue
+		}
+		final := err != nil
+		if !final {
+			if _, perr := r.buf.Peek(1); perr == io.EOF {
+				final = true
+			} else if perr != nil {
+				r.err = perr
+				continue
+			}
+		}
+		plain, oerr := r.aead.Open(r.out[:0], encNonce(r.index, final), r.chunk[:n], nil)
+		if oerr != nil {
+			r.err = ErrDecrypt
+			continue
+		}
+		r.out = plain
+		r.index++
+		r.done = final
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestKeyRing(t *testing.T, id string, b byte) *StaticKeyRing {
+	t.Helper()
+	ring, err := NewStaticKeyRing(id, bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatalf("NewStaticKeyRing failed: %v", err)
+	}
+	return ring
+}
+
+func TestEncryptedStorage_RoundTrip(t *testing.T) {
+	local := newTestLocal(t)
+	s := WrapWithEncryption(local, newTestKeyRing(t, "k1", 1), WithChunkSize(16))
+	ctx := context.Background()
+
+	for _, size := range []int{0, 1, 16, 32, 45} {
+		data := bytes.Repeat([]byte("x"), size)
+		result, err := s.Upload(ctx, "pii.bin", bytes.NewReader(data),
+			WithMetadata(map[string]string{"owner": "alice"}))
+		if err != nil {
+			t.Fatalf("Upload(%d) failed: %v", size, err)
+		}
+		if result.Size != int64(size) {
+			t.Errorf("UploadResult.Size = %d, want %d", result.Size, size)
+		}
+
+		stored, _ := local.Size(ctx, "pii.bin")
+		if stored == int64(size) {
+			t.Errorf("Stored size %d should include chunk tags", stored)
+		}
+
+		got, err := s.Size(ctx, "pii.bin")
+		if err != nil || got != int64(size) {
+			t.Errorf("Size = %d, %v, want %d", got, err, size)
+		}
+
+		rc, err := s.Download(ctx, "pii.bin")
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		plain, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(plain, data) {
+			t.Errorf("Download(%d) = %q, %v", size, plain, err)
+		}
+	}
+
+	info, _ := s.Metadata(ctx, "pii.bin")
+	if info.Metadata["owner"] != "alice" || info.Metadata[MetaEncWrappedKey] != "" {
+		t.Errorf("Metadata should keep user keys and hide encryption keys, got %v", info.Metadata)
+	}
+}
+
+func TestEncryptedStorage_DetectsTampering(t *testing.T) {
+	local := newTestLocal(t)
+	s := WrapWithEncryption(local, newTestKeyRing(t, "k1", 1), WithChunkSize(16))
+	ctx := context.Background()
+
+	s.Upload(ctx, "a.bin", strings.NewReader(strings.Repeat("secret", 10)))
+	path := local.fullPath("a.bin")
+	sealed, _ := os.ReadFile(path)
+
+	cases := map[string][]byte{
+		"flipped":   append(append([]byte{}, sealed[:5]...), append([]byte{sealed[5] ^ 1}, sealed[6:]...)...),
+		"truncated": sealed[:32],
+		"empty":     {},
+	}
+	for name, data := range cases {
+		os.WriteFile(path, data, 0644)
+		rc, err := s.Download(ctx, "a.bin")
+		if err != nil {
+			t.Fatalf("%s: Download failed: %v", name, err)
+		}
+		_, err = io.ReadAll(rc)
+		rc.Close()
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: expected ErrDecrypt, got %v", name, err)
+		}
+	}
+}
+
+func TestEncryptedStorage_KeyRotationAndLegacy(t *testing.T) {
+	local := newTestLocal(t)
+	ring := newTestKeyRing(t, "k1", 1)
+	s := WrapWithEncryption(local, ring)
+	ctx := context.Background()
+
+	s.Upload(ctx, "old.txt", strings.NewReader("old"))
+	if err := ring.Rotate("k2", bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	s.Upload(ctx, "new.txt", strings.NewReader("new"))
+	local.Upload(ctx, "legacy.txt", strings.NewReader("plain"))
+
+	for key, want := range map[string]string{"old.txt": "old", "new.txt": "new", "legacy.txt": "plain"} {
+		rc, err := s.Download(ctx, key)
+		if err != nil {
+			t.Fatalf("Download(%s) failed: %v", key, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(got) != want {
+			t.Errorf("Download(%s) = %q, want %q", key, got, want)
+		}
+	}
+
+	info, _ := local.Metadata(ctx, "new.txt")
+	if info.Metadata[MetaEncKeyID] != "k2" {
+		t.Errorf("New uploads should use the rotated key, got %q", info.Metadata[MetaEncKeyID])
+	}
+}
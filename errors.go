@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
@@ -13,6 +14,8 @@ var (
 	ErrInvalidKey     = errors.New("storage: invalid key")
 	ErrNotImplemented = errors.New("storage: not implemented")
 	ErrClosed         = errors.New("storage: storage is closed")
+	ErrCircuitOpen    = errors.New("storage: circuit breaker is open")
+	ErrValidation     = errors.New("storage: upload rejected by validation")
 )
 
 // Error represents a storage error with additional context.
@@ -56,3 +59,19 @@ func IsNotFoundError(err error) bool {
 func IsPermissionError(err error) bool {
 	return errors.Is(err, ErrPermission)
 }
+
+// IsRetryableError reports whether err may succeed if retried later, such
+// as a network or server error, as opposed to a not-found, permission,
+// invalid-key, validation or not-implemented error, or a canceled context.
+func IsRetryableError(err error) bool {
+	return err != nil &&
+		!IsNotFoundError(err) &&
+		!errors.Is(err, ErrPermission) &&
+		!errors.Is(err, ErrInvalidKey) &&
+		!errors.Is(err, ErrNotImplemented) &&
+		!errors.Is(err, ErrAlreadyExists) &&
+		!errors.Is(err, ErrChecksumMismatch) &&
+		!errors.Is(err, ErrCircuitOpen) &&
+		!errors.Is(err, ErrValidation) &&
+		!errors.Is(err, context.Canceled)
+}
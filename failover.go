@@ -0,0 +1,454 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterComposite("failover", newFailoverFromConfig)
+	RegisterSchema("failover", failoverConfig{})
+}
+
+// MetaDisk is the UploadResult metadata key naming the disk that served
+// an upload through a composite storage.
+const MetaDisk = "disk"
+
+// FailoverOptions configures FailoverStorage.
+type FailoverOptions struct {
+	ProbeInterval  time.Duration `option:"probe_interval"`  // How often disks are probed (default 30s)
+	ProbeKey       string        `option:"probe_key"`       // Canary key written by probe_write (default ".health/canary")
+	ProbeWrite     bool          `option:"probe_write"`     // Probe by uploading the canary instead of with Ping
+	Window         int           `option:"window"`          // Number of recent operations used for the error rate (default 20)
+	ErrorThreshold float64       `option:"error_threshold"` // Error rate marking a disk unhealthy (default 0.5)
+}
+
+// FailoverStatus is the health of a disk in a FailoverStorage.
+type FailoverStatus struct {
+	Name      string
+	Healthy   bool
+	ErrorRate float64 // Over the recent operations window
+	LastError error
+	LastProbe time.Time
+}
+
+// minFailoverSamples is the number of operations needed before the error
+// rate can mark a disk unhealthy.
+const minFailoverSamples = 5
+
+type failoverDisk struct {
+	NamedStorage
+
+	mu        sync.Mutex
+	healthy   bool
+	results   []bool // Ring of recent outcomes, true = failed
+	next      int
+	count     int
+	lastErr   error
+	lastProbe time.Time
+}
+
+func (d *failoverDisk) record(err error, window int, threshold float64) (changed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.results == nil {
+		d.results = make([]bool, window)
+	}
+	d.results[d.next] = err != nil
+	d.next = (d.next + 1) % len(d.results)
+	if d.count < len(d.results) {
+		d.count++
+	}
+	if err != nil {
+		d.lastErr = err
+	}
+	if d.healthy && d.count >= minFailoverSamples && d.errorRate() >= threshold {
+		d.healthy = false
+		return true
+	}
+	return false
+}
+
+func (d *failoverDisk) errorRate() float64 {
+	if d.count == 0 {
+		return 0
+	}
+	failed := 0
+	for i := 0; i < d.count; i++ {
+		if d.results[i] {
+			failed++
+		}
+	}
+	return float64(failed) / float64(d.count)
+}
+
+// FailoverStorage routes every operation to the first healthy disk of an
+// ordered list.
+//
+// A disk becomes unhealthy when probing it fails or its recent error rate
+// reaches the threshold, and healthy again when a probe succeeds, so
+// traffic returns to the primary once it recovers. Operations that fail
+// on a disk are retried on the next one, except uploads whose reader
+// cannot be rewound. Not-found and similar errors are returned as is and
+// do not count against a disk's health.
+type FailoverStorage struct {
+	disks []*failoverDisk
+	opts  FailoverOptions
+
+	active string
+	mu     sync.Mutex
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewFailoverStorage creates a failover storage over disks, in order of
+// preference, and starts probing them. The disks are not closed by Close.
+func NewFailoverStorage(opts FailoverOptions, disks ...NamedStorage) (*FailoverStorage, error) {
+	if len(disks) == 0 {
+		return nil, fmt.Errorf("storage: failover: no disks configured")
+	}
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = 30 * time.Second
+	}
+	if opts.ProbeKey == "" {
+		opts.ProbeKey = ".health/canary"
+	}
+	if opts.Window <= 0 {
+		opts.Window = 20
+	}
+	if opts.ErrorThreshold <= 0 {
+		opts.ErrorThreshold = 0.5
+	}
+
+	f := &FailoverStorage{opts: opts, active: disks[0].Name, done: make(chan struct{})}
+	for _, d := range disks {
+		f.disks = append(f.disks, &failoverDisk{NamedStorage: d, healthy: true})
+	}
+	f.wg.Add(1)
+	go f.probeLoop()
+	return f, nil
+}
+
+// newFailoverFromConfig creates a failover storage from disk options:
+//
+//	disks: [aliyun, tencent]   # in order of preference
+//	probe_interval: 30s
+//	probe_key: .health/canary
+//	probe_write: false
+//	window: 20
+//	error_threshold: 0.5
+func newFailoverFromConfig(disks DiskSource, cfg map[string]any) (Storage, error) {
+	var c failoverConfig
+	if err := DecodeOptions(cfg, &c); err != nil {
+		return nil, fmt.Errorf("failover: %w", err)
+	}
+	children, err := childDisks(disks, c.Disks)
+	if err != nil {
+		return nil, err
+	}
+	return NewFailoverStorage(c.FailoverOptions, children...)
+}
+
+type failoverConfig struct {
+	Disks []string `option:"disks,required,disk"`
+	FailoverOptions
+}
+
+func (f *FailoverStorage) probeLoop() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), f.opts.ProbeInterval)
+			f.Probe(ctx)
+			cancel()
+		}
+	}
+}
+
+// Probe checks every disk now and updates its health. It runs
+// periodically in the background; calling it directly is useful after an
+// incident or in tests.
+func (f *FailoverStorage) Probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, d := range f.disks {
+		wg.Add(1)
+		go func(d *failoverDisk) {
+			defer wg.Done()
+			err := f.probe(ctx, d)
+
+			d.mu.Lock()
+			was := d.healthy
+			d.lastProbe = time.Now()
+			d.healthy = err == nil
+			if err == nil {
+				d.results, d.next, d.count = nil, 0, 0
+			} else {
+				d.lastErr = err
+			}
+			d.mu.Unlock()
+
+			if was && err != nil {
+				defaultLogger.Warn("failover: disk %s is unhealthy: %v", d.Name, err)
+			} else if !was && err == nil {
+				defaultLogger.Info("failover: disk %s recovered", d.Name)
+			}
+		}(d)
+	}
+	wg.Wait()
+	f.updateActive()
+}
+
+func (f *FailoverStorage) probe(ctx context.Context, d *failoverDisk) error {
+	if f.opts.ProbeWrite {
+		_, err := d.Upload(ctx, f.opts.ProbeKey, strings.NewReader(time.Now().UTC().Format(time.RFC3339)))
+		return err
+	}
+	return Ping(ctx, d.Storage)
+}
+
+// Status returns the health of each disk, in order of preference.
+func (f *FailoverStorage) Status() []FailoverStatus {
+	status := make([]FailoverStatus, len(f.disks))
+	for i, d := range f.disks {
+		d.mu.Lock()
+		status[i] = FailoverStatus{
+			Name:      d.Name,
+			Healthy:   d.healthy,
+			ErrorRate: d.errorRate(),
+			LastError: d.lastErr,
+			LastProbe: d.lastProbe,
+		}
+		d.mu.Unlock()
+	}
+	return status
+}
+
+// Active returns the name of the disk operations are currently routed to.
+func (f *FailoverStorage) Active() string {
+	return f.candidates()[0].Name
+}
+
+// candidates returns the healthy disks in order, followed by the unhealthy
+// ones as a last resort.
+func (f *FailoverStorage) candidates() []*failoverDisk {
+	healthy := make([]*failoverDisk, 0, len(f.disks))
+	var unhealthy []*failoverDisk
+	for _, d := range f.disks {
+		d.mu.Lock()
+		ok := d.healthy
+		d.mu.Unlock()
+		if ok {
+			healthy = append(healthy, d)
+		} else {
+			unhealthy = append(unhealthy, d)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// updateActive logs when routing switches to another disk.
+func (f *FailoverStorage) updateActive() {
+	active := f.Active()
+	f.mu.Lock()
+	prev := f.active
+	f.active = active
+	f.mu.Unlock()
+	if prev != active {
+		defaultLogger.Warn("failover: switching from %s to %s", prev, active)
+	}
+}
+
+// do runs fn on the candidate disks until one succeeds or returns a
+// non-health error, and returns the name of the disk that served it.
+// retry reports whether fn may run again after a failure.
+func (f *FailoverStorage) do(op, key string, retry func() bool, fn func(s Storage) error) (string, error) {
+	var lastErr error
+	for i, d := range f.candidates() {
+		if i > 0 && !retry() {
+			break
+		}
+		err := fn(d.Storage)
+		// Request errors such as not-found say nothing about the disk.
+		var healthErr error
+		if IsRetryableError(err) || errors.Is(err, ErrCircuitOpen) {
+			healthErr = err
+		}
+		if d.record(healthErr, f.opts.Window, f.opts.ErrorThreshold) {
+			defaultLogger.Warn("failover: disk %s is unhealthy (error rate over %.0f%%): %v",
+				d.Name, f.opts.ErrorThreshold*100, err)
+			f.updateActive()
+		}
+		if healthErr == nil {
+			if i > 0 {
+				defaultLogger.Info("failover: %s %q served by %s", op, key, d.Name)
+			} else {
+				defaultLogger.Debug("failover: %s %q served by %s", op, key, d.Name)
+			}
+			return d.Name, err
+		}
+		defaultLogger.Warn("failover: %s %q failed on %s: %v", op, key, d.Name, err)
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+func always() bool { return true }
+
+func (f *FailoverStorage) doAdvanced(op, key string, fn func(s AdvancedStorage) error) error {
+	_, err := f.do(op, key, always, func(s Storage) error {
+		adv, ok := s.(AdvancedStorage)
+		if !ok {
+			return ErrNotImplemented
+		}
+		return fn(adv)
+	})
+	return err
+}
+
+// Upload uploads to the first healthy disk. The disk's name is added to
+// UploadResult.Metadata under MetaDisk.
+func (f *FailoverStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	// Only a reader that can be rewound may be retried on another disk.
+	retry := func() bool { return false }
+	if s, ok := reader.(io.Seeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			retry = func() bool {
+				_, err := s.Seek(start, io.SeekStart)
+				return err == nil
+			}
+		}
+	}
+
+	var result *UploadResult
+	disk, err := f.do("upload", key, retry, func(s Storage) (err error) {
+		result, err = s.Upload(ctx, key, reader, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]string, len(result.Metadata)+1)
+	for k, v := range result.Metadata {
+		meta[k] = v
+	}
+	meta[MetaDisk] = disk
+	result.Metadata = meta
+	return result, nil
+}
+
+func (f *FailoverStorage) Download(ctx context.Context, key string) (rc io.ReadCloser, err error) {
+	_, err = f.do("download", key, always, func(s Storage) error {
+		rc, err = s.Download(ctx, key)
+		return err
+	})
+	return rc, err
+}
+
+func (f *FailoverStorage) Delete(ctx context.Context, key string) error {
+	_, err := f.do("delete", key, always, func(s Storage) error {
+		return s.Delete(ctx, key)
+	})
+	return err
+}
+
+func (f *FailoverStorage) Exists(ctx context.Context, key string) (ok bool, err error) {
+	_, err = f.do("exists", key, always, func(s Storage) error {
+		ok, err = s.Exists(ctx, key)
+		return err
+	})
+	return ok, err
+}
+
+func (f *FailoverStorage) URL(ctx context.Context, key string) (url string, err error) {
+	_, err = f.do("url", key, always, func(s Storage) error {
+		url, err = s.URL(ctx, key)
+		return err
+	})
+	return url, err
+}
+
+func (f *FailoverStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (url string, err error) {
+	err = f.doAdvanced("signed url", key, func(s AdvancedStorage) error {
+		url, err = s.SignedURL(ctx, key, expires)
+		return err
+	})
+	return url, err
+}
+
+func (f *FailoverStorage) List(ctx context.Context, prefix string, opts ...ListOption) (result *ListResult, err error) {
+	err = f.doAdvanced("list", prefix, func(s AdvancedStorage) error {
+		result, err = s.List(ctx, prefix, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (f *FailoverStorage) Copy(ctx context.Context, src, dst string) error {
+	return f.doAdvanced("copy", src, func(s AdvancedStorage) error {
+		return s.Copy(ctx, src, dst)
+	})
+}
+
+func (f *FailoverStorage) Move(ctx context.Context, src, dst string) error {
+	return f.doAdvanced("move", src, func(s AdvancedStorage) error {
+		return s.Move(ctx, src, dst)
+	})
+}
+
+func (f *FailoverStorage) Size(ctx context.Context, key string) (size int64, err error) {
+	err = f.doAdvanced("size", key, func(s AdvancedStorage) error {
+		size, err = s.Size(ctx, key)
+		return err
+	})
+	return size, err
+}
+
+func (f *FailoverStorage) Metadata(ctx context.Context, key string) (info *FileInfo, err error) {
+	err = f.doAdvanced("metadata", key, func(s AdvancedStorage) error {
+		info, err = s.Metadata(ctx, key)
+		return err
+	})
+	return info, err
+}
+
+// Ping succeeds if at least one disk answers, since operations fail over
+// to it; the errors of all disks are returned only when none does. Use
+// Status to see which disks are down.
+func (f *FailoverStorage) Ping(ctx context.Context) error {
+	var errs []error
+	for _, d := range f.disks {
+		err := Ping(ctx, d.Storage)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", d.Name, err))
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops probing. The child disks are not closed.
+func (f *FailoverStorage) Close() error {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+	default:
+		close(f.done)
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return nil
+}
+
+var _ AdvancedStorage = (*FailoverStorage)(nil)
+var _ Pinger = (*FailoverStorage)(nil)
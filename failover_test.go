@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailoverStorage(t *testing.T) {
+	ctx := context.Background()
+	primary := &flakyStorage{Storage: newTestLocal(t)}
+	secondary := &flakyStorage{Storage: newTestLocal(t)}
+	f, err := NewFailoverStorage(FailoverOptions{ProbeInterval: time.Hour},
+		NamedStorage{"primary", primary}, NamedStorage{"secondary", secondary})
+	if err != nil {
+		t.Fatalf("NewFailoverStorage failed: %v", err)
+	}
+	defer f.Close()
+
+	result, err := f.Upload(ctx, "a.txt", strings.NewReader("a"))
+	if err != nil || result.Metadata[MetaDisk] != "primary" {
+		t.Fatalf("Upload = %+v, %v; want served by primary", result, err)
+	}
+
+	// A seekable upload is retried on the next disk.
+	primary.down.Store(true)
+	result, err = f.Upload(ctx, "b.txt", strings.NewReader("b"))
+	if err != nil || result.Metadata[MetaDisk] != "secondary" {
+		t.Fatalf("Upload = %+v, %v; want served by secondary", result, err)
+	}
+	if got := readString(t, secondary, "b.txt"); got != "b" {
+		t.Errorf("secondary has %q", got)
+	}
+
+	// A stream cannot be replayed, so it fails while the primary is healthy.
+	if _, err := f.Upload(ctx, "c.txt", io.MultiReader(strings.NewReader("c"))); err == nil {
+		t.Error("Non-seekable upload should not be retried")
+	}
+
+	// Enough errors mark the primary unhealthy.
+	for i := 0; i < minFailoverSamples; i++ {
+		f.Exists(ctx, "b.txt")
+	}
+	if f.Active() != "secondary" || f.Status()[0].Healthy {
+		t.Fatalf("Expected failover to secondary, status %+v", f.Status())
+	}
+	result, err = f.Upload(ctx, "c.txt", io.MultiReader(strings.NewReader("c")))
+	if err != nil || result.Metadata[MetaDisk] != "secondary" {
+		t.Fatalf("Upload = %+v, %v; want served by secondary", result, err)
+	}
+
+	// Not-found errors do not count against health.
+	if _, err := f.Download(ctx, "missing.txt"); !IsNotFoundError(err) {
+		t.Errorf("Download(missing) = %v, want not found", err)
+	}
+
+	// The primary is used again once a probe succeeds.
+	primary.down.Store(false)
+	f.Probe(ctx)
+	if f.Active() != "primary" || !f.Status()[0].Healthy || !f.Status()[1].Healthy {
+		t.Errorf("Expected switch back to primary, status %+v", f.Status())
+	}
+}
+
+// pingStorage fails Ping while down is set; its other calls still work.
+type pingStorage struct {
+	Storage
+	down bool
+}
+
+func (p *pingStorage) Ping(ctx context.Context) error {
+	if p.down {
+		return errDown
+	}
+	return nil
+}
+
+func TestFailoverStorage_ProbeUsesPing(t *testing.T) {
+	primary := &pingStorage{Storage: newTestLocal(t), down: true}
+	f, err := NewFailoverStorage(FailoverOptions{ProbeInterval: time.Hour},
+		NamedStorage{"primary", primary}, NamedStorage{"secondary", newTestLocal(t)})
+	if err != nil {
+		t.Fatalf("NewFailoverStorage failed: %v", err)
+	}
+	defer f.Close()
+
+	f.Probe(context.Background())
+	if f.Active() != "secondary" || f.Status()[0].LastError != errDown {
+		t.Errorf("Expected the failed Ping to mark primary unhealthy, status %+v", f.Status())
+	}
+}
+
+func TestFailoverStorage_Setup(t *testing.T) {
+	mgr := NewManager(&Config{
+		Storages: map[string]StorageConfig{
+			"a": {Driver: "local", Options: map[string]any{"root": t.TempDir()}},
+			"b": {Driver: "local", Options: map[string]any{"root": t.TempDir()}},
+			"ha": {Driver: "failover", Options: map[string]any{
+				"disks": []any{"a", "b"}, "probe_interval": "1m", "error_threshold": 0.25,
+			}},
+			"bad": {Driver: "failover", Options: map[string]any{"disks": []any{"a"}, "probe_interval": "soon"}},
+		},
+	})
+	defer mgr.Close()
+
+	s, err := mgr.Disk("ha")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	f := s.(*FailoverStorage)
+	if f.opts.ProbeInterval != time.Minute || f.opts.ErrorThreshold != 0.25 || f.opts.Window != 20 {
+		t.Errorf("Unexpected options %+v", f.opts)
+	}
+	if _, err := mgr.Disk("bad"); err == nil || !strings.Contains(err.Error(), "probe_interval") {
+		t.Errorf("Expected a probe_interval error, got %v", err)
+	}
+}
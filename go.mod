@@ -1,3 +1,7 @@
 module github.com/wdcbot/go-storage
 
 go 1.21
+
+require github.com/klauspost/compress v1.17.11
+
+require gopkg.in/yaml.v3 v3.0.1
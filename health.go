@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pinger is implemented by storages with a cheap check that the backend is
+// reachable and the credentials work, such as a HEAD request on the
+// bucket.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// healthProbeKey is read by Ping for storages without a Ping method.
+const healthProbeKey = ".health/probe"
+
+// Ping checks that s is reachable, with its Ping method if it has one and
+// otherwise by reading the metadata of a probe key, which may be missing.
+// Exists is not used: drivers commonly report any error as a missing key.
+// Storages with neither method cannot be checked and fail with
+// ErrNotImplemented.
+func Ping(ctx context.Context, s Storage) error {
+	if p, ok := s.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	adv, ok := s.(AdvancedStorage)
+	if !ok {
+		return fmt.Errorf("%w: %T cannot be pinged", ErrNotImplemented, s)
+	}
+	if _, err := adv.Metadata(ctx, healthProbeKey); err != nil && !IsNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// pingDisks pings every disk of a composite storage and joins the errors,
+// naming the disks that failed.
+func pingDisks(ctx context.Context, disks ...NamedStorage) error {
+	var errs []error
+	for _, d := range disks {
+		if err := Ping(ctx, d.Storage); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping forwards to the decorated storage so that health checks reach the
+// backend.
+func (w wrapped) Ping(ctx context.Context) error {
+	return Ping(ctx, w.Storage)
+}
+
+// DiskHealth is the result of probing one disk.
+type DiskHealth struct {
+	Name    string
+	Healthy bool
+	Latency time.Duration // Time taken by the probe, excluding opening the disk
+	Err     error         // Why the disk failed to open or the probe failed
+}
+
+// HealthReport is the result of Manager.HealthCheck.
+type HealthReport struct {
+	Healthy bool         // Every disk checked is healthy
+	Disks   []DiskHealth // Sorted by name
+}
+
+// Err returns the errors of the unhealthy disks, or nil.
+func (r *HealthReport) Err() error {
+	var errs []error
+	for _, d := range r.Disks {
+		if d.Err != nil {
+			errs = append(errs, fmt.Errorf("storage: disk %q: %w", d.Name, d.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HealthCheck probes the named disks, or every disk if none are named, in
+// parallel with Ping. Disks not open yet are opened first, so that a bad
+// configuration or credential is reported.
+func (m *Manager) HealthCheck(ctx context.Context, names ...string) *HealthReport {
+	if len(names) == 0 {
+		names = m.Disks()
+	}
+	report := &HealthReport{Healthy: true, Disks: make([]DiskHealth, len(names))}
+	var wg sync.WaitGroup
+	for i, name := range names {
+		report.Disks[i].Name = name
+		wg.Add(1)
+		go func(d *DiskHealth) {
+			defer wg.Done()
+			s, release, err := m.acquire(d.Name)
+			if err != nil {
+				d.Err = err
+				return
+			}
+			defer release()
+			start := time.Now()
+			d.Err = Ping(ctx, s)
+			d.Latency = time.Since(start)
+			d.Healthy = d.Err == nil
+		}(&report.Disks[i])
+	}
+	wg.Wait()
+
+	sort.Slice(report.Disks, func(i, j int) bool {
+		return report.Disks[i].Name < report.Disks[j].Name
+	})
+	for _, d := range report.Disks {
+		if !d.Healthy {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// InitAll opens every disk and probes it, so that a bad configuration or
+// credential is found at startup rather than on the first request. It
+// returns the errors of all the disks that failed.
+func (m *Manager) InitAll(ctx context.Context) error {
+	return m.HealthCheck(ctx).Err()
+}
+
+// HealthHandler returns an http.Handler for readiness probes. It responds
+// 200 when every disk is healthy and 503 otherwise, with a JSON body:
+//
+//	{"status": "ok", "disks": {"s3": {"status": "ok", "latency_ms": 12.5}}}
+//
+// The disk query parameter restricts the check, e.g. /readyz?disk=s3&disk=local.
+// A probe that takes longer than timeout (default 5s) fails.
+func (m *Manager) HealthHandler(timeout time.Duration) http.Handler {
+	return healthHandler(func() *Manager { return m }, timeout)
+}
+
+// HealthHandler is Manager.HealthHandler for the Manager created by Setup.
+func HealthHandler(timeout time.Duration) http.Handler {
+	return healthHandler(DefaultManager, timeout)
+}
+
+type diskHealthJSON struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func healthHandler(manager func() *Manager, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := struct {
+			Status string                    `json:"status"`
+			Error  string                    `json:"error,omitempty"`
+			Disks  map[string]diskHealthJSON `json:"disks,omitempty"`
+		}{Status: "ok"}
+		code := http.StatusOK
+
+		if m := manager(); m == nil {
+			resp.Status, resp.Error = "unavailable", "storage: not initialized (call Setup first)"
+			code = http.StatusServiceUnavailable
+		} else {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			report := m.HealthCheck(ctx, r.URL.Query()["disk"]...)
+			resp.Disks = make(map[string]diskHealthJSON, len(report.Disks))
+			for _, d := range report.Disks {
+				dj := diskHealthJSON{Status: "ok", LatencyMS: float64(d.Latency.Microseconds()) / 1000}
+				if !d.Healthy {
+					dj.Status, dj.Error = "unavailable", d.Err.Error()
+				}
+				resp.Disks[d.Name] = dj
+			}
+			if !report.Healthy {
+				resp.Status = "unavailable"
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHealthManager(t *testing.T) (*Manager, string) {
+	dir := t.TempDir()
+	mgr := NewManager(&Config{
+		Default: "good",
+		Storages: map[string]StorageConfig{
+			"good":    {Driver: "local", Options: map[string]any{"root": filepath.Join(dir, "good"), "read_only": true}},
+			"removed": {Driver: "local", Options: map[string]any{"root": filepath.Join(dir, "removed")}},
+			"broken":  {Driver: "local", Options: map[string]any{}},
+		},
+	})
+	t.Cleanup(func() { mgr.Close() })
+	return mgr, dir
+}
+
+func TestManager_HealthCheck(t *testing.T) {
+	mgr, dir := newHealthManager(t)
+	if _, err := mgr.Disk("removed"); err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	os.RemoveAll(filepath.Join(dir, "removed"))
+
+	report := mgr.HealthCheck(context.Background())
+	if report.Healthy || len(report.Disks) != 3 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	byName := make(map[string]DiskHealth)
+	for _, d := range report.Disks {
+		byName[d.Name] = d
+	}
+	if d := byName["good"]; !d.Healthy || d.Err != nil || d.Latency <= 0 {
+		t.Errorf("good = %+v", d)
+	}
+	if d := byName["removed"]; d.Healthy || d.Err == nil {
+		t.Errorf("Ping through the wrappers did not notice the missing root: %+v", d)
+	}
+	if d := byName["broken"]; d.Healthy || d.Err == nil || !strings.Contains(d.Err.Error(), "root") {
+		t.Errorf("broken = %+v", d)
+	}
+
+	if report := mgr.HealthCheck(context.Background(), "good"); !report.Healthy || len(report.Disks) != 1 {
+		t.Errorf("Unexpected report for one disk: %+v", report)
+	}
+
+	err := mgr.InitAll(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `disk "broken"`) || !strings.Contains(err.Error(), `disk "removed"`) {
+		t.Errorf("InitAll error = %v", err)
+	}
+}
+
+func TestManager_HealthHandler(t *testing.T) {
+	mgr, _ := newHealthManager(t)
+	h := mgr.HealthHandler(0)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body struct {
+		Status string
+		Disks  map[string]struct {
+			Status string
+			Error  string
+		}
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusServiceUnavailable || body.Status != "unavailable" {
+		t.Errorf("Status = %d %q", rec.Code, body.Status)
+	}
+	if body.Disks["good"].Status != "ok" || body.Disks["broken"].Error == "" {
+		t.Errorf("Unexpected disks: %+v", body.Disks)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz?disk=good", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"latency_ms"`) {
+		t.Errorf("Status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPing_Composites(t *testing.T) {
+	ctx := context.Background()
+	good := NamedStorage{"good", newTestLocal(t)}
+	down := NamedStorage{"down", &pingStorage{Storage: newTestLocal(t), down: true}}
+
+	mirror, _ := NewMirrorStorage(MirrorAll, good, down)
+	defer mirror.Close()
+	tiered, _ := NewTieredStorage(good, down, TieredOptions{})
+	defer tiered.Close()
+	failover, _ := NewFailoverStorage(FailoverOptions{ProbeInterval: time.Hour}, good, down)
+	defer failover.Close()
+
+	for _, s := range []Storage{mirror, tiered} {
+		if err := Ping(ctx, s); !errors.Is(err, errDown) || !strings.Contains(err.Error(), "down: ") {
+			t.Errorf("Ping(%T) = %v, want the error of the down disk", s, err)
+		}
+	}
+
+	// A failover disk is ready while one of its disks answers.
+	if err := Ping(ctx, failover); err != nil {
+		t.Errorf("Ping(failover) = %v, want nil with one disk up", err)
+	}
+	allDown, _ := NewFailoverStorage(FailoverOptions{ProbeInterval: time.Hour},
+		down, NamedStorage{"down2", &pingStorage{Storage: newTestLocal(t), down: true}})
+	defer allDown.Close()
+	if err := Ping(ctx, allDown); !errors.Is(err, errDown) || !strings.Contains(err.Error(), "down2: ") {
+		t.Errorf("Ping(failover) = %v, want the errors of both disks", err)
+	}
+
+	// Without Ping, Metadata errors other than not found are reported.
+	noPing := struct{ AdvancedStorage }{metadataErrorStorage{newTestLocal(t)}}
+	if err := Ping(ctx, noPing); !errors.Is(err, errDown) {
+		t.Errorf("Ping = %v, want the Metadata error", err)
+	}
+	if err := Ping(ctx, newMockStorage()); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("Ping = %v, want ErrNotImplemented", err)
+	}
+}
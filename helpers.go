@@ -6,6 +6,7 @@ import (
 	"io"
 	"mime"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -141,6 +142,47 @@ func generateUUID() string {
 	return fmt.Sprintf("%x%x", now, uintptr(unsafe.Pointer(&x)))
 }
 
+// matchGlob reports whether key matches a slash-separated glob pattern.
+// "*" matches within one path segment and "**" matches any number of segments,
+// e.g. "images/**" or "logs/**/*.log".
+func matchGlob(pattern, key string) bool {
+	if pattern == "**" {
+		return true
+	}
+	p, rest, multi := strings.Cut(pattern, "/")
+	k, krest, kmulti := strings.Cut(key, "/")
+	if p == "**" {
+		if matchGlob(rest, key) {
+			return true
+		}
+		return kmulti && matchGlob(pattern, krest)
+	}
+	if ok, _ := path.Match(p, k); !ok {
+		return false
+	}
+	if !multi || !kmulti {
+		return multi == kmulti
+	}
+	return matchGlob(rest, krest)
+}
+
+// listAll lists every file under prefix, following NextMarker across pages.
+func listAll(ctx context.Context, s AdvancedStorage, prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	marker := ""
+	for {
+		result, err := s.List(ctx, prefix, WithMaxKeys(1000), WithMarker(marker))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, result.Files...)
+		if !result.IsTruncated || result.NextMarker == "" || result.NextMarker == marker {
+			return files, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
 // Must panics if err is not nil. Useful for initialization.
 func Must[T any](v T, err error) T {
 	if err != nil {
@@ -1,77 +1,387 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
 )
 
+// errManagerReplaced is returned by a Manager retired by Setup, so that
+// the package-level functions retry with the new default Manager.
+var errManagerReplaced = errors.New("storage: manager was replaced")
+
 // Manager manages multiple storage backends based on configuration.
 type Manager struct {
 	config   *Config
-	storages map[string]Storage
+	disks    map[string]*openDisk
+	replaced bool
+	resolve  []DiskResolver // See SetDiskResolver
 	mu       sync.RWMutex
+	reloadMu sync.Mutex
+}
+
+// openDisk is a disk opened by a Manager.
+type openDisk struct {
+	Storage
+	prebuilt   bool           // Added with Register rather than configured
+	composite  bool           // Built on other disks, closed first
+	children   []string       // Disks a composite is built on
+	childDisks []*openDisk    // The open children, in the order of children
+	inflight   sync.WaitGroup // Operations started through acquire
 }
 
 // NewManager creates a new storage manager from configuration.
 func NewManager(cfg *Config) *Manager {
 	return &Manager{
-		config:   cfg,
-		storages: make(map[string]Storage),
+		config: cfg,
+		disks:  make(map[string]*openDisk),
 	}
 }
 
+// Config returns the current configuration.
+func (m *Manager) Config() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.config
+}
+
 // Disk returns a storage backend by name.
 // If name is empty, returns the default storage.
+//
+// After a Reload changes or removes the disk, the returned Storage is
+// closed once the operations started through the package-level functions
+// finish; callers that keep it should call Disk again.
 func (m *Manager) Disk(name string) (Storage, error) {
 	if name == "" {
-		name = m.config.Default
+		name = m.Config().Default
 	}
 	if name == "" {
 		return nil, fmt.Errorf("storage: no default storage configured")
 	}
+	d, err := m.disk(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return d.Storage, nil
+}
 
+// disk returns the named disk, opening it if needed. chain lists the
+// composite disks currently opening it, to detect cycles.
+func (m *Manager) disk(name string, chain []string) (*openDisk, error) {
 	// Check if already initialized
 	m.mu.RLock()
-	if s, ok := m.storages[name]; ok {
+	if m.replaced {
 		m.mu.RUnlock()
-		return s, nil
+		return nil, errManagerReplaced
 	}
-	m.mu.RUnlock()
-
-	// Initialize the storage
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Double-check after acquiring write lock
-	if s, ok := m.storages[name]; ok {
-		return s, nil
+	if d, ok := m.disks[name]; ok {
+		m.mu.RUnlock()
+		return d, nil
 	}
-
 	cfg, ok := m.config.Storages[name]
+	m.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("storage: disk %q not configured", name)
 	}
 
-	s, err := Open(cfg.Driver, cfg.Options)
+	// Open without holding the lock: composite disks open their children
+	// through the Manager.
+	opts, err := resolveSecrets(context.Background(), cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to open disk %q: %w", name, err)
+	}
+	driverOpts, wrapOpts := splitDiskOptions(opts)
+	d := &openDisk{}
+	composite, isComposite := lookupComposite(cfg.Driver)
+	if isComposite {
+		src := chainSource{m: m, chain: append(chain[:len(chain):len(chain)], name), parent: d}
+		d.Storage, err = composite(src, driverOpts)
+		d.composite = true
+	} else {
+		d.Storage, err = openDriver(cfg.Driver, driverOpts)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("storage: failed to open disk %q: %w", name, err)
 	}
+	if d.Storage, err = applyDiskOptions(d.Storage, wrapOpts); err != nil {
+		return nil, fmt.Errorf("storage: disk %q: %w", name, err)
+	}
 
-	m.storages[name] = s
-	return s, nil
+	m.mu.Lock()
+	if m.replaced {
+		m.mu.Unlock()
+		d.Close()
+		return nil, errManagerReplaced
+	}
+	// Another goroutine may have opened it meanwhile; keep the first one.
+	if existing, ok := m.disks[name]; ok {
+		m.mu.Unlock()
+		d.Close()
+		return existing, nil
+	}
+	// A Reload or RemoveDisk may have changed the disk or its children while
+	// it was opening; open it again from the current configuration rather
+	// than installing a removed disk or a composite on a retired child.
+	if current, ok := m.config.Storages[name]; !ok || !sameStorageConfig(cfg, current) || !d.childrenCurrent(m.disks) {
+		m.mu.Unlock()
+		d.Close()
+		return m.disk(name, chain)
+	}
+	m.disks[name] = d
+	m.mu.Unlock()
+	return d, nil
+}
+
+// childrenCurrent reports whether the children a composite was opened on
+// are still the open disks in disks.
+func (d *openDisk) childrenCurrent(disks map[string]*openDisk) bool {
+	for i, name := range d.children {
+		if disks[name] != d.childDisks[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire returns the named disk and counts an operation on it as in
+// flight until release is called, so that Reload closes a replaced disk
+// only once the operation is done.
+func (m *Manager) acquire(name string) (s Storage, release func(), err error) {
+	if name == "" {
+		name = m.Config().Default
+	}
+	if name == "" {
+		return nil, nil, fmt.Errorf("storage: no default storage configured")
+	}
+	for {
+		d, err := m.disk(name, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.mu.RLock()
+		current := m.disks[name] == d
+		if current {
+			d.inflight.Add(1)
+		}
+		m.mu.RUnlock()
+		if current {
+			return d.Storage, d.inflight.Done, nil
+		}
+		// Reloaded between the lookup and the lease; use the new disk.
+	}
 }
 
 // Close closes all initialized storage backends.
+// Composite disks are closed before the disks they are built on.
 func (m *Manager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	var lastErr error
-	for name, s := range m.storages {
-		if err := s.Close(); err != nil {
-			lastErr = fmt.Errorf("storage: failed to close %q: %w", name, err)
+	for _, composite := range []bool{true, false} {
+		for name, d := range m.disks {
+			if d.composite != composite {
+				continue
+			}
+			if err := d.Close(); err != nil {
+				lastErr = fmt.Errorf("storage: failed to close %q: %w", name, err)
+			}
 		}
 	}
-	m.storages = make(map[string]Storage)
+	m.disks = make(map[string]*openDisk)
 	return lastErr
 }
+
+// Disks returns the names of the configured and registered disks, sorted.
+func (m *Manager) Disks() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.config.Storages))
+	for name := range m.config.Storages {
+		names = append(names, name)
+	}
+	for name, d := range m.disks {
+		if d.prebuilt {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddDisk configures and opens a disk at runtime, e.g. a bucket created
+// for a new customer. It fails if the name is taken or the disk cannot be
+// opened.
+func (m *Manager) AddDisk(name string, cfg StorageConfig) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	if m.hasDisk(name) {
+		return fmt.Errorf("storage: disk %q already exists", name)
+	}
+	next := m.cloneConfig()
+	next.Storages[name] = cfg
+	return m.reload(next)
+}
+
+// Register adds an already opened Storage as a disk. The Manager takes
+// ownership: the storage is closed by Close and RemoveDisk, and kept
+// across Reload.
+func (m *Manager) Register(name string, s Storage) error {
+	if s == nil {
+		return fmt.Errorf("storage: disk %q is nil", name)
+	}
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.config.Storages[name]; ok {
+		return fmt.Errorf("storage: disk %q already exists", name)
+	}
+	if _, ok := m.disks[name]; ok {
+		return fmt.Errorf("storage: disk %q already exists", name)
+	}
+	m.disks[name] = &openDisk{Storage: s, prebuilt: true}
+	return nil
+}
+
+// RemoveDisk removes a disk. Like a disk dropped by Reload, it is closed
+// in the background once the operations in flight on it finish. The
+// default disk and disks other disks are built on cannot be removed.
+func (m *Manager) RemoveDisk(name string) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	if !m.hasDisk(name) {
+		return fmt.Errorf("storage: disk %q not configured", name)
+	}
+	cfg := m.Config()
+	if name == cfg.Default {
+		return fmt.Errorf("storage: disk %q is the default disk", name)
+	}
+	for other := range cfg.Storages {
+		if refs, _ := validateDisk(cfg, other); other != name && slices.Contains(refs, name) {
+			return fmt.Errorf("storage: disk %q is used by disk %q", name, other)
+		}
+	}
+
+	m.mu.Lock()
+	if d, ok := m.disks[name]; ok && d.prebuilt {
+		delete(m.disks, name)
+		m.mu.Unlock()
+		retire(map[string]*openDisk{name: d})
+		return nil
+	}
+	m.mu.Unlock()
+	next := m.cloneConfig()
+	delete(next.Storages, name)
+	return m.reload(next)
+}
+
+func (m *Manager) hasDisk(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, configured := m.config.Storages[name]
+	d, open := m.disks[name]
+	return configured || open && d.prebuilt
+}
+
+// cloneConfig copies the current configuration for a change.
+func (m *Manager) cloneConfig() *Config {
+	cfg := m.Config()
+	next := &Config{Default: cfg.Default, Storages: make(map[string]StorageConfig, len(cfg.Storages)+1)}
+	for name, sc := range cfg.Storages {
+		next.Storages[name] = sc
+	}
+	return next
+}
+
+// diskOption is a wrapper configured in a disk's options next to the
+// driver options, e.g.
+//
+//	s3:
+//	  driver: s3
+//	  rate_limit: {ops_per_second: 100}
+//
+// The option is removed before the driver sees the config. wrap must not
+// have side effects: ValidateConfig calls it with a nil Storage to check
+// the option.
+type diskOption struct {
+	key  string
+	wrap func(s Storage, v any) (Storage, error)
+}
+
+// diskOptions are applied in order, so later entries wrap earlier ones.
+var diskOptions = []diskOption{
+	{"rate_limit", func(s Storage, v any) (Storage, error) {
+		limit, err := parseRateLimit(v)
+		if err != nil {
+			return nil, err
+		}
+		return WrapWithRateLimit(s, limit), nil
+	}},
+	{"circuit_breaker", func(s Storage, v any) (Storage, error) {
+		opts, err := parseCircuitBreaker(v)
+		if err != nil {
+			return nil, err
+		}
+		return WrapWithCircuitBreaker(s, opts), nil
+	}},
+	// Policies are outermost so refused calls are not rate limited.
+	{"validation", func(s Storage, v any) (Storage, error) {
+		rules, err := parseValidation(v)
+		if err != nil {
+			return nil, err
+		}
+		return WrapWithValidation(s, rules), nil
+	}},
+	{"worm", func(s Storage, v any) (Storage, error) {
+		opts, enabled, err := parseWORM(v)
+		if err != nil || !enabled {
+			return s, err
+		}
+		return WrapWithWORM(s, opts), nil
+	}},
+	{"read_only", func(s Storage, v any) (Storage, error) {
+		readOnly, err := boolValue(v)
+		if err != nil || !readOnly {
+			return s, err
+		}
+		return WrapWithReadOnly(s), nil
+	}},
+}
+
+// splitDiskOptions separates the driver options from the wrapper options.
+func splitDiskOptions(opts map[string]any) (driver, wrappers map[string]any) {
+	driver = make(map[string]any, len(opts))
+	wrappers = make(map[string]any)
+	for k, v := range opts {
+		driver[k] = v
+	}
+	for _, o := range diskOptions {
+		if v, ok := driver[o.key]; ok {
+			wrappers[o.key] = v
+			delete(driver, o.key)
+		}
+	}
+	return driver, wrappers
+}
+
+// applyDiskOptions wraps s with the configured wrappers. s is closed if
+// an option is invalid.
+func applyDiskOptions(s Storage, wrappers map[string]any) (Storage, error) {
+	for _, o := range diskOptions {
+		v, ok := wrappers[o.key]
+		if !ok {
+			continue
+		}
+		w, err := o.wrap(s, v)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("%s: %w", o.key, err)
+		}
+		s = w
+	}
+	return s, nil
+}
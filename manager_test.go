@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestManager_AddRemoveDisk(t *testing.T) {
+	dir := t.TempDir()
+	err := Setup(map[string]any{"default": "main", "disks": map[string]any{
+		"main": map[string]any{"driver": "local", "root": filepath.Join(dir, "main")},
+	}})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	mgr := DefaultManager()
+
+	if err := mgr.AddDisk("tenant-1", trackedDisk(filepath.Join(dir, "tenant-1"))); err != nil {
+		t.Fatalf("AddDisk failed: %v", err)
+	}
+	if _, err := Disk("tenant-1").PutString("a.txt", "a"); err != nil {
+		t.Fatalf("Package-level Disk does not see the added disk: %v", err)
+	}
+	if err := mgr.AddDisk("tenant-1", trackedDisk(dir)); err == nil {
+		t.Error("Expected an error adding a duplicate disk")
+	}
+	if err := mgr.AddDisk("bad", StorageConfig{Driver: "local"}); err == nil || !strings.Contains(err.Error(), "root") {
+		t.Errorf("Expected an error for a disk that cannot open, got %v", err)
+	}
+
+	prebuilt := &closeTrackingStorage{Storage: newTestLocal(t)}
+	if err := mgr.Register("cache", prebuilt); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := mgr.Register("main", prebuilt); err == nil {
+		t.Error("Expected an error registering over a configured disk")
+	}
+	if err := mgr.AddDisk("backup", StorageConfig{Driver: "mirror", Options: map[string]any{"disks": []any{"main", "cache"}}}); err != nil {
+		t.Fatalf("AddDisk mirror failed: %v", err)
+	}
+	if got, want := mgr.Disks(), []string{"backup", "cache", "main", "tenant-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Disks() = %v, want %v", got, want)
+	}
+
+	if err := mgr.RemoveDisk("main"); err == nil {
+		t.Error("Expected an error removing the default disk")
+	}
+	if err := mgr.RemoveDisk("cache"); err == nil || !strings.Contains(err.Error(), `"backup"`) {
+		t.Errorf("Expected an error removing a disk in use, got %v", err)
+	}
+	tenant, _ := mgr.Disk("tenant-1")
+	if err := mgr.RemoveDisk("tenant-1"); err != nil {
+		t.Fatalf("RemoveDisk failed: %v", err)
+	}
+	waitClosed(t, tenant)
+	if _, err := Disk("tenant-1").PutString("a.txt", "a"); err == nil {
+		t.Error("Removed disk is still available")
+	}
+	if err := mgr.RemoveDisk("backup"); err != nil {
+		t.Fatalf("RemoveDisk failed: %v", err)
+	}
+	if err := mgr.RemoveDisk("cache"); err != nil {
+		t.Fatalf("RemoveDisk of a registered disk failed: %v", err)
+	}
+	waitClosed(t, prebuilt)
+	if got := mgr.Disks(); !reflect.DeepEqual(got, []string{"main"}) {
+		t.Errorf("Disks() = %v", got)
+	}
+}
+
+func TestManager_ConcurrentAddDisk(t *testing.T) {
+	dir := t.TempDir()
+	mgr := NewManager(&Config{})
+	defer mgr.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("tenant-%d", i)
+			if err := mgr.AddDisk(name, StorageConfig{Driver: "local", Options: map[string]any{"root": filepath.Join(dir, name)}}); err != nil {
+				t.Errorf("AddDisk failed: %v", err)
+				return
+			}
+			s, err := mgr.Disk(name)
+			if err != nil {
+				t.Errorf("Disk failed: %v", err)
+				return
+			}
+			if _, err := s.Upload(context.Background(), "a.txt", strings.NewReader("a")); err != nil {
+				t.Errorf("Upload failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(mgr.Disks()); n != 20 {
+		t.Errorf("Disks() has %d entries", n)
+	}
+}
@@ -0,0 +1,566 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterComposite("mirror", newMirrorFromConfig)
+	RegisterSchema("mirror", mirrorConfig{})
+}
+
+// MirrorConsistency selects when a mirrored write is reported successful.
+type MirrorConsistency string
+
+// Mirror consistency modes.
+const (
+	MirrorAll    MirrorConsistency = "all"    // Every disk must succeed
+	MirrorQuorum MirrorConsistency = "quorum" // A majority of disks must succeed
+	MirrorAsync  MirrorConsistency = "async"  // The primary must succeed; others are copied in the background
+)
+
+// RepairOp is the write that left a mirrored disk out of date.
+type RepairOp string
+
+// Repair operations.
+const (
+	RepairPut    RepairOp = "put"
+	RepairDelete RepairOp = "delete"
+)
+
+// RepairTask is a key that must be brought up to date on one disk.
+// Repairing copies the key's current state from Source: the object is
+// copied if it exists there and deleted otherwise.
+type RepairTask struct {
+	Disk     string   // Disk to repair
+	Source   string   // Disk holding the correct state
+	Key      string   // Object key
+	Op       RepairOp // The write that failed
+	Err      error    // Last failure
+	Attempts int
+	Added    time.Time
+}
+
+const mirrorWorkers = 4
+
+// MirrorStorage writes to several disks and reads from the first one that
+// answers. The first disk is the primary.
+//
+// Writes that fail on some disks while the operation as a whole succeeds
+// (quorum mode, or background copies in async mode) are kept in a repair
+// queue; see PendingRepairs and Repair.
+type MirrorStorage struct {
+	disks []NamedStorage
+	mode  MirrorConsistency
+
+	// Background copies are sharded by key so that writes to the same key
+	// are replicated in order.
+	queues []chan RepairTask
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	repairs map[[2]string]RepairTask // by disk and key
+}
+
+// NewMirrorStorage creates a mirror over disks; disks[0] is the primary.
+// The disks are not closed by Close.
+func NewMirrorStorage(mode MirrorConsistency, disks ...NamedStorage) (*MirrorStorage, error) {
+	switch mode {
+	case "":
+		mode = MirrorAll
+	case MirrorAll, MirrorQuorum, MirrorAsync:
+	default:
+		return nil, fmt.Errorf("storage: mirror: unknown consistency %q (want all, quorum or async)", mode)
+	}
+	if len(disks) == 0 {
+		return nil, fmt.Errorf("storage: mirror: no disks configured")
+	}
+
+	m := &MirrorStorage{
+		disks:   disks,
+		mode:    mode,
+		repairs: make(map[[2]string]RepairTask),
+	}
+	if mode == MirrorAsync && len(disks) > 1 {
+		m.queues = make([]chan RepairTask, mirrorWorkers)
+		for i := range m.queues {
+			m.queues[i] = make(chan RepairTask, 256)
+			m.wg.Add(1)
+			go m.worker(m.queues[i])
+		}
+	}
+	return m, nil
+}
+
+// newMirrorFromConfig creates a mirror from disk options:
+//
+//	disks: [aliyun, minio]  # child disks, the first is the primary
+//	consistency: all        # all, quorum or async
+func newMirrorFromConfig(disks DiskSource, cfg map[string]any) (Storage, error) {
+	var c mirrorConfig
+	if err := DecodeOptions(cfg, &c); err != nil {
+		return nil, fmt.Errorf("mirror: %w", err)
+	}
+	children, err := childDisks(disks, c.Disks)
+	if err != nil {
+		return nil, err
+	}
+	return NewMirrorStorage(c.Consistency, children...)
+}
+
+type mirrorConfig struct {
+	Disks       []string          `option:"disks,required,disk"`
+	Consistency MirrorConsistency `option:"consistency" enum:"all,quorum,async"`
+}
+
+func (m *MirrorStorage) primary() Storage {
+	return m.disks[0].Storage
+}
+
+// fanOut runs fn on every disk concurrently, or only on the primary in
+// async mode, and applies the consistency mode to the results. op and key
+// describe the write for errors and repair tasks.
+func (m *MirrorStorage) fanOut(op RepairOp, key string, fn func(i int, s Storage) error) error {
+	targets := len(m.disks)
+	if m.mode == MirrorAsync {
+		targets = 1
+	}
+
+	errs := make([]error, targets)
+	var wg sync.WaitGroup
+	for i := 0; i < targets; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i, m.disks[i].Storage)
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	source := -1
+	for i, err := range errs {
+		if err == nil {
+			ok++
+			if source < 0 {
+				source = i
+			}
+			m.clearRepair(m.disks[i].Name, key)
+		}
+	}
+
+	var required int
+	switch m.mode {
+	case MirrorAll, MirrorAsync:
+		required = targets
+	case MirrorQuorum:
+		required = len(m.disks)/2 + 1
+	}
+	if ok < required {
+		var failed []error
+		for i, err := range errs {
+			if err != nil {
+				failed = append(failed, fmt.Errorf("%s: %w", m.disks[i].Name, err))
+			}
+		}
+		return fmt.Errorf("storage: mirror: %s %q succeeded on %d of %d disks: %w",
+			op, key, ok, targets, errors.Join(failed...))
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			defaultLogger.Warn("mirror: %s %q failed on %s, queued for repair: %v", op, key, m.disks[i].Name, err)
+			m.addRepair(RepairTask{Disk: m.disks[i].Name, Source: m.disks[source].Name, Key: key, Op: op, Err: err})
+		}
+	}
+	if m.mode == MirrorAsync {
+		for _, d := range m.disks[1:] {
+			m.replicate(RepairTask{Disk: d.Name, Source: m.disks[0].Name, Key: key, Op: op})
+		}
+	}
+	return nil
+}
+
+// Upload writes to the disks according to the consistency mode.
+func (m *MirrorStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	if m.mode == MirrorAsync || len(m.disks) == 1 {
+		result, err := m.primary().Upload(ctx, key, reader, opts...)
+		if err != nil {
+			return nil, err
+		}
+		m.clearRepair(m.disks[0].Name, key)
+		for _, d := range m.disks[1:] {
+			m.replicate(RepairTask{Disk: d.Name, Source: m.disks[0].Name, Key: key, Op: RepairPut})
+		}
+		return result, nil
+	}
+
+	// Each disk reads the data independently, so it must be re-readable.
+	body, size, cleanup, err := mirrorBody(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	// Report progress once, from the primary.
+	replicaOpts := append(opts[:len(opts):len(opts)], WithProgress(nil))
+	results := make([]*UploadResult, len(m.disks))
+	err = m.fanOut(RepairPut, key, func(i int, s Storage) error {
+		o := opts
+		if i > 0 {
+			o = replicaOpts
+		}
+		var err error
+		results[i], err = s.Upload(ctx, key, io.NewSectionReader(body, 0, size), o...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r != nil {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("storage: mirror: upload %q returned no result", key)
+}
+
+// mirrorBody returns reader as an io.ReaderAt, spooling it to a temporary
+// file unless it already supports random access.
+func mirrorBody(reader io.Reader) (io.ReaderAt, int64, func(), error) {
+	if ra, ok := reader.(io.ReaderAt); ok {
+		if size, ok := readerSize(reader); ok {
+			if s, ok := reader.(io.Seeker); ok {
+				// Section readers start at offset 0; honor the current position.
+				if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+					return io.NewSectionReader(ra, pos, size), size, func() {}, nil
+				}
+			} else {
+				return ra, size, func() {}, nil
+			}
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "storage-mirror-*")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("storage: mirror: failed to create temp file: %w", err)
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("storage: mirror: failed to read upload: %w", err)
+	}
+	return tmp, size, cleanup, nil
+}
+
+// Delete deletes key from the disks according to the consistency mode.
+func (m *MirrorStorage) Delete(ctx context.Context, key string) error {
+	return m.fanOut(RepairDelete, key, func(i int, s Storage) error {
+		if err := s.Delete(ctx, key); err != nil && !IsNotFoundError(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// Copy copies src to dst on the disks according to the consistency mode.
+func (m *MirrorStorage) Copy(ctx context.Context, src, dst string) error {
+	return m.fanOut(RepairPut, dst, func(i int, s Storage) error {
+		adv, ok := s.(AdvancedStorage)
+		if !ok {
+			return ErrNotImplemented
+		}
+		return adv.Copy(ctx, src, dst)
+	})
+}
+
+// Move moves src to dst on the disks according to the consistency mode.
+func (m *MirrorStorage) Move(ctx context.Context, src, dst string) error {
+	errs := make([]error, len(m.disks))
+	err := m.fanOut(RepairPut, dst, func(i int, s Storage) error {
+		adv, ok := s.(AdvancedStorage)
+		if !ok {
+			errs[i] = ErrNotImplemented
+		} else {
+			errs[i] = adv.Move(ctx, src, dst)
+		}
+		return errs[i]
+	})
+	if err != nil {
+		return err
+	}
+
+	// src is gone where the move succeeded; make it go elsewhere too.
+	source := 0
+	for errs[source] != nil {
+		source++
+	}
+	for i, d := range m.disks {
+		t := RepairTask{Disk: d.Name, Source: m.disks[source].Name, Key: src, Op: RepairDelete, Err: errs[i]}
+		if errs[i] != nil {
+			m.addRepair(t)
+		} else if m.mode == MirrorAsync && i > 0 {
+			m.replicate(t)
+		}
+	}
+	return nil
+}
+
+// read calls fn on each disk in order until one succeeds.
+func (m *MirrorStorage) read(fn func(s Storage) error) error {
+	var first error
+	for _, d := range m.disks {
+		err := fn(d.Storage)
+		if err == nil {
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+		defaultLogger.Debug("mirror: read from %s failed: %v", d.Name, err)
+	}
+	return first
+}
+
+func (m *MirrorStorage) readAdvanced(fn func(s AdvancedStorage) error) error {
+	return m.read(func(s Storage) error {
+		adv, ok := s.(AdvancedStorage)
+		if !ok {
+			return ErrNotImplemented
+		}
+		return fn(adv)
+	})
+}
+
+// Download reads from the primary, falling back to the other disks.
+func (m *MirrorStorage) Download(ctx context.Context, key string) (rc io.ReadCloser, err error) {
+	err = m.read(func(s Storage) error {
+		rc, err = s.Download(ctx, key)
+		return err
+	})
+	return rc, err
+}
+
+// Exists checks the primary, falling back to the other disks on error.
+func (m *MirrorStorage) Exists(ctx context.Context, key string) (ok bool, err error) {
+	err = m.read(func(s Storage) error {
+		ok, err = s.Exists(ctx, key)
+		return err
+	})
+	return ok, err
+}
+
+// URL returns the URL on the primary, falling back to the other disks.
+func (m *MirrorStorage) URL(ctx context.Context, key string) (url string, err error) {
+	err = m.read(func(s Storage) error {
+		url, err = s.URL(ctx, key)
+		return err
+	})
+	return url, err
+}
+
+func (m *MirrorStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (url string, err error) {
+	err = m.readAdvanced(func(s AdvancedStorage) error {
+		url, err = s.SignedURL(ctx, key, expires)
+		return err
+	})
+	return url, err
+}
+
+func (m *MirrorStorage) List(ctx context.Context, prefix string, opts ...ListOption) (result *ListResult, err error) {
+	err = m.readAdvanced(func(s AdvancedStorage) error {
+		result, err = s.List(ctx, prefix, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (m *MirrorStorage) Size(ctx context.Context, key string) (size int64, err error) {
+	err = m.readAdvanced(func(s AdvancedStorage) error {
+		size, err = s.Size(ctx, key)
+		return err
+	})
+	return size, err
+}
+
+func (m *MirrorStorage) Metadata(ctx context.Context, key string) (info *FileInfo, err error) {
+	err = m.readAdvanced(func(s AdvancedStorage) error {
+		info, err = s.Metadata(ctx, key)
+		return err
+	})
+	return info, err
+}
+
+// replicate queues a background copy, falling back to the repair queue
+// when the mirror is closed or the copy queue is full.
+func (m *MirrorStorage) replicate(t RepairTask) {
+	t.Added = time.Now()
+	h := fnv.New32a()
+	h.Write([]byte(t.Key))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		t.Err = ErrClosed
+		m.repairs[[2]string{t.Disk, t.Key}] = t
+		return
+	}
+	select {
+	case m.queues[h.Sum32()%uint32(len(m.queues))] <- t:
+	default:
+		t.Err = errors.New("storage: mirror: copy queue full")
+		m.repairs[[2]string{t.Disk, t.Key}] = t
+	}
+}
+
+func (m *MirrorStorage) worker(tasks <-chan RepairTask) {
+	defer m.wg.Done()
+	for t := range tasks {
+		if err := m.sync(context.Background(), t); err != nil {
+			t.Err = err
+			t.Attempts++
+			defaultLogger.Warn("mirror: copying %q to %s failed, queued for repair: %v", t.Key, t.Disk, err)
+			m.addRepair(t)
+		}
+	}
+}
+
+func (m *MirrorStorage) addRepair(t RepairTask) {
+	if t.Added.IsZero() {
+		t.Added = time.Now()
+	}
+	m.mu.Lock()
+	m.repairs[[2]string{t.Disk, t.Key}] = t
+	m.mu.Unlock()
+}
+
+func (m *MirrorStorage) clearRepair(disk, key string) {
+	m.mu.Lock()
+	delete(m.repairs, [2]string{disk, key})
+	m.mu.Unlock()
+}
+
+func (m *MirrorStorage) byName(name string) (Storage, error) {
+	for _, d := range m.disks {
+		if d.Name == name {
+			return d.Storage, nil
+		}
+	}
+	return nil, fmt.Errorf("storage: mirror: unknown disk %q", name)
+}
+
+// sync copies the current state of t.Key from t.Source to t.Disk.
+func (m *MirrorStorage) sync(ctx context.Context, t RepairTask) error {
+	src, err := m.byName(t.Source)
+	if err != nil {
+		return err
+	}
+	dst, err := m.byName(t.Disk)
+	if err != nil {
+		return err
+	}
+
+	rc, err := src.Download(ctx, t.Key)
+	if IsNotFoundError(err) {
+		if err := dst.Delete(ctx, t.Key); err != nil && !IsNotFoundError(err) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var opts []UploadOption
+	if adv, ok := src.(AdvancedStorage); ok {
+		if info, err := adv.Metadata(ctx, t.Key); err == nil {
+			opts = append(opts, WithContentType(info.ContentType), WithMetadata(info.Metadata))
+			if info.StorageClass != "" {
+				opts = append(opts, WithStorageClass(info.StorageClass))
+			}
+		}
+	}
+	_, err = dst.Upload(ctx, t.Key, rc, opts...)
+	return err
+}
+
+// PendingRepairs returns the queued repairs, oldest first.
+func (m *MirrorStorage) PendingRepairs() []RepairTask {
+	m.mu.Lock()
+	tasks := make([]RepairTask, 0, len(m.repairs))
+	for _, t := range m.repairs {
+		tasks = append(tasks, t)
+	}
+	m.mu.Unlock()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Added.Before(tasks[j].Added) })
+	return tasks
+}
+
+// Repair retries the queued repairs. Repairs that fail again stay queued;
+// their errors are returned joined.
+func (m *MirrorStorage) Repair(ctx context.Context) error {
+	var errs []error
+	for _, t := range m.PendingRepairs() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := m.sync(ctx, t)
+
+		m.mu.Lock()
+		// Skip tasks replaced or cleared by a newer write meanwhile.
+		if cur, ok := m.repairs[[2]string{t.Disk, t.Key}]; ok && cur.Added.Equal(t.Added) {
+			if err == nil {
+				delete(m.repairs, [2]string{t.Disk, t.Key})
+			} else {
+				t.Err = err
+				t.Attempts++
+				m.repairs[[2]string{t.Disk, t.Key}] = t
+			}
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %q: %w", t.Disk, t.Key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping checks every disk, since writes go to all of them.
+func (m *MirrorStorage) Ping(ctx context.Context) error {
+	return pingDisks(ctx, m.disks...)
+}
+
+// Close waits for background copies to finish. The child disks are not
+// closed; copies that could not run stay in the repair queue.
+func (m *MirrorStorage) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	for _, q := range m.queues {
+		close(q)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+	return nil
+}
+
+var _ AdvancedStorage = (*MirrorStorage)(nil)
+var _ Pinger = (*MirrorStorage)(nil)
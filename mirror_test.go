@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyStorage fails every call while down is set.
+type flakyStorage struct {
+	Storage
+	down atomic.Bool
+}
+
+var errDown = errors.New("disk down")
+
+func (f *flakyStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	if f.down.Load() {
+		return nil, errDown
+	}
+	return f.Storage.Upload(ctx, key, reader, opts...)
+}
+
+func (f *flakyStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	if f.down.Load() {
+		return nil, errDown
+	}
+	return f.Storage.Download(ctx, key)
+}
+
+func (f *flakyStorage) Delete(ctx context.Context, key string) error {
+	if f.down.Load() {
+		return errDown
+	}
+	return f.Storage.Delete(ctx, key)
+}
+
+func (f *flakyStorage) Exists(ctx context.Context, key string) (bool, error) {
+	if f.down.Load() {
+		return false, errDown
+	}
+	return f.Storage.Exists(ctx, key)
+}
+
+func (f *flakyStorage) Ping(ctx context.Context) error {
+	if f.down.Load() {
+		return errDown
+	}
+	return Ping(ctx, f.Storage)
+}
+
+func readString(t *testing.T, s Storage, key string) string {
+	t.Helper()
+	rc, err := s.Download(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Download(%s) failed: %v", key, err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	return string(data)
+}
+
+func TestMirrorStorage_Setup(t *testing.T) {
+	mgr := NewManager(&Config{
+		Default: "backup",
+		Storages: map[string]StorageConfig{
+			"a":      {Driver: "local", Options: map[string]any{"root": t.TempDir()}},
+			"b":      {Driver: "local", Options: map[string]any{"root": t.TempDir()}},
+			"backup": {Driver: "mirror", Options: map[string]any{"disks": []any{"a", "b"}}},
+			"loop":   {Driver: "mirror", Options: map[string]any{"disks": "a, loop"}},
+		},
+	})
+	defer mgr.Close()
+	ctx := context.Background()
+
+	s, err := mgr.Disk("")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	if _, err := s.Upload(ctx, "x.txt", strings.NewReader("data")); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		child, _ := mgr.Disk(name)
+		if got := readString(t, child, "x.txt"); got != "data" {
+			t.Errorf("%s has %q, want %q", name, got, "data")
+		}
+	}
+
+	if _, err := mgr.Disk("loop"); err == nil || !strings.Contains(err.Error(), "references itself") {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+	if _, err := Open("mirror", nil); err == nil {
+		t.Error("Open should refuse composite drivers")
+	}
+}
+
+func TestMirrorStorage_Consistency(t *testing.T) {
+	ctx := context.Background()
+	newDisks := func() []*flakyStorage {
+		return []*flakyStorage{
+			{Storage: newTestLocal(t)}, {Storage: newTestLocal(t)}, {Storage: newTestLocal(t)},
+		}
+	}
+	named := func(disks []*flakyStorage) []NamedStorage {
+		return []NamedStorage{{"p", disks[0]}, {"r1", disks[1]}, {"r2", disks[2]}}
+	}
+
+	// all: one failure fails the write.
+	disks := newDisks()
+	m, _ := NewMirrorStorage(MirrorAll, named(disks)...)
+	disks[2].down.Store(true)
+	if _, err := m.Upload(ctx, "a.txt", strings.NewReader("a")); err == nil {
+		t.Error("all: Upload should fail when a disk is down")
+	}
+
+	// quorum: 2 of 3 is enough, the failed disk is queued for repair.
+	disks = newDisks()
+	m, _ = NewMirrorStorage(MirrorQuorum, named(disks)...)
+	disks[2].down.Store(true)
+	if _, err := m.Upload(ctx, "a.txt", io.MultiReader(strings.NewReader("quorum"))); err != nil {
+		t.Fatalf("quorum: Upload failed: %v", err)
+	}
+	if repairs := m.PendingRepairs(); len(repairs) != 1 || repairs[0].Disk != "r2" || repairs[0].Op != RepairPut {
+		t.Fatalf("quorum: unexpected repairs %+v", repairs)
+	}
+	if err := m.Repair(ctx); err == nil {
+		t.Error("Repair should fail while the disk is down")
+	}
+	disks[2].down.Store(false)
+	if err := m.Repair(ctx); err != nil || len(m.PendingRepairs()) != 0 {
+		t.Fatalf("Repair failed: %v, pending %+v", err, m.PendingRepairs())
+	}
+	if got := readString(t, disks[2], "a.txt"); got != "quorum" {
+		t.Errorf("Repaired disk has %q", got)
+	}
+
+	// Reads fall back when the primary is down.
+	disks[0].down.Store(true)
+	if got := readString(t, m, "a.txt"); got != "quorum" {
+		t.Errorf("Fallback read = %q", got)
+	}
+}
+
+func TestMirrorStorage_Async(t *testing.T) {
+	ctx := context.Background()
+	primary := newTestLocal(t)
+	replica := &flakyStorage{Storage: newTestLocal(t)}
+	m, _ := NewMirrorStorage(MirrorAsync, NamedStorage{"p", primary}, NamedStorage{"r", replica})
+
+	m.Upload(ctx, "a.txt", strings.NewReader("async"), WithContentType("text/plain"), WithMetadata(map[string]string{"k": "v"}))
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if ok, _ := replica.Exists(ctx, "a.txt"); ok || time.Now().After(deadline) {
+			break
+		}
+	}
+	replica.down.Store(true)
+	m.Upload(ctx, "b.txt", strings.NewReader("lost"))
+	m.Close() // Waits for background copies
+
+	if got := readString(t, replica.Storage, "a.txt"); got != "async" {
+		t.Errorf("Replica has %q", got)
+	}
+	info, _ := replica.Storage.(AdvancedStorage).Metadata(ctx, "a.txt")
+	if info.ContentType != "text/plain" || info.Metadata["k"] != "v" {
+		t.Errorf("Replica metadata = %+v", info)
+	}
+
+	repairs := m.PendingRepairs()
+	if len(repairs) != 1 || repairs[0].Key != "b.txt" || !errors.Is(repairs[0].Err, errDown) {
+		t.Fatalf("Unexpected repairs %+v", repairs)
+	}
+	replica.down.Store(false)
+	if err := m.Repair(ctx); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if got := readString(t, replica, "b.txt"); got != "lost" {
+		t.Errorf("Repaired replica has %q", got)
+	}
+}
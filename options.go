@@ -0,0 +1,401 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OptionUnmarshaler is implemented by option types that decode themselves
+// from a raw config value, such as ServerSideEncryption.
+type OptionUnmarshaler interface {
+	UnmarshalOption(v any) error
+}
+
+// DecodeOptions decodes disk options into the struct pointed to by dst,
+// using struct tags:
+//
+//	type Config struct {
+//	    Bucket  string        `option:"bucket,required" env:"OSS_BUCKET"`
+//	    Region  string        `option:"region" default:"us-east-1"`
+//	    Timeout time.Duration `option:"timeout" default:"30s"`
+//	    MaxSize int64         `option:"max_size,size"`
+//	    Secret  string        `option:"secret_key,required,secret"`
+//	    Mode    string        `option:"mode" enum:"fast,safe"`
+//	}
+//
+// A field is filled from its option, then from the first non-empty
+// environment variable listed in env, then from default. Fields marked
+// required must end up non-zero, and string fields with an enum tag must
+// hold one of the listed values. The secret and disk flags only describe
+// the option (see OptionSpec). Fields without an option tag are not
+// decoded; embedded structs are decoded as part of the outer struct.
+//
+// Values are coerced to the field type: numbers and numeric strings
+// ("0644" is octal) to integers and floats, "true"/"yes"/"on" and 1/0 to
+// booleans, "30s" or a number of seconds to time.Duration, a list or a
+// comma-separated string to []string, and with the size flag "10MB" to a
+// byte count. Keys that match no field are reported as errors.
+func DecodeOptions(opts map[string]any, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("storage: DecodeOptions needs a pointer to a struct, got %T", dst)
+	}
+
+	fields := optionFields(rv.Elem().Type())
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.Name] = true
+	}
+	var unknown []string
+	for key := range opts {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown option %s", strings.Join(quoteAll(unknown), ", "))
+	}
+
+	for _, f := range fields {
+		v, ok := opts[f.Name]
+		if s, isString := v.(string); v == nil || isString && s == "" {
+			ok = false
+		}
+		if !ok {
+			for _, env := range f.Env {
+				if s := os.Getenv(env); s != "" {
+					v, ok = s, true
+					break
+				}
+			}
+		}
+		if !ok && f.Default != "" {
+			v, ok = f.Default, true
+		}
+
+		field := rv.Elem().FieldByIndex(f.index)
+		if ok {
+			if err := setOption(field, v, f.Type == "size"); err != nil {
+				return fmt.Errorf("option %q: %w", f.Name, err)
+			}
+			if len(f.Enum) > 0 && !slices.Contains(f.Enum, field.String()) {
+				return fmt.Errorf("option %q: %q is not one of %s", f.Name, field.String(), strings.Join(f.Enum, ", "))
+			}
+		}
+		if f.Required && field.IsZero() {
+			if len(f.Env) > 0 {
+				return fmt.Errorf("option %q is required (or set %s)", f.Name, strings.Join(f.Env, " or "))
+			}
+			return fmt.Errorf("option %q is required", f.Name)
+		}
+	}
+	return nil
+}
+
+// OptionSpec describes an option decoded by DecodeOptions, as listed by
+// DescribeDriver.
+type OptionSpec struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // "string", "bool", "int", "number", "duration", "size", "object", "any" or "[]" and an element type
+	Required bool     `json:"required,omitempty"`
+	Secret   bool     `json:"secret,omitempty"` // A credential that should be masked when displayed
+	Disk     bool     `json:"disk,omitempty"`   // Names other disks of the Manager
+	Default  string   `json:"default,omitempty"`
+	Env      []string `json:"env,omitempty"`  // Environment variables read when the option is not set
+	Enum     []string `json:"enum,omitempty"` // Allowed values, if restricted
+
+	index []int
+}
+
+// optionFields lists the options of a struct type in field order.
+func optionFields(t reflect.Type) []OptionSpec {
+	var fields []OptionSpec
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("option")
+		if sf.Anonymous && !tagged && sf.Type.Kind() == reflect.Struct {
+			for _, inner := range optionFields(sf.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if !tagged || tag == "-" || !sf.IsExported() {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		f := OptionSpec{
+			Name:    name,
+			Type:    optionType(sf.Type),
+			Default: sf.Tag.Get("default"),
+			index:   []int{i},
+		}
+		for _, flag := range strings.Split(flags, ",") {
+			switch flag {
+			case "required":
+				f.Required = true
+			case "size":
+				f.Type = "size"
+			case "secret":
+				f.Secret = true
+			case "disk":
+				f.Disk = true
+			}
+		}
+		if env := sf.Tag.Get("env"); env != "" {
+			f.Env = strings.Split(env, ",")
+		}
+		if enum := sf.Tag.Get("enum"); enum != "" {
+			f.Enum = strings.Split(enum, ",")
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*OptionUnmarshaler)(nil)).Elem()
+)
+
+func optionType(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration"
+	case reflect.PointerTo(t).Implements(unmarshalerType), t.Kind() == reflect.Pointer && t.Implements(unmarshalerType):
+		return "object"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "[]" + optionType(t.Elem())
+	case reflect.Map, reflect.Interface:
+		return "any"
+	}
+	return t.Kind().String()
+}
+
+// setOption stores the config value v in field.
+func setOption(field reflect.Value, v any, size bool) error {
+	if field.Kind() == reflect.Pointer && field.Type().Implements(unmarshalerType) {
+		p := reflect.New(field.Type().Elem())
+		if err := p.Interface().(OptionUnmarshaler).UnmarshalOption(v); err != nil {
+			return err
+		}
+		field.Set(p)
+		return nil
+	}
+	if field.CanAddr() && field.Addr().Type().Implements(unmarshalerType) {
+		return field.Addr().Interface().(OptionUnmarshaler).UnmarshalOption(v)
+	}
+
+	if field.Type() == durationType {
+		d, err := durationValue(v)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		switch t := v.(type) {
+		case string:
+			field.SetString(t)
+		case int, int64, float64, bool:
+			field.SetString(fmt.Sprint(t))
+		default:
+			return fmt.Errorf("expected a string, got %T", v)
+		}
+
+	case reflect.Bool:
+		b, err := boolValue(v)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := intValue(v, size)
+		if err != nil {
+			return err
+		}
+		if field.OverflowInt(n) {
+			return fmt.Errorf("%d is out of range", n)
+		}
+		field.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := intValue(v, size)
+		if err != nil {
+			return err
+		}
+		if n < 0 || field.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%d is out of range", n)
+		}
+		field.SetUint(uint64(n))
+
+	case reflect.Float32, reflect.Float64:
+		f, err := floatValue(v)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported option type %s", field.Type())
+		}
+		list, err := stringList(v)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(list).Convert(field.Type()))
+
+	case reflect.Map, reflect.Interface:
+		rv := reflect.ValueOf(v)
+		if !rv.Type().AssignableTo(field.Type()) {
+			return fmt.Errorf("expected %s, got %T", field.Type(), v)
+		}
+		field.Set(rv)
+
+	default:
+		return fmt.Errorf("unsupported option type %s", field.Type())
+	}
+	return nil
+}
+
+func boolValue(v any) (bool, error) {
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case int:
+		if t == 0 || t == 1 {
+			return t == 1, nil
+		}
+	case float64:
+		if t == 0 || t == 1 {
+			return t == 1, nil
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(t)) {
+		case "true", "yes", "on", "1":
+			return true, nil
+		case "false", "no", "off", "0":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("expected a boolean, got %v", v)
+}
+
+// durationValue reads a duration given as a string ("30s") or a number of
+// seconds.
+func durationValue(v any) (time.Duration, error) {
+	switch t := v.(type) {
+	case string:
+		if d, err := time.ParseDuration(t); err == nil {
+			return d, nil
+		}
+		// A bare number of seconds, e.g. from an environment variable.
+		if secs, err := strconv.ParseFloat(t, 64); err == nil {
+			return time.Duration(secs * float64(time.Second)), nil
+		}
+	case int:
+		return time.Duration(t) * time.Second, nil
+	case float64:
+		return time.Duration(t * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("expected a duration such as \"30s\", got %v", v)
+}
+
+// parseSize reads a byte size such as "512KB" or "10MB". Units are powers
+// of 1024; "KiB" and "MiB" are accepted too.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	unit := strings.TrimLeft(num, "0123456789.")
+	num = strings.TrimSpace(num[:len(num)-len(unit)])
+	var mult float64
+	switch strings.ToUpper(strings.TrimSpace(unit)) {
+	case "", "B":
+		mult = 1
+	case "K", "KB", "KIB":
+		mult = 1 << 10
+	case "M", "MB", "MIB":
+		mult = 1 << 20
+	case "G", "GB", "GIB":
+		mult = 1 << 30
+	case "T", "TB", "TIB":
+		mult = 1 << 40
+	default:
+		return 0, fmt.Errorf("unknown size unit in %q", s)
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
+
+func intValue(v any, size bool) (int64, error) {
+	if s, ok := v.(string); ok && size {
+		return parseSize(s)
+	}
+	switch t := v.(type) {
+	case int:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case uint64:
+		if t <= math.MaxInt64 {
+			return int64(t), nil
+		}
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1<<63 {
+			return int64(t), nil
+		}
+		return 0, fmt.Errorf("expected an integer, got %v", t)
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(t), 0, 64)
+		if err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("expected an integer, got %v", v)
+}
+
+func floatValue(v any) (float64, error) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), nil
+	case int64:
+		return float64(t), nil
+	case float64:
+		return t, nil
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("expected a number, got %v", v)
+}
+
+func quoteAll(s []string) []string {
+	out := make([]string, len(s))
+	for i, v := range s {
+		out[i] = strconv.Quote(v)
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type testOptions struct {
+	Bucket  string                `option:"bucket,required" env:"TEST_OPT_BUCKET,TEST_OPT_BUCKET2"`
+	Region  string                `option:"region" default:"us-east-1"`
+	Timeout time.Duration         `option:"timeout" default:"30s"`
+	MaxSize int64                 `option:"max_size,size"`
+	Perm    uint32                `option:"perm"`
+	Ratio   float64               `option:"ratio"`
+	Secure  bool                  `option:"secure"`
+	Tags    []string              `option:"tags"`
+	SSE     *ServerSideEncryption `option:"sse"`
+}
+
+func TestDecodeOptions_Coercion(t *testing.T) {
+	var o testOptions
+	err := DecodeOptions(map[string]any{
+		"bucket":   "b",
+		"timeout":  90,
+		"max_size": "10MB",
+		"perm":     "0644",
+		"ratio":    "0.5",
+		"secure":   "yes",
+		"tags":     "a, b",
+		"sse":      "managed",
+	}, &o)
+	if err != nil {
+		t.Fatalf("DecodeOptions failed: %v", err)
+	}
+	if o.Region != "us-east-1" || o.Timeout != 90*time.Second || o.MaxSize != 10<<20 || o.Perm != 0644 ||
+		o.Ratio != 0.5 || !o.Secure || len(o.Tags) != 2 || o.Tags[1] != "b" || o.SSE == nil || o.SSE.Type != SSEManaged {
+		t.Errorf("Unexpected options: %+v", o)
+	}
+}
+
+func TestDecodeOptions_Env(t *testing.T) {
+	t.Setenv("TEST_OPT_BUCKET2", "from-env")
+	var o testOptions
+	if err := DecodeOptions(map[string]any{"bucket": ""}, &o); err != nil {
+		t.Fatalf("DecodeOptions failed: %v", err)
+	}
+	if o.Bucket != "from-env" {
+		t.Errorf("Bucket = %q", o.Bucket)
+	}
+}
+
+func TestDecodeOptions_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts map[string]any
+		want string
+	}{
+		{"required", map[string]any{}, `option "bucket" is required (or set TEST_OPT_BUCKET or TEST_OPT_BUCKET2)`},
+		{"unknown", map[string]any{"bucket": "b", "regoin": "x", "acl": "y"}, `unknown option "acl", "regoin"`},
+		{"bool", map[string]any{"bucket": "b", "secure": "maybe"}, `option "secure"`},
+		{"int", map[string]any{"bucket": "b", "perm": 1.5}, "expected an integer"},
+		{"size", map[string]any{"bucket": "b", "max_size": "10XB"}, "unknown size unit"},
+		{"duration", map[string]any{"bucket": "b", "timeout": "soon"}, "expected a duration"},
+		{"sse", map[string]any{"bucket": "b", "sse": "rot13"}, `option "sse"`},
+	}
+	for _, tt := range tests {
+		var o testOptions
+		err := DecodeOptions(tt.opts, &o)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeOptions_Embedded(t *testing.T) {
+	var c failoverConfig
+	err := DecodeOptions(map[string]any{"disks": []any{"a", "b"}, "window": 5}, &c)
+	if err != nil {
+		t.Fatalf("DecodeOptions failed: %v", err)
+	}
+	if len(c.Disks) != 2 || c.Window != 5 {
+		t.Errorf("Unexpected config: %+v", c)
+	}
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReadOnlyStorage refuses every call that modifies the wrapped storage
+// with ErrPermission. Reads, URLs, listing and Restore are allowed.
+type ReadOnlyStorage struct {
+	wrapped
+}
+
+// WrapWithReadOnly makes a storage read-only.
+func WrapWithReadOnly(s Storage) *ReadOnlyStorage {
+	return &ReadOnlyStorage{wrapped{s}}
+}
+
+func readOnlyError(op, key string) error {
+	return fmt.Errorf("%w: %s %q: storage is read-only", ErrPermission, op, key)
+}
+
+func (r *ReadOnlyStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	return nil, readOnlyError("upload", key)
+}
+
+func (r *ReadOnlyStorage) Delete(ctx context.Context, key string) error {
+	return readOnlyError("delete", key)
+}
+
+func (r *ReadOnlyStorage) Copy(ctx context.Context, src, dst string) error {
+	return readOnlyError("copy to", dst)
+}
+
+func (r *ReadOnlyStorage) Move(ctx context.Context, src, dst string) error {
+	return readOnlyError("move", src)
+}
+
+func (r *ReadOnlyStorage) SetStorageClass(ctx context.Context, key string, class StorageClass) error {
+	return readOnlyError("set storage class of", key)
+}
+
+var _ AdvancedStorage = (*ReadOnlyStorage)(nil)
+var _ ArchiveStorage = (*ReadOnlyStorage)(nil)
+
+// WORMOptions configures WORMStorage.
+type WORMOptions struct {
+	Retention time.Duration `option:"retention"` // How long an object is protected after it is written (0 = forever)
+}
+
+// WORMStorage makes a storage write-once: an existing object cannot be
+// overwritten, deleted or moved until Retention has passed since it was
+// last modified. Refused calls return ErrPermission.
+//
+// The age of an object is read with Metadata. Objects whose age cannot be
+// determined, because the storage does not report it, are treated as
+// protected, and a write is refused if the check itself fails. Checks are
+// serialized per key within the process only; buckets shared with other
+// writers should also enable the provider's object lock.
+type WORMStorage struct {
+	wrapped
+	opts  WORMOptions
+	keyMu [64]sync.Mutex
+}
+
+// WrapWithWORM makes a storage write-once.
+func WrapWithWORM(s Storage, opts WORMOptions) *WORMStorage {
+	return &WORMStorage{wrapped: wrapped{s}, opts: opts}
+}
+
+// lockKeys locks the stripes of keys in a fixed order and returns a
+// function unlocking them.
+func (w *WORMStorage) lockKeys(keys ...string) func() {
+	var stripes []int
+	for _, key := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		stripes = append(stripes, int(h.Sum32()%uint32(len(w.keyMu))))
+	}
+	sort.Ints(stripes)
+	var locked []int
+	for i, s := range stripes {
+		if i == 0 || s != stripes[i-1] {
+			w.keyMu[s].Lock()
+			locked = append(locked, s)
+		}
+	}
+	return func() {
+		for _, s := range locked {
+			w.keyMu[s].Unlock()
+		}
+	}
+}
+
+// check returns an error if key exists and is still under retention.
+func (w *WORMStorage) check(ctx context.Context, op, key string) error {
+	var modified time.Time
+	info, err := w.wrapped.Metadata(ctx, key)
+	switch {
+	case err == nil:
+		modified = info.LastModified
+	case IsNotFoundError(err):
+		return nil
+	case errors.Is(err, ErrNotImplemented):
+		exists, err := w.Storage.Exists(ctx, key)
+		if err != nil {
+			return fmt.Errorf("storage: %s %q: failed to check retention: %w", op, key, err)
+		}
+		if !exists {
+			return nil
+		}
+	default:
+		// Only a missing object may be written; any other error refuses.
+		return fmt.Errorf("storage: %s %q: failed to check retention: %w", op, key, err)
+	}
+	if w.opts.Retention <= 0 || modified.IsZero() {
+		return fmt.Errorf("%w: %s %q: object is write-once", ErrPermission, op, key)
+	}
+	if until := modified.Add(w.opts.Retention); time.Now().Before(until) {
+		return fmt.Errorf("%w: %s %q: object is retained until %s",
+			ErrPermission, op, key, until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Upload writes key unless an object under retention exists there.
+func (w *WORMStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	defer w.lockKeys(key)()
+	if err := w.check(ctx, "overwrite", key); err != nil {
+		return nil, err
+	}
+	return w.Storage.Upload(ctx, key, reader, opts...)
+}
+
+// Delete deletes key once its retention has passed.
+func (w *WORMStorage) Delete(ctx context.Context, key string) error {
+	defer w.lockKeys(key)()
+	if err := w.check(ctx, "delete", key); err != nil {
+		return err
+	}
+	return w.Storage.Delete(ctx, key)
+}
+
+// Copy copies src to dst unless an object under retention exists at dst.
+func (w *WORMStorage) Copy(ctx context.Context, src, dst string) error {
+	defer w.lockKeys(dst)()
+	if err := w.check(ctx, "overwrite", dst); err != nil {
+		return err
+	}
+	return w.wrapped.Copy(ctx, src, dst)
+}
+
+// Move moves src to dst once src's retention has passed, unless an object
+// under retention exists at dst.
+func (w *WORMStorage) Move(ctx context.Context, src, dst string) error {
+	defer w.lockKeys(src, dst)()
+	if err := w.check(ctx, "move", src); err != nil {
+		return err
+	}
+	if err := w.check(ctx, "overwrite", dst); err != nil {
+		return err
+	}
+	return w.wrapped.Move(ctx, src, dst)
+}
+
+// parseWORM reads the worm disk option: a bool, true keeping objects
+// forever, or a map such as {retention: 2160h}.
+func parseWORM(v any) (opts WORMOptions, enabled bool, err error) {
+	switch t := v.(type) {
+	case bool:
+		return WORMOptions{}, t, nil
+	case map[string]any:
+		err = DecodeOptions(t, &opts)
+		return opts, err == nil, err
+	}
+	return WORMOptions{}, false, fmt.Errorf("expected a bool or a map, got %T", v)
+}
+
+var _ AdvancedStorage = (*WORMStorage)(nil)
+var _ ArchiveStorage = (*WORMStorage)(nil)
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyStorage(t *testing.T) {
+	ctx := context.Background()
+	inner := newTestLocal(t)
+	inner.Upload(ctx, "a.txt", strings.NewReader("a"))
+	s := WrapWithReadOnly(inner)
+
+	if got := readString(t, s, "a.txt"); got != "a" {
+		t.Errorf("Download = %q", got)
+	}
+	if _, err := s.List(ctx, ""); err != nil {
+		t.Errorf("List failed: %v", err)
+	}
+	_, err := s.Upload(ctx, "b.txt", strings.NewReader("b"))
+	for name, err := range map[string]error{
+		"upload": err,
+		"delete": s.Delete(ctx, "a.txt"),
+		"copy":   s.Copy(ctx, "a.txt", "b.txt"),
+		"move":   s.Move(ctx, "a.txt", "b.txt"),
+		"class":  s.SetStorageClass(ctx, "a.txt", StorageClassArchive),
+	} {
+		if !errors.Is(err, ErrPermission) {
+			t.Errorf("%s = %v, want ErrPermission", name, err)
+		}
+	}
+	if ok, _ := inner.Exists(ctx, "a.txt"); !ok {
+		t.Error("a.txt should still exist")
+	}
+}
+
+func TestWORMStorage(t *testing.T) {
+	ctx := context.Background()
+	inner := newTestLocal(t)
+	s := WrapWithWORM(inner, WORMOptions{Retention: time.Hour})
+
+	if _, err := s.Upload(ctx, "audit.log", strings.NewReader("v1")); err != nil {
+		t.Fatalf("First upload failed: %v", err)
+	}
+	if _, err := s.Upload(ctx, "audit.log", strings.NewReader("v2")); !errors.Is(err, ErrPermission) {
+		t.Errorf("Overwrite = %v, want ErrPermission", err)
+	}
+	if err := s.Delete(ctx, "audit.log"); !errors.Is(err, ErrPermission) {
+		t.Errorf("Delete = %v, want ErrPermission", err)
+	}
+	if err := s.Move(ctx, "audit.log", "moved.log"); !errors.Is(err, ErrPermission) {
+		t.Errorf("Move = %v, want ErrPermission", err)
+	}
+	if err := s.Copy(ctx, "audit.log", "copy.log"); err != nil {
+		t.Errorf("Copy to a new key failed: %v", err)
+	}
+	if got := readString(t, s, "audit.log"); got != "v1" {
+		t.Errorf("audit.log = %q, want v1", got)
+	}
+
+	// Once the retention has passed the object can be removed.
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(inner.fullPath("audit.log"), old, old)
+	if err := s.Delete(ctx, "audit.log"); err != nil {
+		t.Errorf("Delete after retention failed: %v", err)
+	}
+
+	forever := WrapWithWORM(inner, WORMOptions{})
+	os.Chtimes(inner.fullPath("copy.log"), old, old)
+	if err := forever.Delete(ctx, "copy.log"); !errors.Is(err, ErrPermission) {
+		t.Errorf("Delete without retention = %v, want ErrPermission", err)
+	}
+}
+
+// metadataErrorStorage fails Metadata with an error other than not found.
+type metadataErrorStorage struct {
+	*localStorage
+}
+
+func (m metadataErrorStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	return nil, errDown
+}
+
+func TestWORMStorage_CheckFails(t *testing.T) {
+	ctx := context.Background()
+	for _, inner := range []Storage{
+		metadataErrorStorage{newTestLocal(t)},
+		&flakyStorage{Storage: newTestLocal(t)}, // No Metadata: checked with Exists
+	} {
+		if f, ok := inner.(*flakyStorage); ok {
+			f.down.Store(true)
+		}
+		s := WrapWithWORM(inner, WORMOptions{Retention: time.Hour})
+		if _, err := s.Upload(ctx, "audit.log", strings.NewReader("v1")); !errors.Is(err, errDown) {
+			t.Errorf("Upload on %T = %v, want the check error", inner, err)
+		}
+		if err := s.Delete(ctx, "audit.log"); !errors.Is(err, errDown) {
+			t.Errorf("Delete on %T = %v, want the check error", inner, err)
+		}
+	}
+}
+
+func TestPolicyOptions_Setup(t *testing.T) {
+	mgr := NewManager(&Config{
+		Storages: map[string]StorageConfig{
+			"archive": {Driver: "local", Options: map[string]any{
+				"root": t.TempDir(),
+				"worm": map[string]any{"retention": "2160h"},
+			}},
+			"readonly": {Driver: "local", Options: map[string]any{"root": t.TempDir(), "read_only": true}},
+			"writable": {Driver: "local", Options: map[string]any{"root": t.TempDir(), "read_only": false}},
+			"fromenv":  {Driver: "local", Options: map[string]any{"root": t.TempDir(), "read_only": "true"}},
+			"bad":      {Driver: "local", Options: map[string]any{"root": t.TempDir(), "read_only": "maybe"}},
+		},
+	})
+	defer mgr.Close()
+
+	if s, err := mgr.Disk("archive"); err != nil || s.(*WORMStorage).opts.Retention != 2160*time.Hour {
+		t.Errorf("archive = %T, %v; want WORM with 90 days retention", s, err)
+	}
+	if s, err := mgr.Disk("readonly"); err != nil {
+		t.Errorf("Disk failed: %v", err)
+	} else if _, ok := s.(*ReadOnlyStorage); !ok {
+		t.Errorf("readonly = %T", s)
+	}
+	if s, err := mgr.Disk("fromenv"); err != nil {
+		t.Errorf("Disk failed: %v", err)
+	} else if _, ok := s.(*ReadOnlyStorage); !ok {
+		t.Errorf("fromenv = %T, want read-only from a string option", s)
+	}
+	if s, err := mgr.Disk("writable"); err != nil {
+		t.Errorf("Disk failed: %v", err)
+	} else if _, ok := s.(*localStorage); !ok {
+		t.Errorf("writable = %T, want the plain driver", s)
+	}
+	if _, err := mgr.Disk("bad"); err == nil || !strings.Contains(err.Error(), "read_only") {
+		t.Errorf("Expected a read_only error, got %v", err)
+	}
+}
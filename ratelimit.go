@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit configures RateLimitedStorage. Zero fields are unlimited.
+type RateLimit struct {
+	OpsPerSecond   float64 `option:"ops_per_second"`        // Operations started per second
+	Burst          int     `option:"burst"`                 // Operations allowed at once above the rate (default: one second's worth)
+	BytesPerSecond int64   `option:"bytes_per_second,size"` // Upload and download throughput
+	MaxConcurrent  int     `option:"max_concurrent"`        // Operations in flight at once
+}
+
+// tokenBucket is a token bucket that lets callers reserve tokens ahead,
+// so a request larger than the burst waits instead of failing.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes n tokens, waiting until they are available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context, n float64) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= n
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give back the reservation.
+		b.mu.Lock()
+		b.tokens += n
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// RateLimitedStorage wraps a Storage with token-bucket rate limits on
+// operations and bytes transferred, and an optional concurrency limit.
+// Calls wait for capacity until their context is done.
+type RateLimitedStorage struct {
+	wrapped
+	ops   *tokenBucket
+	bytes *tokenBucket
+	sem   chan struct{}
+}
+
+// WrapWithRateLimit wraps a storage with rate limits.
+func WrapWithRateLimit(s Storage, limit RateLimit) *RateLimitedStorage {
+	r := &RateLimitedStorage{wrapped: wrapped{s}}
+	if limit.OpsPerSecond > 0 {
+		r.ops = newTokenBucket(limit.OpsPerSecond, float64(limit.Burst))
+	}
+	if limit.BytesPerSecond > 0 {
+		r.bytes = newTokenBucket(float64(limit.BytesPerSecond), 0)
+	}
+	if limit.MaxConcurrent > 0 {
+		r.sem = make(chan struct{}, limit.MaxConcurrent)
+	}
+	return r
+}
+
+// parseRateLimit reads a RateLimit from a disk config value:
+//
+//	rate_limit:
+//	  ops_per_second: 100
+//	  burst: 20
+//	  bytes_per_second: 10MB
+//	  max_concurrent: 16
+func parseRateLimit(v any) (RateLimit, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return RateLimit{}, fmt.Errorf("expected a map, got %T", v)
+	}
+	var limit RateLimit
+	err := DecodeOptions(m, &limit)
+	return limit, err
+}
+
+// acquire waits for an operation slot and returns a function releasing it.
+func (r *RateLimitedStorage) acquire(ctx context.Context) (func(), error) {
+	if r.sem != nil {
+		select {
+		case r.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if r.sem != nil {
+			<-r.sem
+		}
+	}
+	if r.ops != nil {
+		if err := r.ops.wait(ctx, 1); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// limit runs fn once an operation slot is available.
+func limit[T any](ctx context.Context, r *RateLimitedStorage, fn func() (T, error)) (T, error) {
+	release, err := r.acquire(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer release()
+	return fn()
+}
+
+type rateLimitedReader struct {
+	r      io.Reader
+	ctx    context.Context
+	bucket *tokenBucket
+}
+
+func (l *rateLimitedReader) Read(p []byte) (int, error) {
+	if max := int(l.bucket.burst); len(p) > max {
+		p = p[:max]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if werr := l.bucket.wait(l.ctx, float64(n)); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (r *RateLimitedStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	return limit(ctx, r, func() (*UploadResult, error) {
+		if r.bytes != nil {
+			reader = &rateLimitedReader{r: reader, ctx: ctx, bucket: r.bytes}
+		}
+		return r.Storage.Upload(ctx, key, reader, opts...)
+	})
+}
+
+// Download limits the rate at which the returned reader can be read. The
+// operation slot is released when the download starts.
+func (r *RateLimitedStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return limit(ctx, r, func() (io.ReadCloser, error) {
+		rc, err := r.Storage.Download(ctx, key)
+		if err != nil || r.bytes == nil {
+			return rc, err
+		}
+		return &multiReadCloser{
+			Reader: &rateLimitedReader{r: rc, ctx: ctx, bucket: r.bytes},
+			Closer: rc,
+		}, nil
+	})
+}
+
+func (r *RateLimitedStorage) Delete(ctx context.Context, key string) error {
+	_, err := limit(ctx, r, func() (struct{}, error) {
+		return struct{}{}, r.Storage.Delete(ctx, key)
+	})
+	return err
+}
+
+func (r *RateLimitedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	return limit(ctx, r, func() (bool, error) {
+		return r.Storage.Exists(ctx, key)
+	})
+}
+
+func (r *RateLimitedStorage) URL(ctx context.Context, key string) (string, error) {
+	return limit(ctx, r, func() (string, error) {
+		return r.Storage.URL(ctx, key)
+	})
+}
+
+func (r *RateLimitedStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return limit(ctx, r, func() (string, error) {
+		return r.wrapped.SignedURL(ctx, key, expires)
+	})
+}
+
+func (r *RateLimitedStorage) List(ctx context.Context, prefix string, opts ...ListOption) (*ListResult, error) {
+	return limit(ctx, r, func() (*ListResult, error) {
+		return r.wrapped.List(ctx, prefix, opts...)
+	})
+}
+
+func (r *RateLimitedStorage) Copy(ctx context.Context, src, dst string) error {
+	_, err := limit(ctx, r, func() (struct{}, error) {
+		return struct{}{}, r.wrapped.Copy(ctx, src, dst)
+	})
+	return err
+}
+
+func (r *RateLimitedStorage) Move(ctx context.Context, src, dst string) error {
+	_, err := limit(ctx, r, func() (struct{}, error) {
+		return struct{}{}, r.wrapped.Move(ctx, src, dst)
+	})
+	return err
+}
+
+func (r *RateLimitedStorage) Size(ctx context.Context, key string) (int64, error) {
+	return limit(ctx, r, func() (int64, error) {
+		return r.wrapped.Size(ctx, key)
+	})
+}
+
+func (r *RateLimitedStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	return limit(ctx, r, func() (*FileInfo, error) {
+		return r.wrapped.Metadata(ctx, key)
+	})
+}
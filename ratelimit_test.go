@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedStorage_Ops(t *testing.T) {
+	ctx := context.Background()
+	s := WrapWithRateLimit(newTestLocal(t), RateLimit{OpsPerSecond: 20, Burst: 2})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		s.Exists(ctx, "a.txt")
+	}
+	// 2 calls from the burst, then 2 at 50ms each.
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("4 calls took %v, expected them to be throttled", elapsed)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	s.Exists(ctx, "a.txt")
+	s.Exists(ctx, "a.txt")
+	if _, err := s.Exists(short, "a.txt"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context deadline, got %v", err)
+	}
+}
+
+func TestRateLimitedStorage_Bytes(t *testing.T) {
+	ctx := context.Background()
+	s := WrapWithRateLimit(newTestLocal(t), RateLimit{BytesPerSecond: 10000})
+	data := bytes.Repeat([]byte("x"), 15000)
+
+	start := time.Now()
+	if _, err := s.Upload(ctx, "a.bin", bytes.NewReader(data)); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	// 10000 bytes of burst, then 5000 bytes at 10000/s.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Upload took %v, expected about 500ms", elapsed)
+	}
+
+	rc, _ := s.Download(ctx, "a.bin")
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(got, data) {
+		t.Error("Downloaded data does not match")
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Reload switches the Manager to cfg without a restart:
+//
+//   - disks whose configuration is unchanged keep their open instance;
+//   - new and changed disks are opened before the switch, so that a bad
+//     configuration is reported and the current one stays in use;
+//   - removed and changed disks, and the composite disks built on them,
+//     are closed in the background once the operations in flight on them
+//     finish.
+//
+// Operations are counted as in flight when they go through the
+// package-level functions (Disk("x").Put and so on), including a download
+// until its reader is closed.
+//
+// Disks added with Manager.Register are kept; cfg must not configure their
+// names.
+func (m *Manager) Reload(cfg *Config) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	return m.reload(cfg)
+}
+
+// reload implements Reload; m.reloadMu must be held.
+func (m *Manager) reload(cfg *Config) error {
+	if cfg == nil {
+		return fmt.Errorf("storage: config is nil")
+	}
+	if err := checkConfig(cfg); err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+
+	m.mu.RLock()
+	old := m.config
+	stale := make(map[string]bool)
+	for name, d := range m.disks {
+		if d.prebuilt {
+			if _, ok := cfg.Storages[name]; ok {
+				m.mu.RUnlock()
+				return fmt.Errorf("storage: disk %q is registered and cannot be configured", name)
+			}
+			continue
+		}
+		if !sameDisk(old, cfg, name) {
+			stale[name] = true
+		}
+	}
+	// A composite holds its children, so it goes with them.
+	for changed := true; changed; {
+		changed = false
+		for name, d := range m.disks {
+			for _, child := range d.children {
+				if stale[child] && !stale[name] {
+					stale[name] = true
+					changed = true
+				}
+			}
+		}
+	}
+	next := NewManager(cfg)
+	kept := make(map[string]bool)
+	for name, d := range m.disks {
+		if !stale[name] {
+			next.disks[name] = d
+			kept[name] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	names := make([]string, 0, len(cfg.Storages))
+	for name := range cfg.Storages {
+		if stale[name] || !sameDisk(old, cfg, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := next.disk(name, nil); err != nil {
+			for n, d := range next.disks {
+				if !kept[n] {
+					d.Close()
+				}
+			}
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	// Disks opened by a caller during the reload are still valid if their
+	// configuration and that of their children did not change. A composite
+	// opened on a stale child goes with it.
+	late := make(map[string]*openDisk)
+	for name, d := range m.disks {
+		if _, ok := next.disks[name]; !ok && !stale[name] && sameDisk(old, cfg, name) {
+			late[name] = d
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, d := range late {
+			for _, child := range d.children {
+				if _, ok := late[child]; !ok && (stale[child] || next.disks[child] != m.disks[child]) {
+					delete(late, name)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	retired := make(map[string]*openDisk)
+	var closed []string
+	for name, d := range m.disks {
+		if next.disks[name] == d {
+			continue
+		}
+		if late[name] == d {
+			next.disks[name] = d
+			continue
+		}
+		retired[name] = d
+		closed = append(closed, name)
+	}
+	m.config = cfg
+	m.disks = next.disks
+	m.mu.Unlock()
+
+	if len(names) > 0 || len(closed) > 0 {
+		sort.Strings(closed)
+		defaultLogger.Info("storage: reloaded (kept %d, opened %v, closing %v)", len(kept), names, closed)
+	}
+	retire(retired)
+	return nil
+}
+
+// sameDisk reports whether disk name has the same configuration in a and b.
+func sameDisk(a, b *Config, name string) bool {
+	da, okA := a.Storages[name]
+	db, okB := b.Storages[name]
+	return okA && okB && sameStorageConfig(da, db)
+}
+
+// sameStorageConfig reports whether a and b configure the same disk.
+func sameStorageConfig(a, b StorageConfig) bool {
+	if a.Driver != b.Driver {
+		return false
+	}
+	// The same map is equal even if it holds values DeepEqual rejects, such
+	// as functions.
+	if reflect.ValueOf(a.Options).UnsafePointer() == reflect.ValueOf(b.Options).UnsafePointer() {
+		return true
+	}
+	return reflect.DeepEqual(a.Options, b.Options)
+}
+
+// retire closes disks in the background once their in-flight operations
+// finish. A disk is closed after the retired composites built on it.
+func retire(disks map[string]*openDisk) {
+	done := make(map[string]chan struct{}, len(disks))
+	for name := range disks {
+		done[name] = make(chan struct{})
+	}
+	for name, d := range disks {
+		var parents []chan struct{}
+		for parent, p := range disks {
+			if slices.Contains(p.children, name) {
+				parents = append(parents, done[parent])
+			}
+		}
+		go func(name string, d *openDisk) {
+			defer close(done[name])
+			for _, p := range parents {
+				<-p
+			}
+			d.inflight.Wait()
+			if err := d.Close(); err != nil {
+				defaultLogger.Warn("storage: failed to close disk %s: %v", name, err)
+			}
+		}(name, d)
+	}
+}
+
+// shutdown retires every disk of a Manager replaced by Setup. Later calls
+// return errManagerReplaced.
+func (m *Manager) shutdown() {
+	m.mu.Lock()
+	m.replaced = true
+	disks := m.disks
+	m.disks = make(map[string]*openDisk)
+	m.mu.Unlock()
+	retire(disks)
+}
+
+// WatchConfigFile reloads the Manager from a YAML or JSON file whenever it
+// changes, checking every interval until ctx is done. A file that fails to
+// load or open is logged and the current configuration stays in use;
+// onReload, if not nil, is called after every attempt with its error.
+func (m *Manager) WatchConfigFile(ctx context.Context, path string, interval time.Duration, onReload func(error)) {
+	last, _ := os.Stat(path)
+	m.watchConfigFile(ctx, path, last, interval, onReload)
+}
+
+// watchConfigFile watches for changes since the file was last.
+func (m *Manager) watchConfigFile(ctx context.Context, path string, last os.FileInfo, interval time.Duration, onReload func(error)) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil || last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+			continue
+		}
+		last = fi
+
+		cfg, err := LoadConfigFile(path)
+		if err == nil {
+			err = m.Reload(cfg)
+		}
+		if err != nil {
+			defaultLogger.Warn("storage: keeping the current configuration: %v", err)
+		}
+		if onReload != nil {
+			onReload(err)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closeTrackingStorage records whether it was closed.
+type closeTrackingStorage struct {
+	Storage
+	closed atomic.Bool
+}
+
+func (c *closeTrackingStorage) Close() error {
+	c.closed.Store(true)
+	return c.Storage.Close()
+}
+
+func init() {
+	Register("test-tracked", func(cfg map[string]any) (Storage, error) {
+		s, err := newLocalStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &closeTrackingStorage{Storage: s}, nil
+	})
+	// test-hook calls its "hook" option while it is opened.
+	Register("test-hook", func(cfg map[string]any) (Storage, error) {
+		if hook, ok := cfg["hook"].(func()); ok {
+			hook()
+		}
+		return newLocalStorage(map[string]any{"root": cfg["root"]})
+	})
+}
+
+func trackedDisk(root string) StorageConfig {
+	return StorageConfig{Driver: "test-tracked", Options: map[string]any{"root": root}}
+}
+
+func waitClosed(t *testing.T, s Storage) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.(*closeTrackingStorage).closed.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("Disk was not closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	dir := t.TempDir()
+	root := func(name string) string { return filepath.Join(dir, name) }
+	mgr := NewManager(&Config{
+		Default: "a",
+		Storages: map[string]StorageConfig{
+			"a":      trackedDisk(root("a")),
+			"b":      trackedDisk(root("b")),
+			"gone":   trackedDisk(root("gone")),
+			"mirror": {Driver: "mirror", Options: map[string]any{"disks": []any{"b"}}},
+		},
+	})
+	defer mgr.Close()
+
+	a, _ := mgr.Disk("a")
+	b, _ := mgr.Disk("b")
+	gone, _ := mgr.Disk("gone")
+	mirror, err := mgr.Disk("mirror")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	// An operation in flight on b.
+	_, release, err := mgr.acquire("b")
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	err = mgr.Reload(&Config{
+		Default: "a",
+		Storages: map[string]StorageConfig{
+			"a":      trackedDisk(root("a")),
+			"b":      trackedDisk(root("b2")),
+			"c":      trackedDisk(root("c")),
+			"mirror": {Driver: "mirror", Options: map[string]any{"disks": []any{"b"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if s, _ := mgr.Disk("a"); s != a {
+		t.Error("Unchanged disk was reopened")
+	}
+	if s, _ := mgr.Disk("b"); s == b {
+		t.Error("Changed disk was not reopened")
+	}
+	if s, _ := mgr.Disk("mirror"); s == mirror {
+		t.Error("Composite built on a changed disk was not reopened")
+	}
+	if _, err := os.Stat(root("c")); err != nil {
+		t.Errorf("New disk was not opened: %v", err)
+	}
+	if _, err := mgr.Disk("gone"); err == nil {
+		t.Error("Removed disk is still available")
+	}
+
+	waitClosed(t, gone)
+	time.Sleep(20 * time.Millisecond)
+	if b.(*closeTrackingStorage).closed.Load() {
+		t.Fatal("Disk closed with an operation in flight")
+	}
+	release()
+	waitClosed(t, b)
+	if a.(*closeTrackingStorage).closed.Load() {
+		t.Error("Unchanged disk was closed")
+	}
+}
+
+func TestManagerReload_CompositeOpenedDuringReload(t *testing.T) {
+	dir := t.TempDir()
+	root := func(name string) string { return filepath.Join(dir, name) }
+	cfg := func(b string, hook func()) *Config {
+		return &Config{
+			Default: "b",
+			Storages: map[string]StorageConfig{
+				"b":      trackedDisk(root(b)),
+				"mirror": {Driver: "mirror", Options: map[string]any{"disks": []any{"b"}}},
+				"hook": {Driver: "test-hook", Options: map[string]any{
+					"root": root("hook"), "hook": hook,
+				}},
+			},
+		}
+	}
+	mgr := NewManager(cfg("b1", nil))
+	defer mgr.Close()
+	b, _ := mgr.Disk("b")
+
+	// The mirror is first opened while the reload opens the new disks, on
+	// the b that is being replaced.
+	var during Storage
+	err := mgr.Reload(cfg("b2", func() { during, _ = mgr.Disk("mirror") }))
+	if err != nil || during == nil {
+		t.Fatalf("Reload = %v, mirror opened during reload = %v", err, during)
+	}
+	if s, _ := mgr.Disk("mirror"); s == during {
+		t.Error("Composite opened on a replaced disk during the reload was kept")
+	}
+	waitClosed(t, b)
+}
+
+func TestManagerDisk_OpenFinishesAfterReload(t *testing.T) {
+	dir := t.TempDir()
+	root := func(name string) string { return filepath.Join(dir, name) }
+	var mgr *Manager
+	reloaded := false
+	hook := func() {
+		if !reloaded {
+			reloaded = true
+			mgr.Reload(&Config{
+				Default: "b",
+				Storages: map[string]StorageConfig{
+					"b":      trackedDisk(root("b2")),
+					"hook":   {Driver: "test-hook", Options: map[string]any{"root": root("hook")}},
+					"mirror": {Driver: "mirror", Options: map[string]any{"disks": []any{"b", "hook"}}},
+				},
+			})
+		}
+	}
+	mgr = NewManager(&Config{
+		Default: "b",
+		Storages: map[string]StorageConfig{
+			"b":      trackedDisk(root("b1")),
+			"hook":   {Driver: "test-hook", Options: map[string]any{"root": root("hook"), "hook": hook}},
+			"mirror": {Driver: "mirror", Options: map[string]any{"disks": []any{"b", "hook"}}},
+		},
+	})
+	defer mgr.Close()
+
+	// The mirror opens b, then the reload replaces b before the mirror is
+	// stored; it must be opened again on the new b.
+	mirror, err := mgr.Disk("mirror")
+	if err != nil || !reloaded {
+		t.Fatalf("Disk = %v, reloaded %v", err, reloaded)
+	}
+	if _, err := mirror.Upload(context.Background(), "a.txt", strings.NewReader("a")); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root("b2"), "a.txt")); err != nil {
+		t.Errorf("Mirror was kept on the replaced disk: %v", err)
+	}
+}
+
+func TestManagerDisk_OpenFinishesAfterRemoveDisk(t *testing.T) {
+	var mgr *Manager
+	mgr = NewManager(&Config{
+		Default: "main",
+		Storages: map[string]StorageConfig{
+			"main": {Driver: "local", Options: map[string]any{"root": t.TempDir()}},
+			"gone": {Driver: "test-hook", Options: map[string]any{
+				"root": t.TempDir(),
+				"hook": func() { mgr.RemoveDisk("gone") },
+			}},
+		},
+	})
+	defer mgr.Close()
+
+	if _, err := mgr.Disk("gone"); err == nil {
+		t.Error("Expected a disk removed while opening not to be installed")
+	}
+	for _, name := range mgr.Disks() {
+		if name == "gone" {
+			t.Error("Removed disk is listed")
+		}
+	}
+}
+
+func TestManagerReload_Invalid(t *testing.T) {
+	root := t.TempDir()
+	mgr := NewManager(&Config{Default: "a", Storages: map[string]StorageConfig{"a": trackedDisk(root)}})
+	defer mgr.Close()
+	a, _ := mgr.Disk("a")
+
+	blocker := filepath.Join(root, "file")
+	os.WriteFile(blocker, []byte("x"), 0644)
+	err := mgr.Reload(&Config{Default: "a", Storages: map[string]StorageConfig{
+		"a": trackedDisk(root),
+		"b": trackedDisk(filepath.Join(blocker, "sub")), // Cannot be created
+	}})
+	if err == nil || !strings.Contains(err.Error(), `"b"`) {
+		t.Fatalf("Expected an error opening b, got %v", err)
+	}
+	if _, err := mgr.Disk("b"); err == nil {
+		t.Error("Failed reload was applied")
+	}
+	if s, _ := mgr.Disk("a"); s != a || a.(*closeTrackingStorage).closed.Load() {
+		t.Error("Failed reload changed the current disks")
+	}
+}
+
+func TestSetupFromFile_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	write := func(root string) {
+		os.WriteFile(path, []byte("default: local\ndisks:\n  local:\n    driver: local\n    root: "+root+"\n"), 0644)
+	}
+	write(filepath.Join(dir, "one"))
+
+	reloads := make(chan error, 10)
+	err := SetupFromFile(path, WatchConfig(10*time.Millisecond), OnReload(func(err error) { reloads <- err }))
+	if err != nil {
+		t.Fatalf("SetupFromFile failed: %v", err)
+	}
+	defer Setup(map[string]any{"disks": map[string]any{}}) // Stops the watcher
+
+	write(filepath.Join(dir, "second"))
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Config change was not picked up")
+	}
+	if _, err := PutString("a.txt", "a"); err != nil {
+		t.Fatalf("PutString failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "second", "a.txt")); err != nil {
+		t.Errorf("Upload did not use the reloaded config: %v", err)
+	}
+
+	os.WriteFile(path, []byte("disks:\n  local:\n    driver: lcoal\n"), 0644)
+	select {
+	case err := <-reloads:
+		if err == nil {
+			t.Fatal("Expected an error for a broken config")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Config change was not picked up")
+	}
+	if _, err := PutString("b.txt", "b"); err != nil {
+		t.Errorf("Broken config replaced the working one: %v", err)
+	}
+}
+
+func TestSetup_ClosesPreviousManager(t *testing.T) {
+	setup := func() {
+		Setup(map[string]any{"default": "t", "disks": map[string]any{
+			"t": map[string]any{"driver": "test-tracked", "root": t.TempDir()},
+		}})
+	}
+	setup()
+	s, _ := Disk("").Storage()
+	PutString("a.txt", "a")
+	reader, err := Get("a.txt")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	setup()
+	time.Sleep(20 * time.Millisecond)
+	if s.(*closeTrackingStorage).closed.Load() {
+		t.Fatal("Previous disk closed while a download was open")
+	}
+	reader.Close()
+	waitClosed(t, s)
+	if _, err := PutString("b.txt", "b"); err != nil {
+		t.Errorf("PutString on the new manager failed: %v", err)
+	}
+}
+
+func TestDiskWrapper_AcquireHoldsDiskAcrossReload(t *testing.T) {
+	dir := t.TempDir()
+	disk := func(root string) map[string]any {
+		return map[string]any{"default": "t", "disks": map[string]any{
+			"t": map[string]any{"driver": "test-tracked", "root": filepath.Join(dir, root)},
+		}}
+	}
+	if err := Setup(disk("a")); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	s, release, err := Disk("t").Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	cfg, err := parseConfigMap(disk("b"))
+	if err != nil {
+		t.Fatalf("parseConfigMap failed: %v", err)
+	}
+	if err := DefaultManager().Reload(cfg); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if s.(*closeTrackingStorage).closed.Load() {
+		t.Fatal("Acquired disk closed by the reload")
+	}
+	release()
+	waitClosed(t, s)
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type diskContextKey struct{}
+
+// WithDisk attaches a disk name to ctx. Operations through Disk("") and
+// the package-level functions use that disk instead of the default one:
+//
+//	ctx = storage.WithDisk(ctx, "eu-west")
+//	storage.Disk("").PutWithContext(ctx, "report.pdf", r) // on eu-west
+func WithDisk(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, diskContextKey{}, name)
+}
+
+// DiskFromContext returns the disk name attached with WithDisk.
+func DiskFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(diskContextKey{}).(string)
+	return name, ok && name != ""
+}
+
+// DiskResolver picks the disk for an operation on key when no disk is
+// named, or returns "" to leave the choice to the next resolver.
+type DiskResolver func(ctx context.Context, key string) string
+
+// SetDiskResolver sets the resolvers that pick a disk for operations
+// through Disk("") without a WithDisk name. They are tried in order and
+// the default disk is used if none picks one:
+//
+//	storage.DefaultManager().SetDiskResolver(
+//	    storage.ByTenant(map[string]string{"acme": "acme-oss"}),
+//	    storage.ByKeyPrefix(map[string]string{"archive/": "cold"}),
+//	)
+//
+// The resolvers are kept across Reload; Setup creates a new Manager
+// without them.
+func (m *Manager) SetDiskResolver(resolvers ...DiskResolver) {
+	m.mu.Lock()
+	m.resolve = resolvers
+	m.mu.Unlock()
+}
+
+// resolveDisk returns the disk name for an operation on key, or "" for
+// the default disk.
+func (m *Manager) resolveDisk(ctx context.Context, key string) string {
+	if name, ok := DiskFromContext(ctx); ok {
+		return name
+	}
+	m.mu.RLock()
+	resolvers := m.resolve
+	m.mu.RUnlock()
+	for _, r := range resolvers {
+		if name := r(ctx, key); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// DiskFor returns the disk for an operation on key, resolved like
+// Disk("") operations: the WithDisk name in ctx, the disk resolvers,
+// then the default disk.
+func (m *Manager) DiskFor(ctx context.Context, key string) (Storage, error) {
+	return m.Disk(m.resolveDisk(ctx, key))
+}
+
+type tenantContextKey struct{}
+
+// WithTenant attaches a tenant ID to ctx for ByTenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant ID attached with WithTenant.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// TenantMiddleware attaches the value of a request header, such as
+// X-Tenant-ID, to the request context with WithTenant.
+//
+// The header selects the disk a request reads and writes, so it must be
+// set by a trusted proxy or gateway that strips it from client requests,
+// or be checked by allow: requests whose tenant allow rejects get 403
+// Forbidden. allow may be nil, e.g. to check the tenant against the
+// authenticated user:
+//
+//	storage.TenantMiddleware("X-Tenant-ID", func(r *http.Request, tenant string) bool {
+//	    return userFrom(r).Tenant == tenant
+//	})
+func TenantMiddleware(header string, allow func(r *http.Request, tenant string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tenant := r.Header.Get(header); tenant != "" {
+				if allow != nil && !allow(r, tenant) {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				r = r.WithContext(WithTenant(r.Context(), tenant))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ByTenant resolves the disk from the tenant in the context (see
+// WithTenant and TenantMiddleware). Tenants not in disks are left to the
+// next resolver.
+func ByTenant(disks map[string]string) DiskResolver {
+	return func(ctx context.Context, key string) string {
+		if tenant, ok := TenantFromContext(ctx); ok {
+			return disks[tenant]
+		}
+		return ""
+	}
+}
+
+// ByKeyPrefix resolves the disk from the key: the longest prefix in
+// disks that key starts with wins.
+func ByKeyPrefix(disks map[string]string) DiskResolver {
+	return func(ctx context.Context, key string) string {
+		best, name := -1, ""
+		for prefix, disk := range disks {
+			if strings.HasPrefix(key, prefix) && len(prefix) > best {
+				best, name = len(prefix), disk
+			}
+		}
+		return name
+	}
+}
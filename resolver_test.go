@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDisk_ResolvesThroughContext(t *testing.T) {
+	dir := t.TempDir()
+	disks := map[string]any{}
+	for _, name := range []string{"main", "acme", "archive", "eu"} {
+		disks[name] = map[string]any{"driver": "local", "root": filepath.Join(dir, name)}
+	}
+	if err := Setup(map[string]any{"default": "main", "disks": disks}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	DefaultManager().SetDiskResolver(
+		ByTenant(map[string]string{"acme": "acme"}),
+		ByKeyPrefix(map[string]string{"archive/": "archive", "archive/2020/": "eu"}),
+	)
+
+	put := func(ctx context.Context, key string) {
+		t.Helper()
+		if _, err := Disk("").PutWithContext(ctx, key, strings.NewReader("x")); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+	ctx := context.Background()
+	put(ctx, "a.txt")
+	put(WithTenant(ctx, "acme"), "b.txt")
+	put(WithTenant(ctx, "other"), "c.txt")
+	put(ctx, "archive/d.txt")
+	put(ctx, "archive/2020/e.txt")
+	put(WithDisk(WithTenant(ctx, "acme"), "eu"), "f.txt")
+
+	for _, path := range []string{
+		"main/a.txt", "acme/b.txt", "main/c.txt",
+		"archive/archive/d.txt", "eu/archive/2020/e.txt", "eu/f.txt",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("Expected %s: %v", path, err)
+		}
+	}
+
+	// The helpers resolve through the context too.
+	acme := WithTenant(ctx, "acme")
+	if _, err := Disk("").PutStringWithContext(acme, "g.txt", "g"); err != nil {
+		t.Fatalf("PutStringWithContext failed: %v", err)
+	}
+	if got, err := Disk("").GetStringWithContext(acme, "g.txt"); err != nil || got != "g" {
+		t.Errorf("GetStringWithContext = %q, %v", got, err)
+	}
+	if _, err := Disk("").GetBytesWithContext(ctx, "g.txt"); !IsNotFoundError(err) {
+		t.Errorf("GetBytesWithContext on main = %v, want not found", err)
+	}
+
+	// An explicit disk name is not resolved.
+	if ok, _ := Disk("main").ExistsWithContext(WithDisk(ctx, "eu"), "a.txt"); !ok {
+		t.Error("Expected Disk(\"main\") to ignore WithDisk")
+	}
+	if s, err := DefaultManager().DiskFor(WithTenant(ctx, "acme"), "x"); err != nil || s == nil {
+		t.Errorf("DiskFor = %v, %v", s, err)
+	}
+	if _, err := Disk("").GetWithContext(WithDisk(ctx, "missing"), "a.txt"); err == nil {
+		t.Error("Expected error for an unknown disk")
+	}
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = TenantFromContext(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	TenantMiddleware("X-Tenant-ID", nil)(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got != "acme" {
+		t.Errorf("Tenant = %q, want acme", got)
+	}
+
+	got = ""
+	rec := httptest.NewRecorder()
+	allow := func(r *http.Request, tenant string) bool { return tenant == "globex" }
+	TenantMiddleware("X-Tenant-ID", allow)(next).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || got != "" {
+		t.Errorf("Rejected tenant: status %d, tenant %q", rec.Code, got)
+	}
+}
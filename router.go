@@ -0,0 +1,414 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterComposite("router", newRouterFromConfig)
+	RegisterSchema("router", routerConfig{})
+}
+
+// Route sends the keys matching Prefix or Match to a disk. Exactly one of
+// Prefix and Match is set.
+type Route struct {
+	Prefix string // Keys starting with Prefix, e.g. "private/"
+	Match  string // Glob: "*" within a segment, "**" across segments, e.g. "images/**"
+	Disk   NamedStorage
+}
+
+func (r *Route) matches(key string) bool {
+	if r.Match != "" {
+		return matchGlob(r.Match, key)
+	}
+	return strings.HasPrefix(key, r.Prefix)
+}
+
+// literal returns the part of the route before any glob metacharacter:
+// every key it matches starts with it.
+func (r *Route) literal() string {
+	if r.Match == "" {
+		return r.Prefix
+	}
+	if i := strings.IndexAny(r.Match, `*?[\`); i >= 0 {
+		return r.Match[:i]
+	}
+	return r.Match
+}
+
+// RouterStorage sends each key to the disk of the first route it matches,
+// or to a fallback disk, so that several disks appear as one:
+//
+//	images/**  -> cdn       (public bucket behind a CDN)
+//	private/   -> secure    (encrypted bucket)
+//	*          -> local
+//
+// Copy and Move between keys on different disks stream the object from
+// one disk to the other. List merges the listings of the disks with
+// routes that overlap the prefix, keeping only the keys that route to the
+// disk they were listed on.
+type RouterStorage struct {
+	routes   []Route
+	fallback NamedStorage   // Storage is nil if there is none
+	disks    []NamedStorage // Distinct disks, in route order
+}
+
+// NewRouterStorage creates a router over routes, tried in order. Keys
+// that match no route go to fallback, or are refused with ErrInvalidKey if
+// fallback has no Storage. The disks are not closed by Close.
+func NewRouterStorage(routes []Route, fallback NamedStorage) (*RouterStorage, error) {
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("storage: router: no routes")
+	}
+	r := &RouterStorage{routes: routes, fallback: fallback}
+	seen := make(map[string]bool)
+	for i, rt := range routes {
+		if (rt.Prefix == "") == (rt.Match == "") {
+			return nil, fmt.Errorf("storage: router: route %d: exactly one of prefix and match must be set", i)
+		}
+		for _, seg := range strings.Split(rt.Match, "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("storage: router: route %d: invalid pattern %q", i, rt.Match)
+			}
+		}
+		if !seen[rt.Disk.Name] {
+			seen[rt.Disk.Name] = true
+			r.disks = append(r.disks, rt.Disk)
+		}
+	}
+	if fallback.Storage != nil && !seen[fallback.Name] {
+		r.disks = append(r.disks, fallback)
+	}
+	return r, nil
+}
+
+// newRouterFromConfig creates a router from disk options:
+//
+//	routes:
+//	  - match: "images/**"
+//	    disk: cdn
+//	  - prefix: private/
+//	    disk: secure
+//	default: local       # disk for the other keys (optional)
+func newRouterFromConfig(disks DiskSource, cfg map[string]any) (Storage, error) {
+	var c routerConfig
+	if err := DecodeOptions(cfg, &c); err != nil {
+		return nil, fmt.Errorf("router: %w", err)
+	}
+	routes := make([]Route, len(c.Routes))
+	for i, rc := range c.Routes {
+		s, err := disks.Disk(rc.Disk)
+		if err != nil {
+			return nil, err
+		}
+		routes[i] = Route{Prefix: rc.Prefix, Match: rc.Match, Disk: NamedStorage{Name: rc.Disk, Storage: s}}
+	}
+	var fallback NamedStorage
+	if c.Default != "" {
+		s, err := disks.Disk(c.Default)
+		if err != nil {
+			return nil, err
+		}
+		fallback = NamedStorage{Name: c.Default, Storage: s}
+	}
+	return NewRouterStorage(routes, fallback)
+}
+
+type routerConfig struct {
+	Routes  routeList `option:"routes,required,disk"`
+	Default string    `option:"default,disk"`
+}
+
+type routeConfig struct {
+	Prefix string `option:"prefix"`
+	Match  string `option:"match"`
+	Disk   string `option:"disk,required"`
+}
+
+// routeList is the routes option: a list of routeConfig maps.
+type routeList []routeConfig
+
+func (l *routeList) UnmarshalOption(v any) error {
+	items, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("expected a list of routes, got %T", v)
+	}
+	*l = make(routeList, len(items))
+	for i, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return fmt.Errorf("route %d: expected a map, got %T", i, item)
+		}
+		if err := DecodeOptions(m, &(*l)[i]); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (l routeList) diskRefs() []string {
+	refs := make([]string, len(l))
+	for i, r := range l {
+		refs[i] = r.Disk
+	}
+	return refs
+}
+
+// route returns the disk for key.
+func (r *RouterStorage) route(key string) (NamedStorage, error) {
+	for i := range r.routes {
+		if r.routes[i].matches(key) {
+			return r.routes[i].Disk, nil
+		}
+	}
+	if r.fallback.Storage == nil {
+		return NamedStorage{}, fmt.Errorf("%w: no route for %q", ErrInvalidKey, key)
+	}
+	return r.fallback, nil
+}
+
+func (r *RouterStorage) advanced(key string) (AdvancedStorage, error) {
+	d, err := r.route(key)
+	if err != nil {
+		return nil, err
+	}
+	adv, ok := d.Storage.(AdvancedStorage)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return adv, nil
+}
+
+func (r *RouterStorage) archive(key string) (ArchiveStorage, error) {
+	d, err := r.route(key)
+	if err != nil {
+		return nil, err
+	}
+	arc, ok := d.Storage.(ArchiveStorage)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return arc, nil
+}
+
+func (r *RouterStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	d, err := r.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return d.Upload(ctx, key, reader, opts...)
+}
+
+func (r *RouterStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	d, err := r.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return d.Download(ctx, key)
+}
+
+func (r *RouterStorage) Delete(ctx context.Context, key string) error {
+	d, err := r.route(key)
+	if err != nil {
+		return err
+	}
+	return d.Delete(ctx, key)
+}
+
+func (r *RouterStorage) Exists(ctx context.Context, key string) (bool, error) {
+	d, err := r.route(key)
+	if err != nil {
+		return false, err
+	}
+	return d.Exists(ctx, key)
+}
+
+func (r *RouterStorage) URL(ctx context.Context, key string) (string, error) {
+	d, err := r.route(key)
+	if err != nil {
+		return "", err
+	}
+	return d.URL(ctx, key)
+}
+
+func (r *RouterStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	adv, err := r.advanced(key)
+	if err != nil {
+		return "", err
+	}
+	return adv.SignedURL(ctx, key, expires)
+}
+
+func (r *RouterStorage) Size(ctx context.Context, key string) (int64, error) {
+	adv, err := r.advanced(key)
+	if err != nil {
+		return 0, err
+	}
+	return adv.Size(ctx, key)
+}
+
+func (r *RouterStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	adv, err := r.advanced(key)
+	if err != nil {
+		return nil, err
+	}
+	return adv.Metadata(ctx, key)
+}
+
+// Copy copies src to dst, streaming the object if they route to different
+// disks.
+func (r *RouterStorage) Copy(ctx context.Context, src, dst string) error {
+	from, to, err := r.routePair(src, dst)
+	if err != nil {
+		return err
+	}
+	if from.Name == to.Name {
+		if adv, ok := from.Storage.(AdvancedStorage); ok {
+			return adv.Copy(ctx, src, dst)
+		}
+	}
+	return copyAcross(ctx, from, to, src, dst)
+}
+
+// Move moves src to dst. If they route to different disks, the object is
+// streamed to the new disk and then deleted from the old one.
+func (r *RouterStorage) Move(ctx context.Context, src, dst string) error {
+	from, to, err := r.routePair(src, dst)
+	if err != nil {
+		return err
+	}
+	if from.Name == to.Name {
+		if adv, ok := from.Storage.(AdvancedStorage); ok {
+			return adv.Move(ctx, src, dst)
+		}
+	}
+	if err := copyAcross(ctx, from, to, src, dst); err != nil {
+		return err
+	}
+	if err := from.Delete(ctx, src); err != nil {
+		return fmt.Errorf("storage: router: copied %q to %s but failed to delete it from %s: %w", src, to.Name, from.Name, err)
+	}
+	return nil
+}
+
+func (r *RouterStorage) routePair(src, dst string) (from, to NamedStorage, err error) {
+	if from, err = r.route(src); err != nil {
+		return
+	}
+	to, err = r.route(dst)
+	return
+}
+
+// copyAcross streams src on one disk to dst on another, keeping the
+// content type and user metadata when the source reports them.
+func copyAcross(ctx context.Context, from, to NamedStorage, src, dst string) error {
+	var opts []UploadOption
+	if adv, ok := from.Storage.(AdvancedStorage); ok {
+		info, err := adv.Metadata(ctx, src)
+		if err != nil {
+			return err
+		}
+		if info.ContentType != "" {
+			opts = append(opts, WithContentType(info.ContentType))
+		}
+		if len(info.Metadata) > 0 {
+			opts = append(opts, WithMetadata(info.Metadata))
+		}
+	}
+	rc, err := from.Download(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if _, err := to.Upload(ctx, dst, rc, opts...); err != nil {
+		return fmt.Errorf("storage: router: failed to write %q to %s: %w", dst, to.Name, err)
+	}
+	return nil
+}
+
+// List merges the listings of the disks with routes that overlap prefix,
+// in key order. A disk only contributes the keys that route to it, so
+// objects shadowed by another route are not listed.
+func (r *RouterStorage) List(ctx context.Context, prefix string, opts ...ListOption) (*ListResult, error) {
+	options := &ListOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	overlaps := make(map[string]bool)
+	for _, rt := range r.routes {
+		lit := rt.literal()
+		if strings.HasPrefix(lit, prefix) || strings.HasPrefix(prefix, lit) {
+			overlaps[rt.Disk.Name] = true
+		}
+	}
+	if r.fallback.Storage != nil {
+		overlaps[r.fallback.Name] = true
+	}
+
+	var listed []NamedStorage
+	var results []*ListResult
+	for _, d := range r.disks {
+		if !overlaps[d.Name] {
+			continue
+		}
+		adv, ok := d.Storage.(AdvancedStorage)
+		if !ok {
+			return nil, fmt.Errorf("storage: router: %s: %w", d.Name, ErrNotImplemented)
+		}
+		result, err := adv.List(ctx, prefix, opts...)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, d)
+		results = append(results, result)
+	}
+
+	return mergeListings(results, options.MaxKeys, func(i int, f FileInfo) bool {
+		d, err := r.route(f.Key)
+		return err == nil && d.Name == listed[i].Name
+	}), nil
+}
+
+func (r *RouterStorage) SetStorageClass(ctx context.Context, key string, class StorageClass) error {
+	arc, err := r.archive(key)
+	if err != nil {
+		return err
+	}
+	return arc.SetStorageClass(ctx, key, class)
+}
+
+func (r *RouterStorage) Restore(ctx context.Context, key string, days int) error {
+	arc, err := r.archive(key)
+	if err != nil {
+		return err
+	}
+	return arc.Restore(ctx, key, days)
+}
+
+func (r *RouterStorage) RestoreStatus(ctx context.Context, key string) (*RestoreStatus, error) {
+	arc, err := r.archive(key)
+	if err != nil {
+		return nil, err
+	}
+	return arc.RestoreStatus(ctx, key)
+}
+
+// Ping checks every disk the router sends keys to.
+func (r *RouterStorage) Ping(ctx context.Context) error {
+	return pingDisks(ctx, r.disks...)
+}
+
+// Close does nothing: the disks are owned by the Manager.
+func (r *RouterStorage) Close() error {
+	return nil
+}
+
+var _ AdvancedStorage = (*RouterStorage)(nil)
+var _ ArchiveStorage = (*RouterStorage)(nil)
+var _ Pinger = (*RouterStorage)(nil)
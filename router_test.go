@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newRouterManager(t *testing.T) (*Manager, string) {
+	dir := t.TempDir()
+	local := func(name string) StorageConfig {
+		return StorageConfig{Driver: "local", Options: map[string]any{"root": filepath.Join(dir, name)}}
+	}
+	mgr := NewManager(&Config{
+		Default: "files",
+		Storages: map[string]StorageConfig{
+			"cdn":    local("cdn"),
+			"secure": local("secure"),
+			"local":  local("local"),
+			"files": {Driver: "router", Options: map[string]any{
+				"routes": []any{
+					map[string]any{"match": "images/**", "disk": "cdn"},
+					map[string]any{"prefix": "private/", "disk": "secure"},
+				},
+				"default": "local",
+			}},
+		},
+	})
+	t.Cleanup(func() { mgr.Close() })
+	return mgr, dir
+}
+
+func TestRouterStorage(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newRouterManager(t)
+	s, err := mgr.Disk("files")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	router := s.(*RouterStorage)
+
+	for _, key := range []string{"images/a.png", "images/2024/b.png", "private/c.pdf", "d.txt", "imagesx.txt"} {
+		if _, err := router.Upload(ctx, key, strings.NewReader(key), WithContentType("text/plain")); err != nil {
+			t.Fatalf("Upload %s failed: %v", key, err)
+		}
+	}
+	for disk, keys := range map[string][]string{
+		"cdn":    {"images/a.png", "images/2024/b.png"},
+		"secure": {"private/c.pdf"},
+		"local":  {"d.txt", "imagesx.txt"},
+	} {
+		child, _ := mgr.Disk(disk)
+		for _, key := range keys {
+			if ok, _ := child.Exists(ctx, key); !ok {
+				t.Errorf("Expected %s on %s", key, disk)
+			}
+		}
+	}
+	if got := readString(t, router, "private/c.pdf"); got != "private/c.pdf" {
+		t.Errorf("Download = %q", got)
+	}
+
+	// Copy and Move across disks stream the object.
+	if err := router.Copy(ctx, "d.txt", "private/d.txt"); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	secure, _ := mgr.Disk("secure")
+	if info, err := secure.(AdvancedStorage).Metadata(ctx, "private/d.txt"); err != nil || info.ContentType != "text/plain" {
+		t.Errorf("Copied object = %+v, %v", info, err)
+	}
+	if err := router.Move(ctx, "images/a.png", "a.png"); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	cdn, _ := mgr.Disk("cdn")
+	if ok, _ := cdn.Exists(ctx, "images/a.png"); ok {
+		t.Error("Moved object left on the source disk")
+	}
+	if got := readString(t, router, "a.png"); got != "images/a.png" {
+		t.Errorf("Moved object = %q", got)
+	}
+	if err := router.Move(ctx, "d.txt", "e.txt"); err != nil {
+		t.Fatalf("Move on one disk failed: %v", err)
+	}
+
+	// A key stored on a disk its route does not lead to is not listed.
+	local, _ := mgr.Disk("local")
+	local.Upload(ctx, "private/shadowed.txt", strings.NewReader("x"))
+
+	var keys []string
+	marker := ""
+	for {
+		page, err := router.List(ctx, "", WithMaxKeys(2), WithMarker(marker))
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, f := range page.Files {
+			keys = append(keys, f.Key)
+		}
+		if !page.IsTruncated {
+			break
+		}
+		marker = page.NextMarker
+	}
+	want := "a.png,e.txt,images/2024/b.png,imagesx.txt,private/c.pdf,private/d.txt"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("List = %s, want %s", got, want)
+	}
+
+	page, err := router.List(ctx, "images/")
+	if err != nil || len(page.Files) != 1 || page.Files[0].Key != "images/2024/b.png" {
+		t.Errorf("List(images/) = %+v, %v", page, err)
+	}
+
+	if err := Ping(ctx, router); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+}
+
+func TestRouterStorage_NoFallback(t *testing.T) {
+	ctx := context.Background()
+	r, err := NewRouterStorage([]Route{{Prefix: "a/", Disk: NamedStorage{"a", newTestLocal(t)}}}, NamedStorage{})
+	if err != nil {
+		t.Fatalf("NewRouterStorage failed: %v", err)
+	}
+	if _, err := r.Upload(ctx, "b/x", strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+
+	for _, routes := range [][]Route{
+		nil,
+		{{Disk: NamedStorage{"a", newTestLocal(t)}}},
+		{{Prefix: "a/", Match: "a/**", Disk: NamedStorage{"a", newTestLocal(t)}}},
+		{{Match: "a/[", Disk: NamedStorage{"a", newTestLocal(t)}}},
+	} {
+		if _, err := NewRouterStorage(routes, NamedStorage{}); err == nil {
+			t.Errorf("Expected error for %+v", routes)
+		}
+	}
+}
+
+func TestRouterStorage_DiskReferences(t *testing.T) {
+	mgr, _ := newRouterManager(t)
+	if err := ValidateConfig(mgr.Config()); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+	if err := mgr.RemoveDisk("secure"); err == nil {
+		t.Error("Expected RemoveDisk to refuse a disk a route leads to")
+	}
+
+	cfg := mgr.cloneConfig()
+	files := cfg.Storages["files"]
+	files.Options = map[string]any{"routes": []any{map[string]any{"prefix": "x/", "disk": "missing"}}}
+	cfg.Storages["files"] = files
+	if err := ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), `"missing"`) {
+		t.Errorf("Expected missing disk error, got %v", err)
+	}
+}
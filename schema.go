@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DriverSchema describes the options a driver accepts.
+type DriverSchema struct {
+	Driver    string       `json:"driver"`
+	Composite bool         `json:"composite,omitempty"` // Built on other disks; opened through a Manager
+	Options   []OptionSpec `json:"options"`             // Nil if the driver registered no schema
+}
+
+var schemas = make(map[string]reflect.Type)
+
+// RegisterSchema registers the options of a driver, given as the struct
+// its options are decoded into with DecodeOptions. It is typically called
+// next to Register:
+//
+//	func init() {
+//	    storage.Register("s3", New)
+//	    storage.RegisterSchema("s3", Config{})
+//	}
+//
+// The schema is listed by DescribeDriver and lets ValidateConfig check a
+// disk's options without opening it.
+func RegisterSchema(driver string, config any) {
+	t := reflect.TypeOf(config)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("storage: RegisterSchema needs a struct for driver %s, got %T", driver, config))
+	}
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, exists := schemas[driver]; exists {
+		panic("storage: RegisterSchema called twice for driver " + driver)
+	}
+	schemas[driver] = t
+}
+
+// DescribeDriver returns the options accepted by a registered driver.
+// Options common to all disks, such as rate_limit, are not listed.
+func DescribeDriver(name string) (*DriverSchema, error) {
+	driversMu.RLock()
+	_, ok := drivers[name]
+	_, composite := composites[name]
+	t := schemas[name]
+	driversMu.RUnlock()
+	if !ok && !composite {
+		return nil, fmt.Errorf("storage: unknown driver %q (forgotten import?)", name)
+	}
+	schema := &DriverSchema{Driver: name, Composite: composite}
+	if t != nil {
+		schema.Options = optionFields(t)
+		if schema.Options == nil {
+			schema.Options = []OptionSpec{}
+		}
+	}
+	return schema, nil
+}
+
+// ValidateConfig checks a configuration without opening any disk: the
+// default disk exists, every driver is registered, the options of drivers
+// with a schema decode (including required options satisfied from the
+// environment), the wrapper options such as rate_limit are valid, and
+// composite disks reference configured disks without cycles. It reports
+// every problem found, sorted by disk name.
+func ValidateConfig(cfg *Config) error {
+	if cfg == nil {
+		return errors.New("storage: config is nil")
+	}
+	var errs []error
+	if cfg.Default != "" {
+		if _, ok := cfg.Storages[cfg.Default]; !ok {
+			errs = append(errs, fmt.Errorf("storage: default disk %q is not configured", cfg.Default))
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Storages))
+	for name := range cfg.Storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	refs := make(map[string][]string)
+	for _, name := range names {
+		disk, err := validateDisk(cfg, name)
+		refs[name] = disk
+		if err != nil {
+			errs = append(errs, fmt.Errorf("storage: disk %q: %w", name, err))
+		}
+	}
+	for _, name := range names {
+		if cycle := findCycle(refs, name, nil); cycle != nil {
+			errs = append(errs, fmt.Errorf("storage: disk %q references itself (%s)", name, strings.Join(cycle, " -> ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateDisk checks one disk and returns the disks it references.
+func validateDisk(cfg *Config, name string) ([]string, error) {
+	sc := cfg.Storages[name]
+	driversMu.RLock()
+	_, ok := drivers[sc.Driver]
+	_, composite := composites[sc.Driver]
+	t := schemas[sc.Driver]
+	driversMu.RUnlock()
+	if !ok && !composite {
+		return nil, fmt.Errorf("unknown driver %q (forgotten import?)", sc.Driver)
+	}
+
+	driverOpts, wrapOpts := splitDiskOptions(sc.Options)
+	for _, o := range diskOptions {
+		if v, ok := wrapOpts[o.key]; ok {
+			// Wrappers have no side effects when built, so nothing is opened.
+			if _, err := o.wrap(nil, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", o.key, err)
+			}
+		}
+	}
+	if t == nil {
+		return nil, nil
+	}
+
+	v := reflect.New(t)
+	if err := DecodeOptions(driverOpts, v.Interface()); err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, f := range optionFields(t) {
+		if !f.Disk {
+			continue
+		}
+		field := v.Elem().FieldByIndex(f.index)
+		if r, ok := field.Interface().(diskReferrer); ok {
+			refs = append(refs, r.diskRefs()...)
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			if field.String() != "" { // Optional reference
+				refs = append(refs, field.String())
+			}
+		case reflect.Slice:
+			for i := 0; i < field.Len(); i++ {
+				refs = append(refs, field.Index(i).String())
+			}
+		}
+	}
+	for _, ref := range refs {
+		if _, ok := cfg.Storages[ref]; !ok {
+			return refs, fmt.Errorf("references disk %q, which is not configured", ref)
+		}
+	}
+	return refs, nil
+}
+
+// diskReferrer is implemented by structured options that reference disks,
+// such as the routes of a router.
+type diskReferrer interface {
+	diskRefs() []string
+}
+
+// findCycle returns the path from name back to itself through refs, or
+// nil if there is none.
+func findCycle(refs map[string][]string, name string, path []string) []string {
+	if len(path) > 0 && path[0] == name {
+		return append(path, name)
+	}
+	for _, p := range path {
+		if p == name {
+			return nil // A cycle that does not include path[0]
+		}
+	}
+	path = append(path, name)
+	for _, ref := range refs[name] {
+		if cycle := findCycle(refs, ref, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
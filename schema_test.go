@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDescribeDriver(t *testing.T) {
+	schema, err := DescribeDriver("local")
+	if err != nil {
+		t.Fatalf("DescribeDriver failed: %v", err)
+	}
+	if schema.Composite || len(schema.Options) != 3 {
+		t.Fatalf("Unexpected schema: %+v", schema)
+	}
+	if root := schema.Options[0]; root.Name != "root" || !root.Required || root.Type != "string" {
+		t.Errorf("root = %+v", root)
+	}
+	if perm := schema.Options[2]; perm.Name != "perm" || perm.Default != "0644" || perm.Type != "int" {
+		t.Errorf("perm = %+v", perm)
+	}
+
+	schema, _ = DescribeDriver("mirror")
+	if !schema.Composite || !schema.Options[0].Disk || len(schema.Options[1].Enum) != 3 {
+		t.Errorf("Unexpected mirror schema: %+v", schema)
+	}
+	schema, _ = DescribeDriver("failover")
+	if len(schema.Options) < 2 || schema.Options[1].Name != "probe_interval" || schema.Options[1].Type != "duration" {
+		t.Errorf("Embedded options not listed: %+v", schema)
+	}
+
+	if _, err := DescribeDriver("nope"); err == nil {
+		t.Error("Expected an error for an unknown driver")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	root := t.TempDir()
+	cfg := &Config{
+		Default: "local",
+		Storages: map[string]StorageConfig{
+			"local":  {Driver: "local", Options: map[string]any{"root": root, "rate_limit": map[string]any{"ops_per_second": 10}}},
+			"backup": {Driver: "mirror", Options: map[string]any{"disks": []any{"local"}, "consistency": "quorum"}},
+		},
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+
+	cfg = &Config{
+		Default: "missing",
+		Storages: map[string]StorageConfig{
+			"a":      {Driver: "local", Options: map[string]any{"root": root, "perm": "rw"}},
+			"b":      {Driver: "local", Options: map[string]any{"rot": root}},
+			"c":      {Driver: "local", Options: map[string]any{"root": root, "circuit_breaker": "on"}},
+			"d":      {Driver: "tencnet"},
+			"e":      {Driver: "mirror", Options: map[string]any{"disks": "a, nope", "consistency": "most"}},
+			"f":      {Driver: "failover", Options: map[string]any{"disks": []any{"g"}}},
+			"g":      {Driver: "mirror", Options: map[string]any{"disks": []any{"f"}}},
+			"cached": {Driver: "tiered", Options: map[string]any{"hot": "a", "cold": "nope"}},
+		},
+	}
+	err := ValidateConfig(cfg)
+	if err == nil {
+		t.Fatal("Expected errors")
+	}
+	for _, want := range []string{
+		`default disk "missing"`,
+		`disk "a": option "perm"`,
+		`disk "b": unknown option "rot"`,
+		`disk "c": circuit_breaker`,
+		`disk "d": unknown driver "tencnet"`,
+		`disk "e": option "consistency": "most" is not one of all, quorum, async`,
+		`disk "cached": references disk "nope"`,
+		`(f -> g -> f)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error does not mention %q:\n%v", want, err)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("ValidateConfig wrote to the disk: %v", entries)
+	}
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ScopedStorage confines a Storage to the keys under a prefix, so that
+// several tenants can share one bucket.
+//
+// Keys are prefixed on the way in and the prefix is stripped from keys on
+// the way out (UploadResult, FileInfo, List). Keys that would resolve
+// outside the prefix, such as "../other/file" or "/etc/passwd", are
+// refused with ErrInvalidKey.
+type ScopedStorage struct {
+	wrapped
+	prefix string
+}
+
+// WrapWithScope confines a storage to prefix, e.g. "tenant-42/". The
+// prefix always ends in "/", which is added if missing, so that the scope
+// "tenant-4" does not include "tenant-42/". Scopes nest: scoping a
+// ScopedStorage appends to its prefix.
+func WrapWithScope(s Storage, prefix string) (*ScopedStorage, error) {
+	prefix = scopePrefix(prefix)
+	if prefix == "/" {
+		return nil, fmt.Errorf("%w: empty scope prefix", ErrInvalidKey)
+	}
+	if escapesScope(prefix) {
+		return nil, fmt.Errorf("%w: scope prefix %q contains \"..\"", ErrInvalidKey, prefix)
+	}
+	if strings.Contains(prefix, "//") {
+		return nil, fmt.Errorf("%w: scope prefix %q has an empty segment", ErrInvalidKey, prefix)
+	}
+	return &ScopedStorage{wrapped: wrapped{s}, prefix: prefix}, nil
+}
+
+// Prefix returns the prefix the storage is confined to.
+func (s *ScopedStorage) Prefix() string {
+	return s.prefix
+}
+
+// scopePrefix normalizes a scope prefix to "a/b/": no leading slash and a
+// trailing one. An empty prefix becomes "/", which WrapWithScope refuses.
+func scopePrefix(prefix string) string {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// escapesScope reports whether key could resolve above the directory it
+// is joined to.
+func escapesScope(key string) bool {
+	if strings.HasPrefix(key, "/") || strings.HasPrefix(key, `\`) {
+		return true
+	}
+	for _, seg := range strings.FieldsFunc(key, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the full key for a key inside the scope.
+func (s *ScopedStorage) key(key string) (string, error) {
+	if key == "" || escapesScope(key) {
+		return "", fmt.Errorf("%w: %q is outside the scope %q", ErrInvalidKey, key, s.prefix)
+	}
+	return s.prefix + key, nil
+}
+
+// strip returns the key relative to the scope.
+func (s *ScopedStorage) strip(key string) string {
+	return strings.TrimPrefix(key, s.prefix)
+}
+
+func (s *ScopedStorage) stripInfo(info *FileInfo) *FileInfo {
+	if info != nil {
+		info.Key = s.strip(info.Key)
+	}
+	return info
+}
+
+func (s *ScopedStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Storage.Upload(ctx, full, reader, opts...)
+	if result != nil {
+		result.Key = s.strip(result.Key)
+	}
+	return result, err
+}
+
+func (s *ScopedStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.Storage.Download(ctx, full)
+}
+
+func (s *ScopedStorage) Delete(ctx context.Context, key string) error {
+	full, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	return s.Storage.Delete(ctx, full)
+}
+
+func (s *ScopedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return false, err
+	}
+	return s.Storage.Exists(ctx, full)
+}
+
+func (s *ScopedStorage) URL(ctx context.Context, key string) (string, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return "", err
+	}
+	return s.Storage.URL(ctx, full)
+}
+
+func (s *ScopedStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return "", err
+	}
+	return s.wrapped.SignedURL(ctx, full, expires)
+}
+
+// UploadCredentials issues upload credentials for prefix within the
+// scope; see IssueUploadCredentials.
+func (s *ScopedStorage) UploadCredentials(ctx context.Context, prefix string, ttl time.Duration) (*UploadCredentials, error) {
+	if escapesScope(prefix) {
+		return nil, fmt.Errorf("%w: %q is outside the scope %q", ErrInvalidKey, prefix, s.prefix)
+	}
+	return IssueUploadCredentials(ctx, s.Storage, s.prefix+prefix, ttl)
+}
+
+// List lists the keys under prefix within the scope. An empty prefix
+// lists the whole scope.
+func (s *ScopedStorage) List(ctx context.Context, prefix string, opts ...ListOption) (*ListResult, error) {
+	if escapesScope(prefix) {
+		return nil, fmt.Errorf("%w: %q is outside the scope %q", ErrInvalidKey, prefix, s.prefix)
+	}
+	options := &ListOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.Marker != "" {
+		opts = append(opts, WithMarker(s.prefix+options.Marker))
+	}
+
+	result, err := s.wrapped.List(ctx, s.prefix+prefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+	files := result.Files[:0]
+	for _, f := range result.Files {
+		if strings.HasPrefix(f.Key, s.prefix) {
+			s.stripInfo(&f)
+			files = append(files, f)
+		}
+	}
+	result.Files = files
+	result.NextMarker = s.strip(result.NextMarker)
+	return result, nil
+}
+
+func (s *ScopedStorage) Copy(ctx context.Context, src, dst string) error {
+	fullSrc, err := s.key(src)
+	if err != nil {
+		return err
+	}
+	fullDst, err := s.key(dst)
+	if err != nil {
+		return err
+	}
+	return s.wrapped.Copy(ctx, fullSrc, fullDst)
+}
+
+func (s *ScopedStorage) Move(ctx context.Context, src, dst string) error {
+	fullSrc, err := s.key(src)
+	if err != nil {
+		return err
+	}
+	fullDst, err := s.key(dst)
+	if err != nil {
+		return err
+	}
+	return s.wrapped.Move(ctx, fullSrc, fullDst)
+}
+
+func (s *ScopedStorage) Size(ctx context.Context, key string) (int64, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return 0, err
+	}
+	return s.wrapped.Size(ctx, full)
+}
+
+func (s *ScopedStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.wrapped.Metadata(ctx, full)
+	return s.stripInfo(info), err
+}
+
+func (s *ScopedStorage) SetStorageClass(ctx context.Context, key string, class StorageClass) error {
+	full, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	return s.wrapped.SetStorageClass(ctx, full, class)
+}
+
+func (s *ScopedStorage) Restore(ctx context.Context, key string, days int) error {
+	full, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	return s.wrapped.Restore(ctx, full, days)
+}
+
+func (s *ScopedStorage) RestoreStatus(ctx context.Context, key string) (*RestoreStatus, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrapped.RestoreStatus(ctx, full)
+}
+
+var _ AdvancedStorage = (*ScopedStorage)(nil)
+var _ ArchiveStorage = (*ScopedStorage)(nil)
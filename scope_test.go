@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScopedStorage(t *testing.T) {
+	ctx := context.Background()
+	inner := newTestLocal(t)
+	s, err := WrapWithScope(inner, "tenant-42/")
+	if err != nil {
+		t.Fatalf("WrapWithScope failed: %v", err)
+	}
+
+	result, err := s.Upload(ctx, "docs/a.txt", strings.NewReader("a"))
+	if err != nil || result.Key != "docs/a.txt" {
+		t.Fatalf("Upload = %+v, %v; want the scoped key", result, err)
+	}
+	if got := readString(t, inner, "tenant-42/docs/a.txt"); got != "a" {
+		t.Errorf("inner has %q", got)
+	}
+	inner.Upload(ctx, "tenant-7/b.txt", strings.NewReader("b"))
+	s.Upload(ctx, "docs/c.txt", strings.NewReader("c"))
+
+	page, err := s.List(ctx, "", WithMaxKeys(1))
+	if err != nil || len(page.Files) != 1 || page.Files[0].Key != "docs/a.txt" || page.NextMarker != "docs/a.txt" {
+		t.Fatalf("List = %+v, %v", page, err)
+	}
+	page, err = s.List(ctx, "", WithMarker(page.NextMarker))
+	if err != nil || len(page.Files) != 1 || page.Files[0].Key != "docs/c.txt" {
+		t.Fatalf("List after marker = %+v, %v", page, err)
+	}
+
+	if info, err := s.Metadata(ctx, "docs/a.txt"); err != nil || info.Key != "docs/a.txt" {
+		t.Errorf("Metadata = %+v, %v", info, err)
+	}
+	if err := s.Copy(ctx, "docs/a.txt", "copy.txt"); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if ok, _ := inner.Exists(ctx, "tenant-42/copy.txt"); !ok {
+		t.Error("Copy should stay inside the scope")
+	}
+
+	for _, key := range []string{"", "../tenant-7/b.txt", "docs/../../tenant-7/b.txt", "/etc/passwd", `..\b.txt`} {
+		if _, err := s.Download(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Download(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if err := s.Move(ctx, "docs/a.txt", "../escaped.txt"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Move out of scope = %v, want ErrInvalidKey", err)
+	}
+	if _, err := WrapWithScope(inner, "a/../b/"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("WrapWithScope(a/../b/) = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestScopedStorage_SharedNamePrefix(t *testing.T) {
+	ctx := context.Background()
+	inner := newTestLocal(t)
+	short, _ := WrapWithScope(inner, "tenant-4")
+	long, _ := WrapWithScope(inner, "tenant-42")
+	if short.Prefix() != "tenant-4/" {
+		t.Errorf("Prefix = %q, want tenant-4/", short.Prefix())
+	}
+
+	long.Upload(ctx, "secret.txt", strings.NewReader("42"))
+	short.Upload(ctx, "a.txt", strings.NewReader("4"))
+	if ok, _ := short.Exists(ctx, "2/secret.txt"); ok {
+		t.Error("tenant-4 can read tenant-42's keys")
+	}
+	page, err := short.List(ctx, "")
+	if err != nil || len(page.Files) != 1 || page.Files[0].Key != "a.txt" {
+		t.Errorf("tenant-4 List = %+v, %v", page, err)
+	}
+	if got := readString(t, inner, "tenant-42/secret.txt"); got != "42" {
+		t.Errorf("tenant-42/secret.txt = %q", got)
+	}
+
+	for _, prefix := range []string{"", "/", "a//b"} {
+		if _, err := WrapWithScope(inner, prefix); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("WrapWithScope(%q) = %v, want ErrInvalidKey", prefix, err)
+		}
+	}
+}
+
+func TestDiskWrapper_Scope(t *testing.T) {
+	root := t.TempDir()
+	if err := Setup(map[string]any{
+		"default": "local",
+		"disks":   map[string]any{"local": map[string]any{"driver": "local", "root": root}},
+	}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	tenant := Disk("local").Scope("tenant-42/")
+	if _, err := tenant.Scope("private/").PutString("a.txt", "a"); err != nil {
+		t.Fatalf("PutString failed: %v", err)
+	}
+	if got, err := Disk("local").GetString("tenant-42/private/a.txt"); err != nil || got != "a" {
+		t.Errorf("GetString = %q, %v", got, err)
+	}
+	if got, err := tenant.GetString("private/a.txt"); err != nil || got != "a" {
+		t.Errorf("scoped GetString = %q, %v", got, err)
+	}
+	if _, err := tenant.GetString("../a.txt"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+
+	// Prefixes are "/"-terminated when scopes are joined.
+	if _, err := Disk("local").Scope("tenant-4").PutString("b.txt", "b"); err != nil {
+		t.Fatalf("PutString failed: %v", err)
+	}
+	if _, err := Disk("local").Scope("tenant").Scope("4").GetString("b.txt"); err == nil {
+		t.Error("Scope(tenant).Scope(4) should not read tenant-4/b.txt")
+	}
+	if got, _ := Disk("local").Scope("tenant-4").GetString("b.txt"); got != "b" {
+		t.Errorf("GetString = %q", got)
+	}
+	if _, err := Disk("local").Scope("").GetString("b.txt"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Scope(\"\") = %v, want ErrInvalidKey", err)
+	}
+}
+
+// uploadIssuer records the prefix it issues upload credentials for.
+type uploadIssuer struct {
+	Storage
+}
+
+func (u uploadIssuer) UploadCredentials(ctx context.Context, prefix string, ttl time.Duration) (*UploadCredentials, error) {
+	return &UploadCredentials{AccessKeyID: "tmp", Prefix: prefix, Expires: time.Now().Add(ttl)}, nil
+}
+
+func TestScopedStorage_UploadCredentials(t *testing.T) {
+	ctx := context.Background()
+	inner := uploadIssuer{newTestLocal(t)}
+	scoped, _ := WrapWithScope(inner, "tenant-42/")
+
+	creds, err := IssueUploadCredentials(ctx, scoped, "avatars/", time.Minute)
+	if err != nil || creds.Prefix != "tenant-42/avatars/" {
+		t.Fatalf("IssueUploadCredentials = %+v, %v", creds, err)
+	}
+	if _, err := IssueUploadCredentials(ctx, scoped, "../", time.Minute); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+
+	// Prefixes that would widen the bucket policy are refused.
+	for _, prefix := range []string{"", "/", "users/4", "users/*/", "users/[0-9]/", "/users/"} {
+		if _, err := IssueUploadCredentials(ctx, inner, prefix, time.Minute); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("IssueUploadCredentials(%q) = %v, want ErrInvalidKey", prefix, err)
+		}
+	}
+
+	// Other wrappers, which direct uploads would bypass, do not issue them.
+	ro := WrapWithReadOnly(inner)
+	if _, err := IssueUploadCredentials(ctx, ro, "", time.Minute); !errors.Is(err, ErrNotImplemented) {
+		t.Errorf("Expected ErrNotImplemented, got %v", err)
+	}
+}
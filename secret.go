@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SecretResolver resolves secret references in disk options, so that
+// credentials need not be written in the config:
+//
+//	aliyun:
+//	  driver: aliyun
+//	  access_key_id: env://OSS_AK
+//	  access_key_secret: secret://oss-secret      # /run/secrets/oss-secret
+//	  # or file:///var/run/secrets/oss/secret
+//
+// A string option of the form scheme://ref, where scheme has a registered
+// resolver, is replaced by ResolveSecret(ctx, ref) when the disk is opened.
+// Other strings, such as http:// endpoints, are left alone.
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to a SecretResolver.
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretResolverFunc) ResolveSecret(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var (
+	secretResolvers = map[string]SecretResolver{
+		"file":   FileSecretResolver{},
+		"secret": FileSecretResolver{Dir: "/run/secrets"},
+		"env":    EnvSecretResolver{},
+	}
+	secretResolversMu sync.RWMutex
+)
+
+// RegisterSecretResolver registers a resolver for scheme://ref option
+// values, replacing any previous one. The built-in schemes are file
+// (a file path), secret (a file under /run/secrets, as mounted by Docker
+// and Kubernetes) and env (an environment variable); register "secret"
+// again to read from a vault instead:
+//
+//	storage.RegisterSecretResolver("secret", storage.SecretResolverFunc(
+//	    func(ctx context.Context, name string) (string, error) {
+//	        return vault.Read(ctx, "kv/storage/"+name)
+//	    }))
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	switch scheme {
+	case "", "http", "https":
+		panic("storage: RegisterSecretResolver: invalid scheme " + strconv.Quote(scheme))
+	}
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	if r == nil {
+		delete(secretResolvers, scheme)
+		return
+	}
+	secretResolvers[scheme] = r
+}
+
+// ResolveSecret resolves a scheme://ref value with the registered
+// resolver. Values without a registered scheme are returned unchanged.
+func ResolveSecret(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+	secretResolversMu.RLock()
+	r, ok := secretResolvers[scheme]
+	secretResolversMu.RUnlock()
+	if !ok {
+		return value, nil
+	}
+	secret, err := r.ResolveSecret(ctx, ref)
+	if err != nil {
+		// The reference names the secret without revealing it.
+		return "", fmt.Errorf("secret %s: %w", value, err)
+	}
+	return secret, nil
+}
+
+// resolveSecrets returns a copy of opts with secret references resolved,
+// including those in nested maps and lists.
+func resolveSecrets(ctx context.Context, opts map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(opts))
+	for k, v := range opts {
+		resolved, err := resolveSecretValue(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("option %q: %w", k, err)
+		}
+		out[k] = resolved
+	}
+	return out, nil
+}
+
+func resolveSecretValue(ctx context.Context, v any) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return ResolveSecret(ctx, t)
+	case map[string]any:
+		return resolveSecrets(ctx, t)
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			resolved, err := resolveSecretValue(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// FileSecretResolver reads secrets from files. A relative reference is
+// looked up under Dir and may not leave it; trailing newlines are removed.
+// The file is read each time the secret is resolved, so rotated files are
+// picked up when a disk is reopened.
+type FileSecretResolver struct {
+	Dir string
+}
+
+func (r FileSecretResolver) ResolveSecret(ctx context.Context, ref string) (string, error) {
+	path := ref
+	if r.Dir != "" {
+		if filepath.IsAbs(ref) || escapesScope(ref) {
+			return "", fmt.Errorf("invalid secret name %q", ref)
+		}
+		path = filepath.Join(r.Dir, ref)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EnvSecretResolver reads secrets from environment variables. An unset or
+// empty variable is an error.
+type EnvSecretResolver struct{}
+
+func (EnvSecretResolver) ResolveSecret(ctx context.Context, name string) (string, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
+}
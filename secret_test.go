@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sk")
+	os.WriteFile(path, []byte("file-secret\n"), 0600)
+	t.Setenv("STORAGE_TEST_SECRET", "env-secret")
+
+	ctx := context.Background()
+	for value, want := range map[string]string{
+		"plain":                            "plain",
+		"https://oss.example.com":          "https://oss.example.com",
+		"unknown://x":                      "unknown://x",
+		"env://STORAGE_TEST_SECRET":        "env-secret",
+		"file://" + filepath.ToSlash(path): "file-secret",
+	} {
+		got, err := ResolveSecret(ctx, value)
+		if err != nil || got != want {
+			t.Errorf("ResolveSecret(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+
+	if _, err := ResolveSecret(ctx, "env://STORAGE_TEST_UNSET"); err == nil {
+		t.Error("Expected error for unset variable")
+	}
+	r := FileSecretResolver{Dir: dir}
+	if got, err := r.ResolveSecret(ctx, "sk"); err != nil || got != "file-secret" {
+		t.Errorf("ResolveSecret(sk) = %q, %v", got, err)
+	}
+	for _, ref := range []string{"../sk", "/etc/passwd", "a/../../sk"} {
+		if _, err := r.ResolveSecret(ctx, ref); err == nil {
+			t.Errorf("Expected error for %q", ref)
+		}
+	}
+}
+
+func TestOpen_ResolvesSecrets(t *testing.T) {
+	root := t.TempDir()
+	RegisterSecretResolver("test", SecretResolverFunc(func(ctx context.Context, ref string) (string, error) {
+		if ref == "root" {
+			return root, nil
+		}
+		return "", errors.New("not found")
+	}))
+	t.Cleanup(func() { RegisterSecretResolver("test", nil) })
+
+	mgr := NewManager(&Config{
+		Default: "local",
+		Storages: map[string]StorageConfig{
+			"local":   {Driver: "local", Options: map[string]any{"root": "test://root"}},
+			"missing": {Driver: "local", Options: map[string]any{"root": "test://missing"}},
+		},
+	})
+	defer mgr.Close()
+
+	s, err := mgr.Disk("local")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	if _, err := s.Upload(context.Background(), "a.txt", strings.NewReader("x")); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Errorf("File not written under the resolved root: %v", err)
+	}
+
+	_, err = mgr.Disk("missing")
+	if err == nil || !strings.Contains(err.Error(), `option "root": secret test://missing`) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCachedCredentials(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	p := NewCachedCredentials(CredentialsProviderFunc(func(ctx context.Context) (*Credentials, error) {
+		n := calls.Add(1)
+		if fail.Load() {
+			return nil, errors.New("sts unavailable")
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &Credentials{AccessKeyID: string(rune('0' + n)), Expires: time.Now().Add(90 * time.Second)}, nil
+	}), time.Minute)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c, err := p.Retrieve(ctx); err != nil || c.AccessKeyID != "1" {
+				t.Errorf("Retrieve = %+v, %v", c, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("Provider called %d times, want 1", n)
+	}
+
+	// Within the renewal window: renewed on the next call.
+	p.creds.Expires = time.Now().Add(30 * time.Second)
+	if c, _ := p.Retrieve(ctx); c.AccessKeyID != "2" {
+		t.Errorf("Expected renewed credentials, got %+v", c)
+	}
+
+	// Renewal fails but the credentials are still valid.
+	fail.Store(true)
+	p.creds.Expires = time.Now().Add(30 * time.Second)
+	if c, err := p.Retrieve(ctx); err != nil || c.AccessKeyID != "2" {
+		t.Errorf("Expected current credentials, got %+v, %v", c, err)
+	}
+	p.creds.Expires = time.Now().Add(-time.Second)
+	if _, err := p.Retrieve(ctx); err == nil {
+		t.Error("Expected error once the credentials expired")
+	}
+}
+
+func TestNewSecretCredentials(t *testing.T) {
+	t.Setenv("STORAGE_TEST_AK", "ak1")
+	t.Setenv("STORAGE_TEST_SK", "sk1")
+	p := NewSecretCredentials("env://STORAGE_TEST_AK", "env://STORAGE_TEST_SK", "", 50*time.Millisecond)
+
+	c, err := p.Retrieve(context.Background())
+	if err != nil || c.AccessKeyID != "ak1" || c.SecretAccessKey != "sk1" {
+		t.Fatalf("Retrieve = %+v, %v", c, err)
+	}
+	t.Setenv("STORAGE_TEST_AK", "ak2")
+	time.Sleep(60 * time.Millisecond)
+	if c, _ := p.Retrieve(context.Background()); c.AccessKeyID != "ak2" {
+		t.Errorf("Expected rotated key, got %+v", c)
+	}
+
+	// The secrets cannot be resolved: the current credentials are kept.
+	os.Unsetenv("STORAGE_TEST_AK")
+	time.Sleep(60 * time.Millisecond)
+	c, err = p.Retrieve(context.Background())
+	if err != nil || c.AccessKeyID != "ak2" || c.Expired(0) {
+		t.Errorf("Expected the current credentials to be kept, got %+v, %v", c, err)
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	var calls atomic.Int32
+	p := CacheCredentials(CredentialsProviderFunc(func(ctx context.Context) (*Credentials, error) {
+		calls.Add(1)
+		return &Credentials{AccessKeyID: "ak", Expires: time.Now().Add(time.Hour)}, nil
+	}))
+	for i := 0; i < 3; i++ {
+		if _, err := p.Retrieve(context.Background()); err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Provider called %d times, want 1", n)
+	}
+	if CacheCredentials(p) != p {
+		t.Error("Expected a CachedCredentials to be returned as is")
+	}
+}
@@ -8,11 +8,13 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 // global default manager
 var (
 	defaultMgr *Manager
+	stopWatch  context.CancelFunc // Stops the WatchConfig watcher, if any
 	defaultMu  sync.RWMutex
 )
 
@@ -39,10 +41,100 @@ func Setup(cfg map[string]any) error {
 	if err != nil {
 		return err
 	}
+	setDefaultManager(NewManager(c))
+	return nil
+}
+
+// SetupOption configures SetupFromFile.
+type SetupOption func(*setupOptions)
+
+type setupOptions struct {
+	watch    time.Duration
+	onReload func(error)
+}
+
+// WatchConfig makes SetupFromFile reload the configuration when the file
+// changes, checking every interval; see Manager.Reload. The watcher stops
+// when storage is set up again.
+func WatchConfig(interval time.Duration) SetupOption {
+	return func(o *setupOptions) {
+		o.watch = interval
+	}
+}
+
+// OnReload sets a function called with the result of every reload made by
+// WatchConfig, e.g. to report a broken config file.
+func OnReload(fn func(err error)) SetupOption {
+	return func(o *setupOptions) {
+		o.onReload = fn
+	}
+}
+
+// SetupFromFile initializes storage from a YAML or JSON file, expanding
+// ${VAR} and ${VAR:-default} placeholders. See LoadConfigReader.
+//
+//	storage.SetupFromFile("config.yaml", storage.WatchConfig(10*time.Second))
+func SetupFromFile(path string, opts ...SetupOption) error {
+	options := &setupOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	// Stat first so that a change made while loading is picked up.
+	fi, _ := os.Stat(path)
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	mgr := NewManager(cfg)
+	setDefaultManager(mgr)
+	if options.watch > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defaultMu.Lock()
+		if defaultMgr != mgr {
+			// Set up again meanwhile.
+			defaultMu.Unlock()
+			cancel()
+			return nil
+		}
+		stopWatch = cancel
+		defaultMu.Unlock()
+		go mgr.watchConfigFile(ctx, path, fi, options.watch, options.onReload)
+	}
+	return nil
+}
+
+// SetupFromReader initializes storage from YAML or JSON read from r.
+func SetupFromReader(r io.Reader) error {
+	cfg, err := LoadConfigReader(r)
+	if err != nil {
+		return err
+	}
+	setDefaultManager(NewManager(cfg))
+	return nil
+}
+
+// DefaultManager returns the Manager created by Setup, or nil before
+// Setup. Disks added to or removed from it are seen by Disk.
+func DefaultManager() *Manager {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultMgr
+}
+
+// setDefaultManager replaces the default Manager. The disks of the
+// previous one are closed once their in-flight operations finish.
+func setDefaultManager(mgr *Manager) {
 	defaultMu.Lock()
-	defaultMgr = NewManager(c)
+	old := defaultMgr
+	defaultMgr = mgr
+	if stopWatch != nil {
+		stopWatch()
+		stopWatch = nil
+	}
 	defaultMu.Unlock()
-	return nil
+	if old != nil {
+		old.shutdown()
+	}
 }
 
 // MustSetup is like Setup but panics on error.
@@ -107,25 +199,59 @@ func parseConfigMap(m map[string]any) (*Config, error) {
 }
 
 // Disk returns a storage disk by name.
-// Returns the default disk if name is empty.
+// If name is empty, each operation uses the disk named with WithDisk in
+// its context, else the one chosen by the Manager's disk resolvers, else
+// the default disk.
 func Disk(name string) *DiskWrapper {
 	return &DiskWrapper{name: name}
 }
 
 // DiskWrapper provides a fluent API for storage operations.
 type DiskWrapper struct {
-	name string
+	name  string
+	scope string // Key prefix, see Scope
 }
 
-func (d *DiskWrapper) storage() (Storage, error) {
-	defaultMu.RLock()
-	mgr := defaultMgr
-	defaultMu.RUnlock()
+// Scope returns a DiskWrapper confined to the keys under prefix; see
+// ScopedStorage. Scopes nest:
+//
+//	tenant := storage.Disk("s3").Scope("tenant-42/")
+//	tenant.PutString("avatar.png", data)            // s3: tenant-42/avatar.png
+//	tenant.Scope("private/").Get("contract.pdf")   // s3: tenant-42/private/contract.pdf
+func (d *DiskWrapper) Scope(prefix string) *DiskWrapper {
+	return &DiskWrapper{name: d.name, scope: d.scope + scopePrefix(prefix)}
+}
 
-	if mgr == nil {
-		return nil, fmt.Errorf("storage: not initialized (call Setup first)")
+// storage returns the disk for one operation on key, which must call
+// release when done; see Manager.Reload. Without a disk name the disk is
+// resolved through ctx; see Manager.SetDiskResolver.
+func (d *DiskWrapper) storage(ctx context.Context, key string) (s Storage, release func(), err error) {
+	for {
+		defaultMu.RLock()
+		mgr := defaultMgr
+		defaultMu.RUnlock()
+
+		if mgr == nil {
+			return nil, nil, fmt.Errorf("storage: not initialized (call Setup first)")
+		}
+		name := d.name
+		if name == "" {
+			name = mgr.resolveDisk(ctx, d.scope+key)
+		}
+		s, release, err = mgr.acquire(name)
+		if err == errManagerReplaced {
+			continue
+		}
+		if err != nil || d.scope == "" {
+			return s, release, err
+		}
+		scoped, err := WrapWithScope(s, d.scope)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		return scoped, release, nil
 	}
-	return mgr.Disk(d.name)
 }
 
 // Storage returns the underlying Storage interface.
@@ -137,75 +263,146 @@ func (d *DiskWrapper) storage() (Storage, error) {
 //	if adv, ok := s.(storage.AdvancedStorage); ok {
 //	    url, _ := adv.SignedURL(ctx, "file.txt", time.Hour)
 //	}
+//
+// The returned Storage is not counted as in use: a Reload that changes or
+// removes the disk closes it, so do not keep it across a reload. Use
+// Acquire for work that may overlap one.
 func (d *DiskWrapper) Storage() (Storage, error) {
-	return d.storage()
+	s, release, err := d.storage(context.Background(), "")
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return s, nil
+}
+
+// Acquire returns the underlying Storage like Storage, and keeps a Reload
+// from closing it until release is called:
+//
+//	s, release, err := storage.Disk("aliyun").Acquire(ctx)
+//	if err != nil {
+//	    return err
+//	}
+//	defer release()
+func (d *DiskWrapper) Acquire(ctx context.Context) (s Storage, release func(), err error) {
+	return d.storage(ctx, "")
+}
+
+// UploadCredentials issues temporary credentials for uploading keys under
+// prefix directly to the bucket, e.g. from a browser; see
+// IssueUploadCredentials. The scope of d is included:
+//
+//	creds, err := storage.Disk("oss").Scope("users/42/").UploadCredentials(ctx, "avatars/", 15*time.Minute)
+//	// creds.Prefix == "users/42/avatars/"
+func (d *DiskWrapper) UploadCredentials(ctx context.Context, prefix string, ttl time.Duration) (*UploadCredentials, error) {
+	s, release, err := d.storage(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return IssueUploadCredentials(ctx, s, prefix, ttl)
 }
 
 // Put uploads data to the storage.
 func (d *DiskWrapper) Put(key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
-	s, err := d.storage()
+	s, release, err := d.storage(context.Background(), key)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	return s.Upload(context.Background(), key, reader, opts...)
 }
 
 // PutWithContext uploads data with context.
 func (d *DiskWrapper) PutWithContext(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
-	s, err := d.storage()
+	s, release, err := d.storage(ctx, key)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	return s.Upload(ctx, key, reader, opts...)
 }
 
 // Get downloads data from the storage.
 func (d *DiskWrapper) Get(key string) (io.ReadCloser, error) {
-	s, err := d.storage()
+	s, release, err := d.storage(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := s.Download(context.Background(), key)
 	if err != nil {
+		release()
 		return nil, err
 	}
-	return s.Download(context.Background(), key)
+	return &releaseReader{ReadCloser: rc, release: release}, nil
 }
 
 // GetWithContext downloads data with context.
 func (d *DiskWrapper) GetWithContext(ctx context.Context, key string) (io.ReadCloser, error) {
-	s, err := d.storage()
+	s, release, err := d.storage(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := s.Download(ctx, key)
 	if err != nil {
+		release()
 		return nil, err
 	}
-	return s.Download(ctx, key)
+	return &releaseReader{ReadCloser: rc, release: release}, nil
 }
 
 // Delete removes a file from the storage.
 func (d *DiskWrapper) Delete(key string) error {
-	s, err := d.storage()
+	return d.DeleteWithContext(context.Background(), key)
+}
+
+// DeleteWithContext removes a file with context.
+func (d *DiskWrapper) DeleteWithContext(ctx context.Context, key string) error {
+	s, release, err := d.storage(ctx, key)
 	if err != nil {
 		return err
 	}
-	return s.Delete(context.Background(), key)
+	defer release()
+	return s.Delete(ctx, key)
 }
 
 // Exists checks if a file exists.
 func (d *DiskWrapper) Exists(key string) (bool, error) {
-	s, err := d.storage()
+	return d.ExistsWithContext(context.Background(), key)
+}
+
+// ExistsWithContext checks if a file exists with context.
+func (d *DiskWrapper) ExistsWithContext(ctx context.Context, key string) (bool, error) {
+	s, release, err := d.storage(ctx, key)
 	if err != nil {
 		return false, err
 	}
-	return s.Exists(context.Background(), key)
+	defer release()
+	return s.Exists(ctx, key)
 }
 
 // URL returns the public URL of a file.
 func (d *DiskWrapper) URL(key string) (string, error) {
-	s, err := d.storage()
+	return d.URLWithContext(context.Background(), key)
+}
+
+// URLWithContext returns the public URL of a file with context.
+func (d *DiskWrapper) URLWithContext(ctx context.Context, key string) (string, error) {
+	s, release, err := d.storage(ctx, key)
 	if err != nil {
 		return "", err
 	}
-	return s.URL(context.Background(), key)
+	defer release()
+	return s.URL(ctx, key)
 }
 
 // PutFile uploads a file from local path.
 func (d *DiskWrapper) PutFile(key, filePath string, opts ...UploadOption) (*UploadResult, error) {
+	return d.PutFileWithContext(context.Background(), key, filePath, opts...)
+}
+
+// PutFileWithContext uploads a file from local path with context.
+func (d *DiskWrapper) PutFileWithContext(ctx context.Context, key, filePath string, opts ...UploadOption) (*UploadResult, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("storage: failed to open file: %w", err)
@@ -228,22 +425,37 @@ func (d *DiskWrapper) PutFile(key, filePath string, opts ...UploadOption) (*Uplo
 		}
 	}
 
-	return d.Put(key, f, opts...)
+	return d.PutWithContext(ctx, key, f, opts...)
 }
 
 // PutBytes uploads bytes directly.
 func (d *DiskWrapper) PutBytes(key string, data []byte, opts ...UploadOption) (*UploadResult, error) {
-	return d.Put(key, bytes.NewReader(data), opts...)
+	return d.PutBytesWithContext(context.Background(), key, data, opts...)
+}
+
+// PutBytesWithContext uploads bytes with context.
+func (d *DiskWrapper) PutBytesWithContext(ctx context.Context, key string, data []byte, opts ...UploadOption) (*UploadResult, error) {
+	return d.PutWithContext(ctx, key, bytes.NewReader(data), opts...)
 }
 
 // PutString uploads a string directly.
 func (d *DiskWrapper) PutString(key, content string, opts ...UploadOption) (*UploadResult, error) {
-	return d.Put(key, strings.NewReader(content), opts...)
+	return d.PutStringWithContext(context.Background(), key, content, opts...)
+}
+
+// PutStringWithContext uploads a string with context.
+func (d *DiskWrapper) PutStringWithContext(ctx context.Context, key, content string, opts ...UploadOption) (*UploadResult, error) {
+	return d.PutWithContext(ctx, key, strings.NewReader(content), opts...)
 }
 
 // GetBytes downloads and returns bytes.
 func (d *DiskWrapper) GetBytes(key string) ([]byte, error) {
-	reader, err := d.Get(key)
+	return d.GetBytesWithContext(context.Background(), key)
+}
+
+// GetBytesWithContext downloads and returns bytes with context.
+func (d *DiskWrapper) GetBytesWithContext(ctx context.Context, key string) ([]byte, error) {
+	reader, err := d.GetWithContext(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -253,7 +465,12 @@ func (d *DiskWrapper) GetBytes(key string) ([]byte, error) {
 
 // GetString downloads and returns string.
 func (d *DiskWrapper) GetString(key string) (string, error) {
-	data, err := d.GetBytes(key)
+	return d.GetStringWithContext(context.Background(), key)
+}
+
+// GetStringWithContext downloads and returns string with context.
+func (d *DiskWrapper) GetStringWithContext(ctx context.Context, key string) (string, error) {
+	data, err := d.GetBytesWithContext(ctx, key)
 	if err != nil {
 		return "", err
 	}
@@ -331,3 +548,16 @@ func GetBytes(key string) ([]byte, error) {
 func GetString(key string) (string, error) {
 	return Disk("").GetString(key)
 }
+
+// releaseReader releases its disk when closed.
+type releaseReader struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *releaseReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
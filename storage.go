@@ -60,9 +60,11 @@ type AdvancedStorage interface {
 type FileInfo struct {
 	Key          string
 	Size         int64
+	StoredSize   int64 // Bytes stored by the backend, if it differs from Size (compression, encryption)
 	LastModified time.Time
 	ContentType  string
 	ETag         string
+	StorageClass StorageClass
 	Metadata     map[string]string
 }
 
@@ -117,8 +119,15 @@ type UploadResult struct {
 type UploadOptions struct {
 	ContentType        string
 	ContentDisposition string
+	CacheControl       string    // e.g., "public, max-age=31536000"
+	ContentEncoding    string    // e.g., "gzip", "br"
+	ContentLanguage    string    // e.g., "en-US"
+	Expires            time.Time // HTTP Expires header (zero = unset)
 	Metadata           map[string]string
-	ACL                string // e.g., "public-read", "private"
+	StorageClass       StorageClass
+	SSE                *ServerSideEncryption       // Server-side encryption (nil = bucket default)
+	Checksum           *Checksum                   // Expected checksum, verified by the provider
+	ACL                string                      // e.g., "public-read", "private"
 	ProgressFn         func(uploaded, total int64) // Progress callback
 }
 
@@ -139,6 +148,35 @@ func WithContentDisposition(cd string) UploadOption {
 	}
 }
 
+// WithCacheControl sets the Cache-Control header.
+func WithCacheControl(cc string) UploadOption {
+	return func(o *UploadOptions) {
+		o.CacheControl = cc
+	}
+}
+
+// WithContentEncoding sets the Content-Encoding header.
+// Use it for pre-compressed content, e.g. WithContentEncoding("gzip").
+func WithContentEncoding(ce string) UploadOption {
+	return func(o *UploadOptions) {
+		o.ContentEncoding = ce
+	}
+}
+
+// WithContentLanguage sets the Content-Language header.
+func WithContentLanguage(cl string) UploadOption {
+	return func(o *UploadOptions) {
+		o.ContentLanguage = cl
+	}
+}
+
+// WithExpires sets the Expires header.
+func WithExpires(t time.Time) UploadOption {
+	return func(o *UploadOptions) {
+		o.Expires = t
+	}
+}
+
 // WithMetadata sets custom metadata.
 func WithMetadata(m map[string]string) UploadOption {
 	return func(o *UploadOptions) {
@@ -146,6 +184,13 @@ func WithMetadata(m map[string]string) UploadOption {
 	}
 }
 
+// WithStorageClass sets the storage class (tier) of the uploaded object.
+func WithStorageClass(c StorageClass) UploadOption {
+	return func(o *UploadOptions) {
+		o.StorageClass = c
+	}
+}
+
 // WithACL sets the access control.
 func WithACL(acl string) UploadOption {
 	return func(o *UploadOptions) {
@@ -186,18 +231,35 @@ func Register(name string, driver Driver) {
 func Drivers() []string {
 	driversMu.RLock()
 	defer driversMu.RUnlock()
-	names := make([]string, 0, len(drivers))
+	names := make([]string, 0, len(drivers)+len(composites))
 	for name := range drivers {
 		names = append(names, name)
 	}
+	for name := range composites {
+		names = append(names, name)
+	}
 	return names
 }
 
 // Open creates a Storage instance using the specified driver and config.
+// Secret references in cfg are resolved first (see SecretResolver).
 func Open(driverName string, cfg map[string]any) (Storage, error) {
+	cfg, err := resolveSecrets(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	return openDriver(driverName, cfg)
+}
+
+// openDriver opens a driver with options whose secrets are resolved.
+func openDriver(driverName string, cfg map[string]any) (Storage, error) {
 	driversMu.RLock()
 	driver, ok := drivers[driverName]
+	_, composite := composites[driverName]
 	driversMu.RUnlock()
+	if composite {
+		return nil, fmt.Errorf("storage: driver %q is a composite driver and must be opened through a Manager", driverName)
+	}
 	if !ok {
 		return nil, fmt.Errorf("storage: unknown driver %q (forgotten import?)", driverName)
 	}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
 	"io"
 	"strings"
 	"sync"
@@ -303,3 +304,60 @@ func TestProgressReader(t *testing.T) {
 		t.Errorf("Expected total %d, got %d", len(content), lastTotal)
 	}
 }
+
+func TestParseRestoreHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		ongoing  bool
+		restored bool
+		expires  time.Time
+	}{
+		{"", false, false, time.Time{}},
+		{`ongoing-request="true"`, true, false, time.Time{}},
+		{
+			`ongoing-request="false", expiry-date="Fri, 23 Dec 2012 00:00:00 GMT"`,
+			false, true, time.Date(2012, 12, 23, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		got := ParseRestoreHeader(tt.header)
+		if got.Ongoing != tt.ongoing || got.Restored != tt.restored || !got.ExpiresAt.Equal(tt.expires) {
+			t.Errorf("ParseRestoreHeader(%q) = %+v", tt.header, got)
+		}
+	}
+}
+
+func TestParseSSEConfig(t *testing.T) {
+	sse, err := ParseSSEConfig("managed")
+	if err != nil || sse.Type != SSEManaged {
+		t.Errorf("Expected managed SSE, got %+v, %v", sse, err)
+	}
+
+	sse, err = ParseSSEConfig(map[string]any{"type": "kms", "kms_key_id": "alias/app"})
+	if err != nil || sse.Type != SSEKMS || sse.KMSKeyID != "alias/app" {
+		t.Errorf("Expected KMS SSE, got %+v, %v", sse, err)
+	}
+
+	key := strings.Repeat("k", 32)
+	sse, err = ParseSSEConfig(map[string]any{
+		"type":         "customer",
+		"customer_key": base64.StdEncoding.EncodeToString([]byte(key)),
+	})
+	if err != nil || string(sse.CustomerKey) != key {
+		t.Errorf("Expected SSE-C key, got %+v, %v", sse, err)
+	}
+
+	if _, err := ParseSSEConfig(map[string]any{"type": "customer", "customer_key": "c2hvcnQ="}); err == nil {
+		t.Error("Expected error for short customer key")
+	}
+
+	if sse, err := ParseSSEConfig(nil); sse != nil || err != nil {
+		t.Errorf("Expected nil for missing config, got %+v, %v", sse, err)
+	}
+
+	ctx := ContextWithSSE(context.Background(), &ServerSideEncryption{Type: SSEKMS})
+	if got := SSEFromContext(ctx, &ServerSideEncryption{Type: SSEManaged}); got.Type != SSEKMS {
+		t.Errorf("Context SSE should override the default, got %q", got.Type)
+	}
+}
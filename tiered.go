@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterComposite("tiered", newTieredFromConfig)
+	RegisterSchema("tiered", tieredConfig{})
+}
+
+// TieredOptions configures TieredStorage.
+type TieredOptions struct {
+	MaxAge        time.Duration `option:"max_age"`         // Objects older than this are moved to the cold tier (default 30 days)
+	SweepInterval time.Duration `option:"sweep_interval"`  // How often the sweeper runs (0 = only when Sweep is called)
+	PromoteOnRead bool          `option:"promote_on_read"` // Move objects read from the cold tier back to the hot tier
+}
+
+// SweepResult reports what a Sweep did.
+type SweepResult struct {
+	Scanned int
+	Demoted int
+	Skipped int     // Changed on the hot tier while being demoted
+	Errors  []error // One per object that could not be demoted
+}
+
+// TieredStorage keeps new objects on a hot disk and moves them to a cold
+// disk once they are older than MaxAge.
+//
+// Writes go to the hot tier. Reads try the hot tier first and fall back to
+// the cold one, so an object on both is served from the hot tier. Listing
+// merges both tiers. Objects are demoted by a sweeper, which runs every
+// SweepInterval or when Sweep is called.
+type TieredStorage struct {
+	hot, cold NamedStorage
+	opts      TieredOptions
+
+	sweeping sync.Mutex
+	ctx      context.Context // Canceled by Close to stop the sweeper
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewTieredStorage creates a tiered storage. The hot disk must support
+// List and Metadata so the sweeper can find old objects. The disks are not
+// closed by Close.
+func NewTieredStorage(hot, cold NamedStorage, opts TieredOptions) (*TieredStorage, error) {
+	if _, ok := hot.Storage.(AdvancedStorage); !ok {
+		return nil, fmt.Errorf("storage: tiered: hot disk %q does not support listing", hot.Name)
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 30 * 24 * time.Hour
+	}
+
+	t := &TieredStorage{hot: hot, cold: cold, opts: opts}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	if opts.SweepInterval > 0 {
+		t.wg.Add(1)
+		go t.sweepLoop()
+	}
+	return t, nil
+}
+
+// newTieredFromConfig creates a tiered storage from disk options:
+//
+//	hot: local           # disk receiving writes
+//	cold: oss            # disk receiving old objects
+//	max_age: 720h
+//	sweep_interval: 1h   # omit to sweep only on demand
+//	promote_on_read: false
+func newTieredFromConfig(disks DiskSource, cfg map[string]any) (Storage, error) {
+	var c tieredConfig
+	if err := DecodeOptions(cfg, &c); err != nil {
+		return nil, fmt.Errorf("tiered: %w", err)
+	}
+	tiers, err := childDisks(disks, []string{c.Hot, c.Cold})
+	if err != nil {
+		return nil, err
+	}
+	return NewTieredStorage(tiers[0], tiers[1], c.TieredOptions)
+}
+
+type tieredConfig struct {
+	Hot  string `option:"hot,required,disk"`
+	Cold string `option:"cold,required,disk"`
+	TieredOptions
+}
+
+func (t *TieredStorage) sweepLoop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.opts.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := t.Sweep(t.ctx)
+			switch {
+			case t.ctx.Err() != nil:
+				return
+			case err != nil:
+				defaultLogger.Warn("tiered: sweep failed: %v", err)
+			case result.Demoted > 0 || len(result.Errors) > 0:
+				defaultLogger.Info("tiered: demoted %d of %d objects, %d failed",
+					result.Demoted, result.Scanned, len(result.Errors))
+			}
+		}
+	}
+}
+
+// Sweep moves objects older than MaxAge from the hot tier to the cold
+// tier. An object is removed from the hot tier only after it has been
+// written to the cold tier, and is left in place if it was overwritten in
+// the meantime. Only one sweep runs at a time; a concurrent call waits.
+func (t *TieredStorage) Sweep(ctx context.Context) (*SweepResult, error) {
+	t.sweeping.Lock()
+	defer t.sweeping.Unlock()
+
+	files, err := listAll(ctx, t.hot.Storage.(AdvancedStorage), "")
+	if err != nil {
+		return nil, fmt.Errorf("storage: tiered: failed to list %s: %w", t.hot.Name, err)
+	}
+	cutoff := time.Now().Add(-t.opts.MaxAge)
+	result := &SweepResult{}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		result.Scanned++
+		if f.LastModified.IsZero() || f.LastModified.After(cutoff) {
+			continue
+		}
+		moved, err := t.move(ctx, t.hot, t.cold, f.Key, &f)
+		switch {
+		case err != nil:
+			result.Errors = append(result.Errors, fmt.Errorf("%q: %w", f.Key, err))
+		case moved:
+			result.Demoted++
+		default:
+			result.Skipped++
+		}
+	}
+	return result, nil
+}
+
+// move copies key from one tier to the other and deletes it from the
+// source, unless it changed there while being copied. seen is the source
+// object's listing entry, if known.
+func (t *TieredStorage) move(ctx context.Context, from, to NamedStorage, key string, seen *FileInfo) (bool, error) {
+	adv, _ := from.Storage.(AdvancedStorage)
+	if adv != nil {
+		info, err := adv.Metadata(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		if seen == nil {
+			seen = info
+		} else {
+			// Listings may lack the content type and user metadata.
+			seen.ContentType, seen.Metadata = info.ContentType, info.Metadata
+		}
+	}
+
+	rc, err := from.Download(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	var opts []UploadOption
+	if seen != nil {
+		if seen.ContentType != "" {
+			opts = append(opts, WithContentType(seen.ContentType))
+		}
+		if len(seen.Metadata) > 0 {
+			opts = append(opts, WithMetadata(seen.Metadata))
+		}
+	}
+	_, err = to.Upload(ctx, key, rc, opts...)
+	rc.Close()
+	if err != nil {
+		return false, fmt.Errorf("failed to write to %s: %w", to.Name, err)
+	}
+
+	if adv != nil && seen != nil {
+		now, err := adv.Metadata(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		if !now.LastModified.Equal(seen.LastModified) || now.ETag != seen.ETag || now.Size != seen.Size {
+			return false, nil
+		}
+	}
+	if err := from.Delete(ctx, key); err != nil {
+		return false, fmt.Errorf("failed to delete from %s: %w", from.Name, err)
+	}
+	return true, nil
+}
+
+// Upload writes key to the hot tier.
+func (t *TieredStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	return t.hot.Upload(ctx, key, reader, opts...)
+}
+
+// Download reads key from the hot tier, falling back to the cold tier.
+// With PromoteOnRead, an object found on the cold tier is moved to the
+// hot tier first.
+func (t *TieredStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := t.hot.Download(ctx, key)
+	if err == nil || !IsNotFoundError(err) {
+		return rc, err
+	}
+	if t.opts.PromoteOnRead {
+		if _, err := t.move(ctx, t.cold, t.hot, key, nil); err == nil {
+			return t.hot.Download(ctx, key)
+		} else if !IsNotFoundError(err) {
+			defaultLogger.Warn("tiered: failed to promote %q: %v", key, err)
+		}
+	}
+	return t.cold.Download(ctx, key)
+}
+
+// Delete deletes key from both tiers.
+func (t *TieredStorage) Delete(ctx context.Context, key string) error {
+	var errs []error
+	for _, d := range []NamedStorage{t.hot, t.cold} {
+		if err := d.Delete(ctx, key); err != nil && !IsNotFoundError(err) {
+			errs = append(errs, fmt.Errorf("%s: %w", d.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Exists reports whether key is on either tier.
+func (t *TieredStorage) Exists(ctx context.Context, key string) (bool, error) {
+	ok, err := t.hot.Exists(ctx, key)
+	if err != nil || ok {
+		return ok, err
+	}
+	return t.cold.Exists(ctx, key)
+}
+
+// tier returns the tier holding key: the hot tier if the key is there,
+// otherwise the cold tier.
+func (t *TieredStorage) tier(ctx context.Context, key string) (NamedStorage, error) {
+	ok, err := t.hot.Exists(ctx, key)
+	if err != nil {
+		return NamedStorage{}, err
+	}
+	if ok {
+		return t.hot, nil
+	}
+	return t.cold, nil
+}
+
+func (t *TieredStorage) advanced(ctx context.Context, key string) (AdvancedStorage, error) {
+	d, err := t.tier(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	adv, ok := d.Storage.(AdvancedStorage)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return adv, nil
+}
+
+// URL returns the URL of key on the tier holding it.
+func (t *TieredStorage) URL(ctx context.Context, key string) (string, error) {
+	d, err := t.tier(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return d.URL(ctx, key)
+}
+
+func (t *TieredStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	adv, err := t.advanced(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return adv.SignedURL(ctx, key, expires)
+}
+
+func (t *TieredStorage) Size(ctx context.Context, key string) (int64, error) {
+	adv, err := t.advanced(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return adv.Size(ctx, key)
+}
+
+func (t *TieredStorage) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	adv, err := t.advanced(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return adv.Metadata(ctx, key)
+}
+
+// Copy copies src to dst on the tier holding src. A copy of dst on the
+// other tier is deleted so it cannot shadow the new object.
+func (t *TieredStorage) Copy(ctx context.Context, src, dst string) error {
+	return t.relocate(ctx, src, dst, func(adv AdvancedStorage) error {
+		return adv.Copy(ctx, src, dst)
+	})
+}
+
+// Move moves src to dst on the tier holding src. A copy of dst on the
+// other tier is deleted so it cannot shadow the new object.
+func (t *TieredStorage) Move(ctx context.Context, src, dst string) error {
+	return t.relocate(ctx, src, dst, func(adv AdvancedStorage) error {
+		return adv.Move(ctx, src, dst)
+	})
+}
+
+func (t *TieredStorage) relocate(ctx context.Context, src, dst string, fn func(adv AdvancedStorage) error) error {
+	d, err := t.tier(ctx, src)
+	if err != nil {
+		return err
+	}
+	adv, ok := d.Storage.(AdvancedStorage)
+	if !ok {
+		return ErrNotImplemented
+	}
+	if err := fn(adv); err != nil {
+		return err
+	}
+	other := t.cold
+	if d.Name == t.cold.Name {
+		other = t.hot
+	}
+	if err := other.Delete(ctx, dst); err != nil && !IsNotFoundError(err) {
+		return fmt.Errorf("storage: tiered: failed to delete stale %q from %s: %w", dst, other.Name, err)
+	}
+	return nil
+}
+
+// List merges the listings of both tiers in key order. A key on both
+// tiers is listed once, with the hot tier's information.
+func (t *TieredStorage) List(ctx context.Context, prefix string, opts ...ListOption) (*ListResult, error) {
+	options := &ListOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	var results [2]*ListResult
+	for i, d := range []NamedStorage{t.hot, t.cold} {
+		adv, ok := d.Storage.(AdvancedStorage)
+		if !ok {
+			return nil, fmt.Errorf("storage: tiered: %s: %w", d.Name, ErrNotImplemented)
+		}
+		result, err := adv.List(ctx, prefix, opts...)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+
+	return mergeListings(results[:], options.MaxKeys, nil), nil
+}
+
+// Ping checks both tiers.
+func (t *TieredStorage) Ping(ctx context.Context) error {
+	return pingDisks(ctx, t.hot, t.cold)
+}
+
+// Close stops the sweeper, waiting for a running sweep to stop. The tier
+// disks are not closed.
+func (t *TieredStorage) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+var _ AdvancedStorage = (*TieredStorage)(nil)
+var _ Pinger = (*TieredStorage)(nil)
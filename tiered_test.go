@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTieredStorage(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := newTestLocal(t), newTestLocal(t)
+	s, err := NewTieredStorage(NamedStorage{"hot", hot}, NamedStorage{"cold", cold}, TieredOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("NewTieredStorage failed: %v", err)
+	}
+	defer s.Close()
+
+	for _, key := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err := s.Upload(ctx, key, strings.NewReader(key), WithContentType("text/plain")); err != nil {
+			t.Fatalf("Upload failed: %v", err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"a.txt", "c.txt"} {
+		os.Chtimes(hot.fullPath(key), old, old)
+	}
+
+	result, err := s.Sweep(ctx)
+	if err != nil || result.Demoted != 2 || len(result.Errors) != 0 {
+		t.Fatalf("Sweep = %+v, %v; want 2 demoted", result, err)
+	}
+	if ok, _ := hot.Exists(ctx, "a.txt"); ok {
+		t.Error("a.txt should have left the hot tier")
+	}
+	if info, err := cold.Metadata(ctx, "a.txt"); err != nil || info.ContentType != "text/plain" {
+		t.Errorf("Cold copy = %+v, %v; want the content type kept", info, err)
+	}
+	if got := readString(t, s, "a.txt"); got != "a.txt" {
+		t.Errorf("Download(a.txt) = %q", got)
+	}
+
+	// Listing merges both tiers in key order, page by page.
+	cold.Upload(ctx, "b.txt", strings.NewReader("stale"))
+	var keys []string
+	marker := ""
+	for {
+		page, err := s.List(ctx, "", WithMaxKeys(2), WithMarker(marker))
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, f := range page.Files {
+			keys = append(keys, f.Key)
+		}
+		if !page.IsTruncated {
+			break
+		}
+		marker = page.NextMarker
+	}
+	if strings.Join(keys, ",") != "a.txt,b.txt,c.txt" {
+		t.Errorf("List = %v", keys)
+	}
+
+	// A move within the cold tier removes the shadowing hot copy.
+	if err := s.Move(ctx, "c.txt", "b.txt"); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if got := readString(t, s, "b.txt"); got != "c.txt" {
+		t.Errorf("Download(b.txt) = %q, want the moved object", got)
+	}
+
+	if err := s.Delete(ctx, "b.txt"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ok, _ := s.Exists(ctx, "b.txt"); ok {
+		t.Error("b.txt should be gone from both tiers")
+	}
+}
+
+func TestTieredStorage_Promote(t *testing.T) {
+	ctx := context.Background()
+	hot, cold := newTestLocal(t), newTestLocal(t)
+	mgr := NewManager(&Config{
+		Storages: map[string]StorageConfig{
+			"hot":  {Driver: "local", Options: map[string]any{"root": hot.root}},
+			"cold": {Driver: "local", Options: map[string]any{"root": cold.root}},
+			"tiered": {Driver: "tiered", Options: map[string]any{
+				"hot": "hot", "cold": "cold", "max_age": "24h", "promote_on_read": true,
+			}},
+			"bad": {Driver: "tiered", Options: map[string]any{"hot": "hot"}},
+		},
+	})
+	defer mgr.Close()
+
+	s, err := mgr.Disk("tiered")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	if opts := s.(*TieredStorage).opts; opts.MaxAge != 24*time.Hour || !opts.PromoteOnRead {
+		t.Errorf("opts = %+v", opts)
+	}
+
+	cold.Upload(ctx, "a.txt", strings.NewReader("a"))
+	if got := readString(t, s, "a.txt"); got != "a" {
+		t.Errorf("Download = %q", got)
+	}
+	if ok, _ := hot.Exists(ctx, "a.txt"); !ok {
+		t.Error("a.txt should have been promoted to the hot tier")
+	}
+	if ok, _ := cold.Exists(ctx, "a.txt"); ok {
+		t.Error("a.txt should have left the cold tier")
+	}
+
+	if _, err := mgr.Disk("bad"); err == nil || !strings.Contains(err.Error(), "cold") {
+		t.Errorf("Expected a cold disk error, got %v", err)
+	}
+}
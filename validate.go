@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Validation rules, reported in ValidationError.Rule.
+const (
+	RuleMinSize     = "min_size"
+	RuleMaxSize     = "max_size"
+	RuleContentType = "content_type"
+	RuleExtension   = "extension"
+	RuleSniff       = "sniff"
+)
+
+// ValidationError is returned when an upload breaks a ValidationRules
+// rule. It matches ErrValidation with errors.Is.
+type ValidationError struct {
+	Key    string
+	Rule   string // One of the Rule constants
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("storage: upload %q rejected by %s: %s", e.Key, e.Rule, e.Detail)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// ValidationRules configures ValidatedStorage. Zero values disable a rule.
+//
+// Content types may end in "/*" to match a whole family, e.g. "image/*".
+// The type checked is the declared one (WithContentType), else the one
+// sniffed from the data when Sniff is set, else the one implied by the
+// key's extension.
+type ValidationRules struct {
+	MinSize           int64    `option:"min_size,size"`
+	MaxSize           int64    `option:"max_size,size"`
+	AllowedTypes      []string `option:"allowed_types"`
+	DeniedTypes       []string `option:"denied_types"`
+	AllowedExtensions []string `option:"allowed_extensions"` // e.g. ".jpg", matched case-insensitively
+	Sniff             bool     `option:"sniff"`              // Detect the type from the first bytes and reject mismatches with the declared type
+}
+
+// ValidatedStorage checks uploads against ValidationRules before and
+// while they are streamed to the wrapped storage. Sizes are enforced as
+// data is read, so an oversized stream is aborted without being buffered.
+// Copies and moves are checked against the extension rule.
+type ValidatedStorage struct {
+	wrapped
+	rules ValidationRules
+}
+
+// WrapWithValidation wraps a storage with upload validation.
+func WrapWithValidation(s Storage, rules ValidationRules) *ValidatedStorage {
+	exts := make([]string, len(rules.AllowedExtensions))
+	for i, ext := range rules.AllowedExtensions {
+		exts[i] = strings.ToLower(ext)
+		if !strings.HasPrefix(exts[i], ".") {
+			exts[i] = "." + exts[i]
+		}
+	}
+	rules.AllowedExtensions = exts
+	return &ValidatedStorage{wrapped: wrapped{s}, rules: rules}
+}
+
+func (v *ValidatedStorage) Upload(ctx context.Context, key string, reader io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	if err := v.checkExtension(key); err != nil {
+		return nil, err
+	}
+	if size, ok := readerSize(reader); ok {
+		if err := v.checkSize(key, size, true); err != nil {
+			return nil, err
+		}
+	}
+
+	options := &UploadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	declared := mediaType(options.ContentType)
+
+	if v.rules.Sniff {
+		head := make([]byte, 512)
+		n, err := io.ReadFull(reader, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		head = head[:n]
+		reader = io.MultiReader(bytes.NewReader(head), reader)
+		sniffed := mediaType(http.DetectContentType(head))
+		if declared == "" {
+			declared = sniffed
+			opts = append(opts, WithContentType(http.DetectContentType(head)))
+		} else if n > 0 && !sniffCompatible(declared, sniffed) {
+			return nil, &ValidationError{Key: key, Rule: RuleSniff,
+				Detail: fmt.Sprintf("declared %s but content looks like %s", declared, sniffed)}
+		}
+	}
+	if declared == "" {
+		declared = mediaType(DetectContentType(key))
+	}
+	if err := v.checkType(key, declared); err != nil {
+		return nil, err
+	}
+
+	vr := &validatingReader{r: reader, v: v, key: key}
+	result, err := v.Storage.Upload(ctx, key, vr, opts...)
+	if vr.err != nil {
+		// Report the violation rather than the driver's wrapping of it.
+		return nil, vr.err
+	}
+	return result, err
+}
+
+func (v *ValidatedStorage) Copy(ctx context.Context, src, dst string) error {
+	if err := v.checkExtension(dst); err != nil {
+		return err
+	}
+	return v.wrapped.Copy(ctx, src, dst)
+}
+
+func (v *ValidatedStorage) Move(ctx context.Context, src, dst string) error {
+	if err := v.checkExtension(dst); err != nil {
+		return err
+	}
+	return v.wrapped.Move(ctx, src, dst)
+}
+
+// checkSize checks size against the limits. The minimum only applies to a
+// complete size.
+func (v *ValidatedStorage) checkSize(key string, size int64, complete bool) error {
+	if v.rules.MaxSize > 0 && size > v.rules.MaxSize {
+		return &ValidationError{Key: key, Rule: RuleMaxSize,
+			Detail: fmt.Sprintf("larger than %d bytes", v.rules.MaxSize)}
+	}
+	if complete && size < v.rules.MinSize {
+		return &ValidationError{Key: key, Rule: RuleMinSize,
+			Detail: fmt.Sprintf("%d bytes is less than %d", size, v.rules.MinSize)}
+	}
+	return nil
+}
+
+func (v *ValidatedStorage) checkExtension(key string) error {
+	if len(v.rules.AllowedExtensions) == 0 {
+		return nil
+	}
+	ext := strings.ToLower(path.Ext(key))
+	for _, allowed := range v.rules.AllowedExtensions {
+		if ext == allowed {
+			return nil
+		}
+	}
+	if ext == "" {
+		ext = "no extension"
+	}
+	return &ValidationError{Key: key, Rule: RuleExtension, Detail: ext + " is not allowed"}
+}
+
+func (v *ValidatedStorage) checkType(key, contentType string) error {
+	for _, denied := range v.rules.DeniedTypes {
+		if matchType(denied, contentType) {
+			return &ValidationError{Key: key, Rule: RuleContentType, Detail: contentType + " is denied"}
+		}
+	}
+	if len(v.rules.AllowedTypes) == 0 {
+		return nil
+	}
+	for _, allowed := range v.rules.AllowedTypes {
+		if matchType(allowed, contentType) {
+			return nil
+		}
+	}
+	if contentType == "" {
+		contentType = "unknown type"
+	}
+	return &ValidationError{Key: key, Rule: RuleContentType, Detail: contentType + " is not allowed"}
+}
+
+// mediaType returns the lower-case media type without parameters.
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// matchType matches a media type against a pattern such as "image/png" or
+// "image/*".
+func matchType(pattern, contentType string) bool {
+	pattern = mediaType(pattern)
+	if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(contentType, family+"/")
+	}
+	return pattern == contentType
+}
+
+// sniffCompatible reports whether data sniffed as sniffed may have the
+// declared type. http.DetectContentType only knows a few dozen formats,
+// so it is trusted to tell binary formats and text apart rather than to
+// name the exact type.
+func sniffCompatible(declared, sniffed string) bool {
+	switch {
+	case declared == sniffed, sniffed == "application/octet-stream":
+		return true
+	case isTextType(declared):
+		return strings.HasPrefix(sniffed, "text/")
+	case sniffed == "application/zip":
+		// Office documents, jars and the like are zip archives.
+		return strings.HasPrefix(declared, "application/")
+	}
+	return false
+}
+
+func isTextType(mt string) bool {
+	switch mt {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-yaml", "application/yaml", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(mt, "text/") || strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
+
+// validatingReader enforces the size limits while the upload is read.
+type validatingReader struct {
+	r   io.Reader
+	v   *ValidatedStorage
+	key string
+	n   int64
+	err error
+}
+
+func (r *validatingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	complete := errors.Is(err, io.EOF)
+	if verr := r.v.checkSize(r.key, r.n, complete); verr != nil {
+		r.err = verr
+		return 0, verr
+	}
+	return n, err
+}
+
+// parseValidation reads the validation disk option:
+//
+//	validation:
+//	  max_size: 10MB
+//	  allowed_types: [image/*]
+//	  allowed_extensions: [.jpg, .png]
+//	  sniff: true
+func parseValidation(v any) (ValidationRules, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return ValidationRules{}, fmt.Errorf("expected a map, got %T", v)
+	}
+	var rules ValidationRules
+	err := DecodeOptions(m, &rules)
+	return rules, err
+}
+
+var _ AdvancedStorage = (*ValidatedStorage)(nil)
+var _ ArchiveStorage = (*ValidatedStorage)(nil)
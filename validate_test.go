@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestValidatedStorage(t *testing.T) {
+	ctx := context.Background()
+	inner := newTestLocal(t)
+	s := WrapWithValidation(inner, ValidationRules{
+		MinSize:           4,
+		MaxSize:           100,
+		AllowedTypes:      []string{"image/*", "text/plain"},
+		DeniedTypes:       []string{"image/svg+xml"},
+		AllowedExtensions: []string{"PNG", ".txt", ".svg"},
+		Sniff:             true,
+	})
+
+	tests := []struct {
+		name   string
+		key    string
+		data   io.Reader
+		ct     string
+		rule   string
+		stored bool
+	}{
+		{"ok", "a.png", bytes.NewReader(pngHeader), "image/png", "", true},
+		{"sniffed type", "b.txt", strings.NewReader("hello"), "", "", true},
+		{"extension", "a.exe", strings.NewReader("MZ..."), "", RuleExtension, false},
+		{"denied type", "a.svg", strings.NewReader("<svg></svg>"), "image/svg+xml", RuleContentType, false},
+		{"not allowed type", "c.txt", strings.NewReader(`{"a": 1}`), "application/json", RuleContentType, false},
+		{"disguised", "d.png", strings.NewReader("#!/bin/sh\nrm -rf /"), "image/png", RuleSniff, false},
+		{"too small", "e.txt", strings.NewReader("hi"), "", RuleMinSize, false},
+		{"too large", "f.txt", strings.NewReader(strings.Repeat("x", 101)), "", RuleMaxSize, false},
+		// Unsized streams are checked as they are read.
+		{"too large stream", "g.txt", io.MultiReader(strings.NewReader(strings.Repeat("x", 1000))), "", RuleMaxSize, false},
+		{"too small stream", "h.txt", io.MultiReader(strings.NewReader("hi")), "", RuleMinSize, false},
+	}
+	for _, tt := range tests {
+		var opts []UploadOption
+		if tt.ct != "" {
+			opts = append(opts, WithContentType(tt.ct))
+		}
+		_, err := s.Upload(ctx, tt.key, tt.data, opts...)
+		var verr *ValidationError
+		switch {
+		case tt.rule == "" && err != nil:
+			t.Errorf("%s: Upload failed: %v", tt.name, err)
+		case tt.rule != "" && (!errors.As(err, &verr) || verr.Rule != tt.rule || !errors.Is(err, ErrValidation)):
+			t.Errorf("%s: Upload = %v, want a %s violation", tt.name, err, tt.rule)
+		}
+		if ok, _ := inner.Exists(ctx, tt.key); ok != tt.stored {
+			t.Errorf("%s: stored = %v, want %v", tt.name, ok, tt.stored)
+		}
+	}
+
+	if info, _ := inner.Metadata(ctx, "b.txt"); !strings.HasPrefix(info.ContentType, "text/plain") {
+		t.Errorf("Sniffed content type not stored: %q", info.ContentType)
+	}
+	if err := s.Move(ctx, "a.png", "a.exe"); !errors.Is(err, ErrValidation) {
+		t.Errorf("Move to a denied extension = %v, want ErrValidation", err)
+	}
+	if IsRetryableError(&ValidationError{}) {
+		t.Error("Validation errors should not be retryable")
+	}
+}
+
+func TestValidation_Setup(t *testing.T) {
+	mgr := NewManager(&Config{
+		Storages: map[string]StorageConfig{
+			"uploads": {Driver: "local", Options: map[string]any{
+				"root": t.TempDir(),
+				"validation": map[string]any{
+					"max_size":           "1.5KB",
+					"allowed_types":      []any{"image/*"},
+					"allowed_extensions": "jpg, png",
+					"sniff":              true,
+				},
+			}},
+			"bad": {Driver: "local", Options: map[string]any{
+				"root":       t.TempDir(),
+				"validation": map[string]any{"max_size": "10 parsecs"},
+			}},
+		},
+	})
+	defer mgr.Close()
+
+	s, err := mgr.Disk("uploads")
+	if err != nil {
+		t.Fatalf("Disk failed: %v", err)
+	}
+	rules := s.(*ValidatedStorage).rules
+	if rules.MaxSize != 1536 || !rules.Sniff || len(rules.AllowedExtensions) != 2 || rules.AllowedExtensions[1] != ".png" {
+		t.Errorf("rules = %+v", rules)
+	}
+	if _, err := mgr.Disk("bad"); err == nil || !strings.Contains(err.Error(), "max_size") {
+		t.Errorf("Expected a max_size error, got %v", err)
+	}
+}
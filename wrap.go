@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// wrapped forwards every Storage, AdvancedStorage and ArchiveStorage call to
+// the inner storage. Decorators embed it and override the methods they change;
+// optional methods return ErrNotImplemented if the inner storage lacks them.
+type wrapped struct {
+	Storage
+}
+
+// Unwrap returns the decorated storage.
+func (w wrapped) Unwrap() Storage {
+	return w.Storage
+}
+
+func (w wrapped) advanced() (AdvancedStorage, error) {
+	adv, ok := w.Storage.(AdvancedStorage)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return adv, nil
+}
+
+func (w wrapped) archive() (ArchiveStorage, error) {
+	arc, ok := w.Storage.(ArchiveStorage)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return arc, nil
+}
+
+func (w wrapped) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	adv, err := w.advanced()
+	if err != nil {
+		return "", err
+	}
+	return adv.SignedURL(ctx, key, expires)
+}
+
+func (w wrapped) List(ctx context.Context, prefix string, opts ...ListOption) (*ListResult, error) {
+	adv, err := w.advanced()
+	if err != nil {
+		return nil, err
+	}
+	return adv.List(ctx, prefix, opts...)
+}
+
+func (w wrapped) Copy(ctx context.Context, src, dst string) error {
+	adv, err := w.advanced()
+	if err != nil {
+		return err
+	}
+	return adv.Copy(ctx, src, dst)
+}
+
+func (w wrapped) Move(ctx context.Context, src, dst string) error {
+	adv, err := w.advanced()
+	if err != nil {
+		return err
+	}
+	return adv.Move(ctx, src, dst)
+}
+
+func (w wrapped) Size(ctx context.Context, key string) (int64, error) {
+	adv, err := w.advanced()
+	if err != nil {
+		return 0, err
+	}
+	return adv.Size(ctx, key)
+}
+
+func (w wrapped) Metadata(ctx context.Context, key string) (*FileInfo, error) {
+	adv, err := w.advanced()
+	if err != nil {
+		return nil, err
+	}
+	return adv.Metadata(ctx, key)
+}
+
+func (w wrapped) SetStorageClass(ctx context.Context, key string, class StorageClass) error {
+	arc, err := w.archive()
+	if err != nil {
+		return err
+	}
+	return arc.SetStorageClass(ctx, key, class)
+}
+
+func (w wrapped) Restore(ctx context.Context, key string, days int) error {
+	arc, err := w.archive()
+	if err != nil {
+		return err
+	}
+	return arc.Restore(ctx, key, days)
+}
+
+func (w wrapped) RestoreStatus(ctx context.Context, key string) (*RestoreStatus, error) {
+	arc, err := w.archive()
+	if err != nil {
+		return nil, err
+	}
+	return arc.RestoreStatus(ctx, key)
+}
+
+var _ AdvancedStorage = wrapped{}
+var _ ArchiveStorage = wrapped{}